@@ -1,6 +1,10 @@
 package config
 
 import (
+	"donate/pkg/i18n"
+	"donate/pkg/jwt"
+	"donate/pkg/notify"
+
 	"github.com/fox-one/pkg/db"
 	"github.com/fsnotify/fsnotify"
 	"github.com/rs/zerolog/log"
@@ -10,11 +14,80 @@ import (
 type Config struct {
 	Port      string `mapstructure:"port" default:"8000"`
 	PprofAddr string `mapstructure:"pprof_addr" default:":28001"`
+	// 退出时等待 http 请求和进行中任务完成的秒数
+	ShutdownTimeoutSeconds int64 `mapstructure:"shutdown_timeout_seconds" default:"15"`
 
 	// RedisConfig     *RedisConfig `mapstructure:"redis"`
 	MixinConfig *MixinConfig `mapstructure:"mixin" required:"true"`
-	// MongoConfig     *MongoConfig `mapstructure:"mongo"`
-	DB *db.Config `mapstructure:"db" required:"true"`
+	// 存储实现, 为 gorm (默认, 使用 DB) 或 mongo (使用 Mongo)
+	Store string       `mapstructure:"store" default:"gorm"`
+	DB    *db.Config   `mapstructure:"db"`
+	Mongo *MongoConfig `mapstructure:"mongo"`
+	// 用户登录后签发的 token
+	Jwt *jwt.JwtConfig `mapstructure:"jwt" required:"true"`
+
+	Campaign *CampaignConfig `mapstructure:"campaign"`
+	// 运营后台, 未配置时不开放 /admin 接口
+	Admin *AdminConfig `mapstructure:"admin"`
+	// 项目方 webhook 的投递
+	Webhook *WebhookConfig `mapstructure:"webhook"`
+	// 捐赠通知的模板和项目链接
+	Notification *notify.Config `mapstructure:"notification"`
+	// 接口错误和转账 memo 的多语言消息
+	I18n *i18n.Config `mapstructure:"i18n"`
+	// 钱包对账的周期和告警
+	Reconcile *ReconcileConfig `mapstructure:"reconcile"`
+	// 后台合并小额 utxo 的周期和阈值
+	Consolidate *ConsolidateConfig `mapstructure:"consolidate"`
+}
+
+// ReconcileConfig 无法解释的差额折合美元超过 ThresholdUSD 时给 AlertUserIDs 发送消息
+// 没有价格的资产只要存在差额就告警
+type ReconcileConfig struct {
+	IntervalSeconds int64    `mapstructure:"interval_seconds" default:"600"`
+	ThresholdUSD    float64  `mapstructure:"threshold_usd" default:"1"`
+	AlertUserIDs    []string `mapstructure:"alert_user_ids"`
+}
+
+// ConsolidateConfig 某个资产未花费的 utxo 超过 MinUtxos 个时, 每轮合并其中金额最小的一批
+type ConsolidateConfig struct {
+	IntervalSeconds int64 `mapstructure:"interval_seconds" default:"300"`
+	MinUtxos        int   `mapstructure:"min_utxos" default:"32"`
+}
+
+// WebhookConfig 投递超时和是否允许内网地址, 内网地址只应在本地测试时开启
+type WebhookConfig struct {
+	TimeoutSeconds      int64 `mapstructure:"timeout_seconds" default:"10"`
+	AllowPrivateNetwork bool  `mapstructure:"allow_private_network"`
+}
+
+// AdminConfig 管理员请求头为 Authorization: Bearer {access_key}:{secret_key}
+type AdminConfig struct {
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+}
+
+const (
+	StoreGorm  = "gorm"
+	StoreMongo = "mongo"
+)
+
+// MongoConfig 事务需要 mongo 以副本集方式部署
+type MongoConfig struct {
+	URI      string `mapstructure:"uri"`
+	Database string `mapstructure:"database" default:"donate"`
+}
+
+const (
+	CampaignPolicyAccept   = "accept"   // 照常转给项目方
+	CampaignPolicyRefund   = "refund"   // 退还给捐赠者
+	CampaignPolicyRedirect = "redirect" // 转入 RedirectPID 对应的项目
+)
+
+// CampaignConfig 项目截止或达成目标后收到捐赠的处理策略
+type CampaignConfig struct {
+	ClosedPolicy string `mapstructure:"closed_policy" default:"accept"`
+	RedirectPID  string `mapstructure:"redirect_pid"`
 }
 
 type MixinConfig struct {
@@ -8,20 +8,20 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/fox-one/pkg/db"
 	"github.com/fox-one/pkg/store2"
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
-var _ model.DonateAction
-
 var (
 	configFile = flag.String("f", "~/.config/dome_loop_config_debug.json", "the config file")
-	signalChan = make(chan os.Signal, 1)
 )
 
 func main() {
@@ -34,29 +34,36 @@ func main() {
 	}
 	log.Debug().Any("conf", conf).Msg("init config success")
 
-	db, err := provideDatabase()
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(conf, flag.Args()[1:]); err != nil {
+			log.Fatal().Err(err).Msg("migrate failed")
+		}
+		return
+	}
+
+	store, closeStore, err := provideStore(conf)
 	if err != nil {
 		panic(err)
 	}
-	defer db.Close()
 
-	// ctx, cancel := context.WithCancel(context.Background())
-	// defer cancel()
+	// 收到 SIGINT / SIGTERM 后停止接收新任务, 等待进行中的任务完成
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	// go func() {
-	// 	sigCh := make(chan os.Signal, 1)
-	// 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	// 	<-sigCh
-	// 	log.Info().Msg("Received shutdown signal, exiting...")
-	// 	cancel()
-	// }()
-
-	router := router.NewService(conf, db)
+	router, err := router.NewService(conf, store)
+	if err != nil {
+		log.Fatal().Err(err).Msg("init service failed")
+	}
 
-	err = router.Run(conf.Port)
+	err = router.Run(ctx, conf.Port)
 	if err != nil {
 		log.Error().Err(err).Msg("run router failed")
 	}
+
+	if err := closeStore(); err != nil {
+		log.Error().Err(err).Msg("close store failed")
+	}
+	log.Info().Msg("server exited")
 }
 
 func connectDatabase(cfg db.Config, timeout time.Duration) (*store2.DB, error) {
@@ -64,11 +71,13 @@ func connectDatabase(cfg db.Config, timeout time.Duration) (*store2.DB, error) {
 	defer cancel()
 
 	dur := time.Millisecond
-	// TODO gorm config
 	gormCfg := &gorm.Config{
 		DisableForeignKeyConstraintWhenMigrating: true,
 		CreateBatchSize:                          5000,
 	}
+	if cfg.Debug {
+		gormCfg.Logger = logger.Default.LogMode(logger.Info)
+	}
 
 	for {
 		select {
@@ -83,25 +92,45 @@ func connectDatabase(cfg db.Config, timeout time.Duration) (*store2.DB, error) {
 		}
 	}
 }
-func provideDatabase() (*store2.DB, error) {
-	// 获取用户主目录
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("获取用户主目录失败: %w", err)
-	}
 
-	// 构建sqlite3数据库文件路径
-	dbPath := filepath.Join(homeDir, "donate.sqlite3")
+// provideStore 按配置选择 gorm 或 mongo 的存储实现, 返回的 close 在退出时调用
+func provideStore(conf *config.Config) (model.Store, func() error, error) {
+	switch conf.Store {
+	case "", config.StoreGorm:
+		db, err := provideDatabase(conf.DB)
+		if err != nil {
+			return model.Store{}, nil, err
+		}
+		return model.NewStore(db), db.Close, nil
+	case config.StoreMongo:
+		if conf.Mongo == nil || conf.Mongo.URI == "" {
+			return model.Store{}, nil, fmt.Errorf("mongo uri not configured")
+		}
+		database := conf.Mongo.Database
+		if database == "" {
+			database = "donate"
+		}
 
-	// 确保数据库文件所在目录存在
-	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
-		return nil, fmt.Errorf("创建数据库目录失败: %w", err)
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+		client, db, err := model.OpenMongo(ctx, conf.Mongo.URI, database)
+		if err != nil {
+			return model.Store{}, nil, fmt.Errorf("connect mongo: %w", err)
+		}
+		return model.NewMongoStore(db), func() error {
+			return client.Disconnect(context.Background())
+		}, nil
+	default:
+		return model.Store{}, nil, fmt.Errorf("unsupported store: %s", conf.Store)
 	}
+}
 
-	cfg := db.Config{
-		Dialect: "sqlite3",
-		Host:    dbPath,
-		Debug:   true,
+// provideDatabase 按配置的 dialect 连接数据库 (sqlite3, mysql, postgres)
+// 未配置时使用用户主目录下的 sqlite3 文件
+func provideDatabase(conf *db.Config) (*store2.DB, error) {
+	cfg, err := databaseConfig(conf)
+	if err != nil {
+		return nil, err
 	}
 
 	conn, err := connectDatabase(cfg, 8*time.Second)
@@ -115,3 +144,42 @@ func provideDatabase() (*store2.DB, error) {
 
 	return conn, nil
 }
+
+func databaseConfig(conf *db.Config) (db.Config, error) {
+	var cfg db.Config
+	if conf != nil {
+		cfg = *conf
+	}
+
+	switch cfg.Dialect {
+	case "", "sqlite", "sqlite3":
+		cfg.Dialect = "sqlite3"
+		if cfg.Host == "" {
+			// 获取用户主目录
+			homeDir, err := os.UserHomeDir()
+			if err != nil {
+				return cfg, fmt.Errorf("获取用户主目录失败: %w", err)
+			}
+			cfg.Host = filepath.Join(homeDir, "donate.sqlite3")
+		}
+
+		// 确保数据库文件所在目录存在
+		if cfg.Host != ":memory:" {
+			if err := os.MkdirAll(filepath.Dir(cfg.Host), 0755); err != nil {
+				return cfg, fmt.Errorf("创建数据库目录失败: %w", err)
+			}
+		}
+	case "mysql":
+		if cfg.Location == "" {
+			cfg.Location = "UTC"
+		}
+	case "postgres":
+		if cfg.SSLMode == "" {
+			cfg.SSLMode = "prefer"
+		}
+	default:
+		return cfg, fmt.Errorf("unsupported db dialect: %s", cfg.Dialect)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"donate/config"
+	"donate/model"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// runMigrate 执行 migrate 子命令
+//
+//	donate -f config.json migrate up [version]  升级到指定版本, 默认最新
+//	donate -f config.json migrate down [steps]  回滚最近的 steps 个版本, 默认 1
+//	donate -f config.json migrate status        查看已执行和待执行的版本
+func runMigrate(conf *config.Config, args []string) error {
+	if conf.Store == config.StoreMongo {
+		return fmt.Errorf("migrate only applies to the gorm store, mongo indexes are created at startup")
+	}
+
+	cfg, err := databaseConfig(conf.DB)
+	if err != nil {
+		return err
+	}
+	conn, err := connectDatabase(cfg, 8*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	cmd := "up"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+
+	switch cmd {
+	case "up":
+		var target int64
+		if len(args) > 1 {
+			if target, err = strconv.ParseInt(args[1], 10, 64); err != nil || target <= 0 {
+				return fmt.Errorf("invalid version: %s", args[1])
+			}
+		}
+		return model.MigrateUp(conn, target)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return fmt.Errorf("invalid steps: %s", args[1])
+			}
+		}
+		return model.MigrateDown(conn, steps)
+	case "status":
+		current, err := model.CurrentSchemaVersion(conn)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("current version: %d, latest version: %d\n", current, model.LatestSchemaVersion())
+		for _, m := range model.Migrations() {
+			state := "pending"
+			if m.Version <= current {
+				state = "applied"
+			}
+			fmt.Printf("%4d  %-32s %s\n", m.Version, m.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command: %s", cmd)
+	}
+}
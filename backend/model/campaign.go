@@ -0,0 +1,68 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	CampaignStatusUpcoming = "upcoming" // 未开始
+	CampaignStatusActive   = "active"   // 进行中
+	CampaignStatusEnded    = "ended"    // 已过截止时间
+	CampaignStatusReached  = "reached"  // 已达成目标
+)
+
+// Campaign 项目的募捐进度
+type Campaign struct {
+	Status string `json:"status"`
+	// 以目标单位 (USD 或目标资产) 计的已募集数额
+	Raised decimal.Decimal `json:"raised"`
+	// 完成百分比, 未设目标时为 0
+	Progress decimal.Decimal `json:"progress"`
+}
+
+// Closed 截止或已达成目标, 之后的捐赠按配置的策略处理
+func (c *Campaign) Closed() bool {
+	return c.Status == CampaignStatusEnded || c.Status == CampaignStatusReached
+}
+
+// HasGoal 是否设置了募捐目标
+func (p *Project) HasGoal() bool {
+	return p.GoalAmount.IsPositive()
+}
+
+// Campaign 计算项目在 now 时刻的募捐状态
+// totals 仅在以资产为目标时使用
+func (p *Project) Campaign(now time.Time, totals []*ProjectAssetTotal) *Campaign {
+	c := &Campaign{
+		Status:   CampaignStatusActive,
+		Raised:   p.RaisedUSD,
+		Progress: decimal.Zero,
+	}
+
+	if p.GoalAssetID != "" {
+		c.Raised = decimal.Zero
+		for _, total := range totals {
+			if total.AssetID == p.GoalAssetID {
+				c.Raised = total.Amount
+				break
+			}
+		}
+	}
+
+	if p.HasGoal() {
+		c.Progress = c.Raised.Div(p.GoalAmount).Mul(decimal.NewFromInt(100)).Round(2)
+	}
+
+	switch {
+	case p.HasGoal() && c.Raised.GreaterThanOrEqual(p.GoalAmount):
+		c.Status = CampaignStatusReached
+	case p.EndAt != nil && !now.Before(*p.EndAt):
+		c.Status = CampaignStatusEnded
+	case p.StartAt != nil && now.Before(*p.StartAt):
+		c.Status = CampaignStatusUpcoming
+	}
+
+	return c
+}
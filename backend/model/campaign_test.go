@@ -0,0 +1,70 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectCampaign(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+	btc := "c6d0c728-2624-429b-8e0d-d9d19b6592fa"
+
+	tests := []struct {
+		name         string
+		project      Project
+		totals       []*ProjectAssetTotal
+		wantStatus   string
+		wantProgress string
+	}{
+		{
+			name:         "no goal",
+			project:      Project{RaisedUSD: decimal.NewFromInt(10)},
+			wantStatus:   CampaignStatusActive,
+			wantProgress: "0",
+		},
+		{
+			name:         "usd goal in progress",
+			project:      Project{RaisedUSD: decimal.NewFromInt(25), GoalAmount: decimal.NewFromInt(100), EndAt: &after},
+			wantStatus:   CampaignStatusActive,
+			wantProgress: "25",
+		},
+		{
+			name:         "usd goal reached",
+			project:      Project{RaisedUSD: decimal.NewFromInt(150), GoalAmount: decimal.NewFromInt(100)},
+			wantStatus:   CampaignStatusReached,
+			wantProgress: "150",
+		},
+		{
+			name:    "asset goal",
+			project: Project{RaisedUSD: decimal.NewFromInt(1000), GoalAssetID: btc, GoalAmount: decimal.NewFromInt(2)},
+			totals: []*ProjectAssetTotal{
+				{AssetID: btc, Amount: decimal.NewFromInt(1)},
+			},
+			wantStatus:   CampaignStatusActive,
+			wantProgress: "50",
+		},
+		{
+			name:         "ended",
+			project:      Project{EndAt: &before},
+			wantStatus:   CampaignStatusEnded,
+			wantProgress: "0",
+		},
+		{
+			name:         "upcoming",
+			project:      Project{StartAt: &after},
+			wantStatus:   CampaignStatusUpcoming,
+			wantProgress: "0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.project.Campaign(now, tt.totals)
+			assert.Equal(t, tt.wantStatus, c.Status)
+			assert.Equal(t, tt.wantProgress, c.Progress.String())
+		})
+	}
+}
@@ -2,39 +2,16 @@ package model
 
 import (
 	"context"
+	"time"
 
 	"github.com/fox-one/pkg/store2"
-	"gorm.io/gorm"
+	"github.com/shopspring/decimal"
 )
 
 func init() {
+	// 启动时升级到最新版本, 回滚使用 migrate 子命令
 	store2.RegisterMigrate(func(db *store2.DB) error {
-		var tx *gorm.DB
-		tx = db.Update().Model(&User{})
-		if err := tx.AutoMigrate(&User{}); err != nil {
-			return err
-		}
-
-		tx = db.Update().Model(&Project{})
-		if err := tx.AutoMigrate(&Project{}); err != nil {
-			return err
-		}
-
-		tx = db.Update().Model(&DonateAction{})
-		if err := tx.AutoMigrate(&DonateAction{}); err != nil {
-			return err
-		}
-
-		tx = db.Update().Model(&Asset{})
-		if err := tx.AutoMigrate(&Asset{}); err != nil {
-			return err
-		}
-
-		tx = db.Update().Model(&Snapshot{})
-		if err := tx.AutoMigrate(&Snapshot{}); err != nil {
-			return err
-		}
-		return nil
+		return MigrateUp(db, 0)
 	})
 }
 
@@ -48,23 +25,55 @@ type UserStore interface {
 	// 根据 uid 查询用户
 	GetUserByUID(ctx context.Context, uid string) (*User, error)
 	GetUserByIdentityNumber(ctx context.Context, ident string) (*User, error)
+	// 批量查询用户, 不存在的 identity_number 不返回, 结果无序
+	ListUsersByIdentityNumbers(ctx context.Context, idents []string) ([]*User, error)
 	// 更新用户信息
 	UpdateUserBymuid(ctx context.Context, muid string, user *User) error
+	// 封禁或解封用户, bannedAt 为空表示解封
+	UpdateUserBanned(ctx context.Context, muid string, bannedAt *time.Time) error
 }
 
 type ProjectStore interface {
-	// 创建项目
-	AddProject(ctx context.Context, item *Project) error
-	// 删除项目
+	// 创建项目, 同时登记别名
+	AddProject(ctx context.Context, item *Project, aliases ...string) error
+	// 删除项目及其别名, 已有捐赠的项目返回 ErrProjectHasDonations
 	DeleteProject(ctx context.Context, id string) error
-	// 查询所有的项目
-	ListProjects(ctx context.Context, limit, offset int64) ([]*Project, error)
-	// 根据 identity_number 查询项目
-	GetProjectsByIdentityNumber(ctx context.Context, ident string, limit, offset int64) ([]*Project, error)
+	// 更新项目内容, pid 和统计数据不变
+	UpdateProject(ctx context.Context, item *Project) error
+	// 归档项目, 归档后不出现在列表中
+	ArchiveProject(ctx context.Context, pid string, at time.Time) error
+	// 管理员隐藏或封禁项目, 为空表示取消
+	UpdateProjectModeration(ctx context.Context, pid string, hiddenAt, bannedAt *time.Time) error
+	// 登记项目别名, 别名已存在时忽略
+	AddProjectAlias(ctx context.Context, pid, alias string) error
+	// 根据别名 (旧版 base64 链接生成的 ID) 查询项目
+	GetProjectByAlias(ctx context.Context, alias string) (*Project, error)
+	// 查询公开的项目 (未归档, 隐藏或封禁), 有下一页时返回下一页的 cursor
+	ListProjects(ctx context.Context, query *ProjectQuery) ([]*Project, *Cursor, error)
 	// 根据 id 查询项目
 	GetProject(ctx context.Context, pid string) (*Project, error)
+	// 批量查询项目, 不存在的 pid 不返回, 结果无序
+	ListProjectsByPIDs(ctx context.Context, pids []string) ([]*Project, error)
 	// Incr project donate cnt
 	IncrProjectDonateCnt(ctx context.Context, pid string) error
+	// 查询项目按资产统计的累计捐赠
+	ListProjectAssetTotals(ctx context.Context, pid string) ([]*ProjectAssetTotal, error)
+	// 批量查询多个项目的统计, 同一项目的统计按 USD 价值降序
+	ListProjectAssetTotalsByPIDs(ctx context.Context, pids []string) ([]*ProjectAssetTotal, error)
+}
+
+const (
+	ProjectOrderByDonateCnt = "donate_cnt"
+	ProjectOrderByRaisedUSD = "raised_usd"
+)
+
+// ProjectQuery 项目列表的过滤和分页, 按 OrderBy 倒序
+type ProjectQuery struct {
+	IdentityNumber string // 为空表示所有项目方
+	OrderBy        string // ProjectOrderBy* 之一, 默认为 donate_cnt
+	Limit          int64  // 0 表示不限制
+	Offset         int64  // 兼容旧的分页, Cursor 不为空时忽略
+	Cursor         *Cursor
 }
 
 type DonateActionStore interface {
@@ -74,6 +83,29 @@ type DonateActionStore interface {
 	QueryDonateActionsByIdentityNumber(ctx context.Context, ident string) ([]*DonateAction, error)
 	// 查询某个 项目 的被捐赠记录
 	QueryDonateActionsByPID(ctx context.Context, pid string) ([]*DonateAction, error)
+	// 按条件查询捐赠记录, 有下一页时返回下一页的 cursor
+	QueryDonateActions(ctx context.Context, query *DonateActionQuery) ([]*DonateAction, *Cursor, error)
+}
+
+const (
+	DonateActionOrderByTime      = "time"
+	DonateActionOrderByAmount    = "amount"
+	DonateActionOrderByAmountUSD = "usd"
+)
+
+// DonateActionQuery 捐赠记录的过滤, 排序和分页, 零值表示不过滤
+type DonateActionQuery struct {
+	PID              string
+	IdentityNumber   string // 捐赠者
+	AssetID          string
+	Since            time.Time       // 包含
+	Until            time.Time       // 不包含
+	MinAmount        decimal.Decimal // 按资产数量
+	ExcludeAnonymous bool
+	OrderBy          string // DonateActionOrderBy* 之一, 默认按时间
+	Asc              bool   // 默认倒序
+	Limit            int64  // 0 表示不限制
+	Cursor           *Cursor
 }
 
 type AssetStore interface {
@@ -91,4 +123,102 @@ type SnapshotStore interface {
 	InsertSnapshot(ctx context.Context, snapshot *Snapshot) error
 	GetSnapshotById(ctx context.Context, snapshotId string) (*Snapshot, error)
 	GetLastestSnapshot(ctx context.Context) (*Snapshot, error)
+	// 按时间倒序列出 snapshot, 有下一页时返回下一页的 cursor
+	ListSnapshots(ctx context.Context, limit int64, cursor *Cursor) ([]*Snapshot, *Cursor, error)
+}
+
+type PayoutStore interface {
+	// 创建出账记录, request_id 已存在时忽略
+	CreatePayout(ctx context.Context, payout *Payout) error
+	GetPayout(ctx context.Context, requestId string) (*Payout, error)
+	// 查询未完成 (pending / submitted) 的出账记录, 按创建时间排序
+	ListUnfinishedPayouts(ctx context.Context, limit int) ([]*Payout, error)
+	// 更新出账状态, 重试次数和错误信息
+	UpdatePayout(ctx context.Context, payout *Payout) error
+	// 为 snapshot 创建手动出账, 同一 snapshot 已有其他未失败的出账时返回 ErrSnapshotHasPayout
+	// request_id 已存在时返回已有的出账记录
+	CreateSnapshotPayout(ctx context.Context, payout *Payout) (*Payout, error)
+}
+
+type SyncStateStore interface {
+	GetSyncState(ctx context.Context, name string) (*SyncState, error)
+	// 写入同步进度, 不存在则创建
+	SaveSyncState(ctx context.Context, state *SyncState) error
+}
+
+// DonationRecord 一笔 snapshot 入账时需要落库的全部数据
+type DonationRecord struct {
+	Snapshot *Snapshot
+	// 捐赠记录, 为空表示该 snapshot 不计入捐赠 (如退款)
+	Action *DonateAction
+	// 出账记录 (转给项目方或退款), 可为空
+	Payout *Payout
+	// 推送给项目方 webhook 的投递, id 已存在时忽略
+	Deliveries []*WebhookDelivery
+}
+
+type DonationStore interface {
+	// 在同一事务内写入 snapshot, 捐赠记录, 项目捐赠统计, 出账记录和记账分录
+	// 以 SnapshotId 保证幂等, 已入账的 snapshot 返回 false 且不做任何修改
+	RecordDonation(ctx context.Context, record *DonationRecord) (bool, error)
+}
+
+type AdminAuditStore interface {
+	AddAdminAudit(ctx context.Context, audit *AdminAudit) error
+	// 按时间倒序列出操作记录, 有下一页时返回下一页的 cursor
+	ListAdminAudits(ctx context.Context, limit int64, cursor *Cursor) ([]*AdminAudit, *Cursor, error)
+}
+
+type WebhookStore interface {
+	AddWebhook(ctx context.Context, webhook *Webhook) error
+	GetWebhook(ctx context.Context, id string) (*Webhook, error)
+	// 按创建时间列出项目的 webhook
+	ListWebhooksByPID(ctx context.Context, pid string) ([]*Webhook, error)
+	// 更新地址, 密钥和停用状态
+	UpdateWebhook(ctx context.Context, webhook *Webhook) error
+	// 删除 webhook 及其投递记录
+	DeleteWebhook(ctx context.Context, id string) error
+	// 创建投递, id 已存在时忽略
+	CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	GetWebhookDelivery(ctx context.Context, id string) (*WebhookDelivery, error)
+	// 查询 now 之前到期的待投递记录, 按到期时间排序
+	ListDueWebhookDeliveries(ctx context.Context, now int64, limit int) ([]*WebhookDelivery, error)
+	// 更新投递状态, 重试次数和响应
+	UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	// 按时间倒序列出 webhook 的投递记录, 有下一页时返回下一页的 cursor
+	ListWebhookDeliveries(ctx context.Context, webhookID string, limit int64, cursor *Cursor) ([]*WebhookDelivery, *Cursor, error)
+}
+
+type ReconciliationStore interface {
+	// 按资产汇总入账的 snapshot 和未失败的出账
+	ListAssetLedgers(ctx context.Context) ([]*AssetLedger, error)
+	// 写入一次对账的所有资产
+	AddReconciliations(ctx context.Context, items []*Reconciliation) error
+	// 最近一次对账的结果, 没有对账记录时返回空
+	GetLatestReconciliations(ctx context.Context) ([]*Reconciliation, error)
+	// 按时间倒序列出对账记录, assetID 为空表示所有资产, 有下一页时返回下一页的 cursor
+	ListReconciliations(ctx context.Context, assetID string, limit int64, cursor *Cursor) ([]*Reconciliation, *Cursor, error)
+}
+
+type LedgerStore interface {
+	// 写入分录, 每笔交易每个资产的分录之和需为 0, 否则返回 ErrUnbalancedLedgerTx
+	// 以 TxID 保证幂等, 已存在的交易忽略
+	PostLedgerEntries(ctx context.Context, entries []*LedgerEntry) error
+	// 截至 at (含) 各账户每个资产的余额, 不返回余额为 0 的账户
+	// account 为空表示所有账户, at 为 0 表示当前
+	ListLedgerBalances(ctx context.Context, account string, at int64) ([]*LedgerBalance, error)
+	// 截至 at (含) 分录之和不为 0 的资产, 账本正确时为空
+	ListLedgerImbalances(ctx context.Context, at int64) ([]*LedgerBalance, error)
+}
+
+type ConsolidationStore interface {
+	// 创建聚合记录, request_id 已存在时忽略
+	CreateConsolidation(ctx context.Context, consolidation *Consolidation) error
+	GetConsolidation(ctx context.Context, requestId string) (*Consolidation, error)
+	// 查询未完成 (pending / submitted) 的聚合记录, 按创建时间排序
+	ListUnfinishedConsolidations(ctx context.Context, limit int) ([]*Consolidation, error)
+	// 更新状态, 重试次数和错误信息
+	UpdateConsolidation(ctx context.Context, consolidation *Consolidation) error
+	// 按时间倒序列出聚合记录, assetID 为空表示所有资产, 有下一页时返回下一页的 cursor
+	ListConsolidations(ctx context.Context, assetID string, limit int64, cursor *Cursor) ([]*Consolidation, *Cursor, error)
 }
@@ -2,18 +2,31 @@ package model
 
 import (
 	"context"
+	"sort"
+	"time"
 
 	"github.com/fox-one/pkg/store2"
+	"github.com/samber/lo"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func NewStore(db *store2.DB) Store {
 	return Store{
-		UserStore:         NewUserStore(db),
-		ProjectStore:      NewProjectStore(db),
-		DonateActionStore: NewDonateActionStore(db),
-		AssetStore:        NewAssetStore(db),
-		SnapshotStore:     NewSnapshotStore(db),
+		UserStore:           NewUserStore(db),
+		ProjectStore:        NewProjectStore(db),
+		DonateActionStore:   NewDonateActionStore(db),
+		AssetStore:          NewAssetStore(db),
+		SnapshotStore:       NewSnapshotStore(db),
+		PayoutStore:         NewPayoutStore(db),
+		SyncStateStore:      NewSyncStateStore(db),
+		DonationStore:       NewDonationStore(db),
+		AdminAuditStore:     NewAdminAuditStore(db),
+		WebhookStore:        NewWebhookStore(db),
+		ReconciliationStore: NewReconciliationStore(db),
+		LedgerStore:         NewLedgerStore(db),
+		ConsolidationStore:  NewConsolidationStore(db),
 	}
 }
 
@@ -23,6 +36,14 @@ type Store struct {
 	DonateActionStore
 	AssetStore
 	SnapshotStore
+	PayoutStore
+	SyncStateStore
+	DonationStore
+	AdminAuditStore
+	WebhookStore
+	ReconciliationStore
+	LedgerStore
+	ConsolidationStore
 }
 
 func NewAssetStore(db *store2.DB) AssetStore {
@@ -42,7 +63,7 @@ func (a *assetStore) ListAssets(ctx context.Context) (assets []*Asset, err error
 // 获取某个资产
 func (a *assetStore) GetAsset(ctx context.Context, id string) (asset *Asset, err error) {
 	asset = &Asset{}
-	err = a.db.View().Where("id = ?", id).First(asset).Error
+	err = a.db.View().Where("asset_id = ?", id).First(asset).Error
 	return
 }
 
@@ -54,6 +75,27 @@ type store struct {
 	db *store2.DB
 }
 
+// inBatchSize IN 查询每批的参数个数, 低于 sqlite 的变量数上限
+const inBatchSize = 500
+
+// findIn 按 column IN values 分批查询, values 去重后为空时不查询
+// 每批内按 order 排序, 批之间不保证顺序
+func findIn[T any](db *store2.DB, column string, values []string, order string) ([]*T, error) {
+	var items []*T
+	for _, batch := range lo.Chunk(lo.Uniq(values), inBatchSize) {
+		var rows []*T
+		query := db.View().Where(column+" IN ?", batch)
+		if order != "" {
+			query = query.Order(order)
+		}
+		if err := query.Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		items = append(items, rows...)
+	}
+	return items, nil
+}
+
 // User 实现
 type userStore struct {
 	*store
@@ -91,11 +133,23 @@ func (s *userStore) GetUserByIdentityNumber(ctx context.Context, ident string) (
 	return &user, err
 }
 
+func (s *userStore) ListUsersByIdentityNumbers(ctx context.Context, idents []string) ([]*User, error) {
+	return findIn[User](s.db, "identity_number", idents, "")
+}
+
 func (s *userStore) UpdateUserBymuid(ctx context.Context, mixin_uid string, user *User) error {
 	// 根据muid更新用户信息
 	return s.db.Where("mixin_uid = ?", mixin_uid).Updates(user).Error
 }
 
+func (s *userStore) UpdateUserBanned(ctx context.Context, mixin_uid string, bannedAt *time.Time) error {
+	return s.db.Update().Model(&User{}).Where("mixin_uid = ?", mixin_uid).Update("banned_at", bannedAt).Error
+}
+
+// publicProjectCond 公开展示的项目: 未归档, 未被隐藏或封禁, 且项目方未被封禁
+const publicProjectCond = "archived_at IS NULL AND hidden_at IS NULL AND banned_at IS NULL AND " +
+	"NOT EXISTS (SELECT 1 FROM users WHERE users.mixin_uid = projects.mixin_uid AND users.banned_at IS NOT NULL)"
+
 // DonateItem 实现
 type projectStore struct {
 	*store
@@ -105,32 +159,109 @@ func NewProjectStore(db *store2.DB) ProjectStore {
 	return &projectStore{&store{db: db}}
 }
 
-func (s *projectStore) AddProject(ctx context.Context, project *Project) error {
-	return s.db.Create(project).Error
+func (s *projectStore) AddProject(ctx context.Context, project *Project, aliases ...string) error {
+	return s.db.Tx(func(tx *store2.DB) error {
+		if err := tx.Update().Create(project).Error; err != nil {
+			return err
+		}
+		for _, alias := range aliases {
+			if err := tx.Update().Create(&ProjectAlias{Alias: alias, PID: project.PID, CreatedAt: project.CreatedAt}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func (s *projectStore) DeleteProject(ctx context.Context, id string) error {
-	return s.db.Delete(&Project{}, "id = ?", id).Error
+	return s.db.Tx(func(tx *store2.DB) error {
+		var count int64
+		if err := tx.Update().Model(&DonateAction{}).Where("pid = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrProjectHasDonations
+		}
+		if err := tx.Update().Delete(&ProjectAlias{}, "pid = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Update().Delete(&Project{}, "pid = ?", id).Error
+	})
 }
 
-func (s *projectStore) ListProjects(ctx context.Context, limit, offset int64) (projects []*Project, err error) {
-	err = s.db.Order("donate_cnt DESC").Limit(int(limit)).Offset(int(offset)).Find(&projects).Error
-	return
+func (s *projectStore) ArchiveProject(ctx context.Context, pid string, at time.Time) error {
+	return s.db.Update().Model(&Project{}).Where("pid = ?", pid).Update("archived_at", at).Error
+}
+
+func (s *projectStore) UpdateProjectModeration(ctx context.Context, pid string, hiddenAt, bannedAt *time.Time) error {
+	return s.db.Update().Model(&Project{}).Where("pid = ?", pid).Updates(map[string]interface{}{
+		"hidden_at": hiddenAt,
+		"banned_at": bannedAt,
+	}).Error
+}
+
+func (s *projectStore) AddProjectAlias(ctx context.Context, pid, alias string) error {
+	return s.db.Update().Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&ProjectAlias{Alias: alias, PID: pid, CreatedAt: time.Now()}).Error
+}
+
+func (s *projectStore) GetProjectByAlias(ctx context.Context, alias string) (project *Project, err error) {
+	var item ProjectAlias
+	if err = s.db.View().Where("alias = ?", alias).First(&item).Error; err != nil {
+		return nil, err
+	}
+	return s.GetProject(ctx, item.PID)
+}
+
+func (s *projectStore) UpdateProject(ctx context.Context, project *Project) error {
+	return s.db.Update().Model(&Project{}).
+		Where("pid = ?", project.PID).
+		Select("title", "description", "img_url", "link", "goal_asset_id", "goal_amount", "start_at", "end_at").
+		Updates(project).Error
+}
+
+func (s *projectStore) ListProjects(ctx context.Context, q *ProjectQuery) ([]*Project, *Cursor, error) {
+	column, value, err := q.sort()
+	if err != nil {
+		return nil, nil, err
+	}
+	tx := s.db.View().Where(publicProjectCond)
+	if q.IdentityNumber != "" {
+		tx = tx.Where("identity_number = ?", q.IdentityNumber)
+	}
+	if q.Cursor == nil && q.Offset > 0 {
+		tx = tx.Offset(int(q.Offset))
+	}
+	var projects []*Project
+	if err := keyset(tx, column, "pid", false, value, q.Cursor.id()).Limit(pageLimit(q.Limit)).Find(&projects).Error; err != nil {
+		return nil, nil, err
+	}
+	projects, next := pageOf(projects, q.Limit, projectCursor(column))
+	return projects, next, nil
 }
 
 func (s *projectStore) GetProject(ctx context.Context, id string) (project *Project, err error) {
 	err = s.db.Where("pid = ?", id).First(&project).Error
 	return
 }
-func (s *projectStore) GetProjectsByIdentityNumber(ctx context.Context, ident string, limit, offset int64) (projects []*Project, err error) {
-	err = s.db.Where("identity_number = ?", ident).Order("donate_cnt DESC").Limit(int(limit)).Offset(int(offset)).Find(&projects).Error
-	return
+
+func (s *projectStore) ListProjectsByPIDs(ctx context.Context, pids []string) ([]*Project, error) {
+	return findIn[Project](s.db, "pid", pids, "")
 }
 
 func (s *projectStore) IncrProjectDonateCnt(ctx context.Context, pid string) error {
 	return s.db.Model(&Project{}).Where("pid = ?", pid).Update("donate_cnt", gorm.Expr("donate_cnt + 1")).Error
 }
 
+func (s *projectStore) ListProjectAssetTotals(ctx context.Context, pid string) (totals []*ProjectAssetTotal, err error) {
+	err = s.db.View().Where("pid = ?", pid).Order("amount_usd DESC").Find(&totals).Error
+	return
+}
+
+func (s *projectStore) ListProjectAssetTotalsByPIDs(ctx context.Context, pids []string) ([]*ProjectAssetTotal, error) {
+	return findIn[ProjectAssetTotal](s.db, "pid", pids, "amount_usd DESC")
+}
+
 // DonateAction 实现
 type donateActionStore struct {
 	*store
@@ -156,6 +287,41 @@ func (s *donateActionStore) QueryDonateActionsByPID(ctx context.Context, pid str
 	return actions, err
 }
 
+func (s *donateActionStore) QueryDonateActions(ctx context.Context, q *DonateActionQuery) ([]*DonateAction, *Cursor, error) {
+	column, value, err := q.sort()
+	if err != nil {
+		return nil, nil, err
+	}
+	tx := s.db.View()
+	if q.PID != "" {
+		tx = tx.Where("pid = ?", q.PID)
+	}
+	if q.IdentityNumber != "" {
+		tx = tx.Where("identity_number = ?", q.IdentityNumber)
+	}
+	if q.AssetID != "" {
+		tx = tx.Where("asset_id = ?", q.AssetID)
+	}
+	if !q.Since.IsZero() {
+		tx = tx.Where("created_at >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		tx = tx.Where("created_at < ?", q.Until)
+	}
+	if q.MinAmount.IsPositive() {
+		tx = tx.Where("amount >= ?", q.MinAmount)
+	}
+	if q.ExcludeAnonymous {
+		tx = tx.Where("anonymous = ?", false)
+	}
+	var actions []*DonateAction
+	if err := keyset(tx, column, "id", q.Asc, value, q.Cursor.id()).Limit(pageLimit(q.Limit)).Find(&actions).Error; err != nil {
+		return nil, nil, err
+	}
+	actions, next := pageOf(actions, q.Limit, donateActionCursor(column, q.Asc))
+	return actions, next, nil
+}
+
 type snapshotStore struct {
 	*store
 }
@@ -199,3 +365,497 @@ func (s *snapshotStore) GetLastestSnapshot(ctx context.Context) (*Snapshot, erro
 	}
 	return &snapshot, nil
 }
+
+func (s *snapshotStore) ListSnapshots(ctx context.Context, limit int64, cursor *Cursor) ([]*Snapshot, *Cursor, error) {
+	value, err := cursor.value("created_at", false, parseIntKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	var snapshots []*Snapshot
+	if err := keyset(s.db.View(), "created_at", "snapshot_id", false, value, cursor.id()).Limit(pageLimit(limit)).Find(&snapshots).Error; err != nil {
+		return nil, nil, err
+	}
+	snapshots, next := pageOf(snapshots, limit, snapshotCursor)
+	return snapshots, next, nil
+}
+
+type payoutStore struct {
+	*store
+}
+
+func NewPayoutStore(db *store2.DB) PayoutStore {
+	return &payoutStore{&store{db: db}}
+}
+
+func (s *payoutStore) CreatePayout(ctx context.Context, payout *Payout) error {
+	return s.db.Update().Clauses(clause.OnConflict{DoNothing: true}).Create(payout).Error
+}
+
+func (s *payoutStore) GetPayout(ctx context.Context, requestId string) (*Payout, error) {
+	var payout Payout
+	if err := s.db.View().Where("request_id = ?", requestId).First(&payout).Error; err != nil {
+		return nil, err
+	}
+	return &payout, nil
+}
+
+func (s *payoutStore) ListUnfinishedPayouts(ctx context.Context, limit int) (payouts []*Payout, err error) {
+	err = s.db.View().
+		Where("status IN ?", []string{PayoutStatusPending, PayoutStatusSubmitted}).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&payouts).Error
+	return
+}
+
+func (s *payoutStore) UpdatePayout(ctx context.Context, payout *Payout) error {
+	return s.db.Update().Model(&Payout{}).
+		Where("request_id = ?", payout.RequestId).
+		Select("status", "attempts", "last_error", "updated_at").
+		Updates(payout).Error
+}
+
+func (s *payoutStore) CreateSnapshotPayout(ctx context.Context, payout *Payout) (*Payout, error) {
+	var result *Payout
+	err := s.db.Tx(func(tx *store2.DB) error {
+		var payouts []*Payout
+		if err := tx.Update().Where("snapshot_id = ?", payout.SnapshotId).Find(&payouts).Error; err != nil {
+			return err
+		}
+		existing, err := snapshotPayout(payouts, payout)
+		if existing != nil || err != nil {
+			result = existing
+			return err
+		}
+		if err := tx.Update().Create(payout).Error; err != nil {
+			return err
+		}
+		result = payout
+		return nil
+	})
+	return result, err
+}
+
+type syncStateStore struct {
+	*store
+}
+
+func NewSyncStateStore(db *store2.DB) SyncStateStore {
+	return &syncStateStore{&store{db: db}}
+}
+
+func (s *syncStateStore) GetSyncState(ctx context.Context, name string) (*SyncState, error) {
+	var state SyncState
+	if err := s.db.View().Where("name = ?", name).First(&state).Error; err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (s *syncStateStore) SaveSyncState(ctx context.Context, state *SyncState) error {
+	return s.db.Update().Save(state).Error
+}
+
+type donationStore struct {
+	*store
+}
+
+func NewDonationStore(db *store2.DB) DonationStore {
+	return &donationStore{&store{db: db}}
+}
+
+func (s *donationStore) RecordDonation(ctx context.Context, record *DonationRecord) (created bool, err error) {
+	err = s.db.Tx(func(tx *store2.DB) error {
+		ret := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(record.Snapshot)
+		if ret.Error != nil {
+			return ret.Error
+		}
+		// snapshot 已入账
+		if ret.RowsAffected == 0 {
+			return nil
+		}
+
+		if action := record.Action; action != nil {
+			if err := tx.Create(action).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&Project{}).Where("pid = ?", action.PID).Updates(map[string]interface{}{
+				"donate_cnt": gorm.Expr("donate_cnt + 1"),
+				"raised_usd": gorm.Expr("raised_usd + ?", action.AmountUSD),
+			}).Error; err != nil {
+				return err
+			}
+			if err := incrProjectAssetTotal(tx, action); err != nil {
+				return err
+			}
+		}
+
+		if payout := record.Payout; payout != nil {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(payout).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, delivery := range record.Deliveries {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(delivery).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := insertLedgerEntries(tx, record.ledgerEntries()); err != nil {
+			return err
+		}
+
+		created = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return created, nil
+}
+
+// incrProjectAssetTotal 累加项目在该资产上的捐赠统计, 不存在则创建
+func incrProjectAssetTotal(tx *store2.DB, action *DonateAction) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "pid"}, {Name: "asset_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"amount":     gorm.Expr("project_asset_totals.amount + ?", action.Amount),
+			"amount_usd": gorm.Expr("project_asset_totals.amount_usd + ?", action.AmountUSD),
+			"donate_cnt": gorm.Expr("project_asset_totals.donate_cnt + 1"),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&ProjectAssetTotal{
+		PID:       action.PID,
+		AssetID:   action.AssetID,
+		Amount:    action.Amount,
+		AmountUSD: action.AmountUSD,
+		DonateCnt: 1,
+	}).Error
+}
+
+type adminAuditStore struct {
+	*store
+}
+
+func NewAdminAuditStore(db *store2.DB) AdminAuditStore {
+	return &adminAuditStore{&store{db: db}}
+}
+
+func (s *adminAuditStore) AddAdminAudit(ctx context.Context, audit *AdminAudit) error {
+	return s.db.Update().Create(audit).Error
+}
+
+func (s *adminAuditStore) ListAdminAudits(ctx context.Context, limit int64, cursor *Cursor) ([]*AdminAudit, *Cursor, error) {
+	value, err := cursor.value("id", false, parseUintKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	var audits []*AdminAudit
+	if err := keyset(s.db.View(), "id", "id", false, value, nil).Limit(pageLimit(limit)).Find(&audits).Error; err != nil {
+		return nil, nil, err
+	}
+	audits, next := pageOf(audits, limit, adminAuditCursor)
+	return audits, next, nil
+}
+
+type webhookStore struct {
+	*store
+}
+
+func NewWebhookStore(db *store2.DB) WebhookStore {
+	return &webhookStore{&store{db: db}}
+}
+
+func (s *webhookStore) AddWebhook(ctx context.Context, webhook *Webhook) error {
+	return s.db.Update().Create(webhook).Error
+}
+
+func (s *webhookStore) GetWebhook(ctx context.Context, id string) (*Webhook, error) {
+	var webhook Webhook
+	if err := s.db.View().Where("id = ?", id).First(&webhook).Error; err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (s *webhookStore) ListWebhooksByPID(ctx context.Context, pid string) (webhooks []*Webhook, err error) {
+	err = s.db.View().Where("pid = ?", pid).Order("created_at ASC").Find(&webhooks).Error
+	return
+}
+
+func (s *webhookStore) UpdateWebhook(ctx context.Context, webhook *Webhook) error {
+	return s.db.Update().Model(&Webhook{}).
+		Where("id = ?", webhook.ID).
+		Select("url", "secret", "previous_secret", "rotated_at", "disabled", "updated_at").
+		Updates(webhook).Error
+}
+
+func (s *webhookStore) DeleteWebhook(ctx context.Context, id string) error {
+	return s.db.Tx(func(tx *store2.DB) error {
+		if err := tx.Where("webhook_id = ?", id).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&Webhook{}).Error
+	})
+}
+
+func (s *webhookStore) CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	return s.db.Update().Clauses(clause.OnConflict{DoNothing: true}).Create(delivery).Error
+}
+
+func (s *webhookStore) GetWebhookDelivery(ctx context.Context, id string) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	if err := s.db.View().Where("id = ?", id).First(&delivery).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (s *webhookStore) ListDueWebhookDeliveries(ctx context.Context, now int64, limit int) (deliveries []*WebhookDelivery, err error) {
+	err = s.db.View().
+		Where("status = ? AND next_attempt_at <= ?", WebhookDeliveryPending, now).
+		Order("next_attempt_at ASC").
+		Limit(limit).
+		Find(&deliveries).Error
+	return
+}
+
+func (s *webhookStore) UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	return s.db.Update().Model(&WebhookDelivery{}).
+		Where("id = ?", delivery.ID).
+		Select("status", "attempts", "next_attempt_at", "response_status", "response_body", "last_error", "delivered_at", "updated_at").
+		Updates(delivery).Error
+}
+
+func (s *webhookStore) ListWebhookDeliveries(ctx context.Context, webhookID string, limit int64, cursor *Cursor) ([]*WebhookDelivery, *Cursor, error) {
+	value, err := cursor.value("created_at", false, parseIntKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	var deliveries []*WebhookDelivery
+	tx := s.db.View().Where("webhook_id = ?", webhookID)
+	if err := keyset(tx, "created_at", "id", false, value, cursor.id()).Limit(pageLimit(limit)).Find(&deliveries).Error; err != nil {
+		return nil, nil, err
+	}
+	deliveries, next := pageOf(deliveries, limit, webhookDeliveryCursor)
+	return deliveries, next, nil
+}
+
+type reconciliationStore struct {
+	*store
+}
+
+func NewReconciliationStore(db *store2.DB) ReconciliationStore {
+	return &reconciliationStore{&store{db: db}}
+}
+
+// assetSum 按资产汇总的金额
+type assetSum struct {
+	AssetID string          `gorm:"column:asset_id" bson:"_id"`
+	Amount  decimal.Decimal `gorm:"column:amount" bson:"amount"`
+}
+
+// mergeAssetLedgers 合并各项汇总, 按资产排序
+// sqlite 的 SUM 以浮点计算, 统一保留到列的精度
+func mergeAssetLedgers(received, paid, pending []*assetSum) []*AssetLedger {
+	ledgers := map[string]*AssetLedger{}
+	get := func(assetID string) *AssetLedger {
+		if ledgers[assetID] == nil {
+			ledgers[assetID] = &AssetLedger{AssetID: assetID}
+		}
+		return ledgers[assetID]
+	}
+	for _, item := range received {
+		get(item.AssetID).Received = item.Amount.Round(8)
+	}
+	for _, item := range paid {
+		get(item.AssetID).Paid = item.Amount.Round(8)
+	}
+	for _, item := range pending {
+		get(item.AssetID).Pending = item.Amount.Round(8)
+	}
+	items := lo.Values(ledgers)
+	sort.Slice(items, func(i, j int) bool { return items[i].AssetID < items[j].AssetID })
+	return items
+}
+
+func (s *reconciliationStore) ListAssetLedgers(ctx context.Context) ([]*AssetLedger, error) {
+	var received, paid, pending []*assetSum
+	sum := func(tx *gorm.DB, rows *[]*assetSum) error {
+		return tx.Select("asset_id, SUM(amount) AS amount").Group("asset_id").Scan(rows).Error
+	}
+	if err := sum(s.db.View().Model(&Snapshot{}), &received); err != nil {
+		return nil, err
+	}
+	if err := sum(s.db.View().Model(&Payout{}).Where("status = ?", PayoutStatusConfirmed), &paid); err != nil {
+		return nil, err
+	}
+	unfinished := []string{PayoutStatusPending, PayoutStatusSubmitted}
+	if err := sum(s.db.View().Model(&Payout{}).Where("status IN ?", unfinished), &pending); err != nil {
+		return nil, err
+	}
+	return mergeAssetLedgers(received, paid, pending), nil
+}
+
+func (s *reconciliationStore) AddReconciliations(ctx context.Context, items []*Reconciliation) error {
+	if len(items) == 0 {
+		return nil
+	}
+	return s.db.Update().Create(items).Error
+}
+
+func (s *reconciliationStore) GetLatestReconciliations(ctx context.Context) ([]*Reconciliation, error) {
+	var latest Reconciliation
+	err := s.db.View().Order("id DESC").First(&latest).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var items []*Reconciliation
+	err = s.db.View().Where("run_id = ?", latest.RunID).Order("asset_id ASC").Find(&items).Error
+	return items, err
+}
+
+func (s *reconciliationStore) ListReconciliations(ctx context.Context, assetID string, limit int64, cursor *Cursor) ([]*Reconciliation, *Cursor, error) {
+	value, err := cursor.value("id", false, parseUintKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx := s.db.View()
+	if assetID != "" {
+		tx = tx.Where("asset_id = ?", assetID)
+	}
+	var items []*Reconciliation
+	if err := keyset(tx, "id", "id", false, value, nil).Limit(pageLimit(limit)).Find(&items).Error; err != nil {
+		return nil, nil, err
+	}
+	items, next := pageOf(items, limit, reconciliationCursor)
+	return items, next, nil
+}
+
+type ledgerStore struct {
+	*store
+}
+
+func NewLedgerStore(db *store2.DB) LedgerStore {
+	return &ledgerStore{&store{db: db}}
+}
+
+// insertLedgerEntries 检查每笔交易是否平衡, 跳过已存在的交易
+func insertLedgerEntries(tx *store2.DB, entries []*LedgerEntry) error {
+	txs, err := groupLedgerTxs(entries)
+	if err != nil {
+		return err
+	}
+	for _, items := range txs {
+		var count int64
+		if err := tx.Model(&LedgerEntry{}).Where("tx_id = ?", items[0].TxID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := tx.Create(items).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ledgerStore) PostLedgerEntries(ctx context.Context, entries []*LedgerEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return s.db.Tx(func(tx *store2.DB) error {
+		return insertLedgerEntries(tx, entries)
+	})
+}
+
+func (s *ledgerStore) ListLedgerBalances(ctx context.Context, account string, at int64) ([]*LedgerBalance, error) {
+	tx := s.db.View().Model(&LedgerEntry{})
+	if account != "" {
+		tx = tx.Where("account = ?", account)
+	}
+	if at > 0 {
+		tx = tx.Where("created_at <= ?", at)
+	}
+	var sums []*ledgerSum
+	if err := tx.Select("account, asset_id, SUM(amount) AS amount").
+		Group("account, asset_id").
+		Order("account ASC, asset_id ASC").
+		Scan(&sums).Error; err != nil {
+		return nil, err
+	}
+	return ledgerBalances(sums), nil
+}
+
+func (s *ledgerStore) ListLedgerImbalances(ctx context.Context, at int64) ([]*LedgerBalance, error) {
+	tx := s.db.View().Model(&LedgerEntry{})
+	if at > 0 {
+		tx = tx.Where("created_at <= ?", at)
+	}
+	var sums []*ledgerSum
+	if err := tx.Select("asset_id, SUM(amount) AS amount").
+		Group("asset_id").
+		Order("asset_id ASC").
+		Scan(&sums).Error; err != nil {
+		return nil, err
+	}
+	return ledgerBalances(sums), nil
+}
+
+type consolidationStore struct {
+	*store
+}
+
+func NewConsolidationStore(db *store2.DB) ConsolidationStore {
+	return &consolidationStore{&store{db: db}}
+}
+
+func (s *consolidationStore) CreateConsolidation(ctx context.Context, consolidation *Consolidation) error {
+	return s.db.Update().Clauses(clause.OnConflict{DoNothing: true}).Create(consolidation).Error
+}
+
+func (s *consolidationStore) GetConsolidation(ctx context.Context, requestId string) (*Consolidation, error) {
+	var consolidation Consolidation
+	if err := s.db.View().Where("request_id = ?", requestId).First(&consolidation).Error; err != nil {
+		return nil, err
+	}
+	return &consolidation, nil
+}
+
+func (s *consolidationStore) ListUnfinishedConsolidations(ctx context.Context, limit int) (consolidations []*Consolidation, err error) {
+	err = s.db.View().
+		Where("status IN ?", []string{ConsolidationStatusPending, ConsolidationStatusSubmitted}).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&consolidations).Error
+	return
+}
+
+func (s *consolidationStore) UpdateConsolidation(ctx context.Context, consolidation *Consolidation) error {
+	return s.db.Update().Model(&Consolidation{}).
+		Where("request_id = ?", consolidation.RequestId).
+		Select("status", "attempts", "last_error", "updated_at").
+		Updates(consolidation).Error
+}
+
+func (s *consolidationStore) ListConsolidations(ctx context.Context, assetID string, limit int64, cursor *Cursor) ([]*Consolidation, *Cursor, error) {
+	value, err := cursor.value("created_at", false, parseIntKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx := s.db.View()
+	if assetID != "" {
+		tx = tx.Where("asset_id = ?", assetID)
+	}
+	var consolidations []*Consolidation
+	if err := keyset(tx, "created_at", "request_id", false, value, cursor.id()).Limit(pageLimit(limit)).Find(&consolidations).Error; err != nil {
+		return nil, nil, err
+	}
+	consolidations, next := pageOf(consolidations, limit, consolidationCursor)
+	return consolidations, next, nil
+}
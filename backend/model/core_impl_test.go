@@ -0,0 +1,828 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fox-one/pkg/db"
+	"github.com/fox-one/pkg/store2"
+	"github.com/samber/lo"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+)
+
+// mysql, postgres 和 mongo 的测试库通过环境变量提供, 未设置时跳过
+// 本地可以用 docker-compose.test.yml 启动:
+//
+//	DONATE_TEST_MYSQL_DSN="root:donate@tcp(127.0.0.1:13306)/donate_test?parseTime=True&charset=utf8mb4&loc=UTC"
+//	DONATE_TEST_POSTGRES_DSN="host=127.0.0.1 port=15432 user=postgres password=donate dbname=donate_test sslmode=disable"
+//	DONATE_TEST_MONGO_URI="mongodb://127.0.0.1:27018/?replicaSet=rs0&directConnection=true"
+var testDialects = []struct {
+	dialect string
+	dsnEnv  string
+}{
+	{dialect: "sqlite3"},
+	{dialect: "mysql", dsnEnv: "DONATE_TEST_MYSQL_DSN"},
+	{dialect: "postgres", dsnEnv: "DONATE_TEST_POSTGRES_DSN"},
+}
+
+// 每个用例开始前清空的表
+var testTables = []interface{}{
+	&User{}, &Project{}, &ProjectAlias{}, &ProjectAssetTotal{}, &DonateAction{},
+	&Asset{}, &Snapshot{}, &Payout{}, &SyncState{}, &AdminAudit{}, &Webhook{}, &WebhookDelivery{},
+	&Reconciliation{}, &LedgerEntry{}, &Consolidation{},
+	&SchemaVersion{},
+}
+
+// forEachDB 在每种数据库的空库上运行 fn
+func forEachDB(t *testing.T, fn func(t *testing.T, conn *store2.DB)) {
+	for _, d := range testDialects {
+		t.Run(d.dialect, func(t *testing.T) {
+			fn(t, newTestDB(t, d.dialect, d.dsnEnv))
+		})
+	}
+}
+
+// forEachStore 在每种数据库迁移到最新版本后, 以及 mongo 上运行同一组用例
+func forEachStore(t *testing.T, fn func(t *testing.T, s Store)) {
+	forEachDB(t, func(t *testing.T, conn *store2.DB) {
+		require.NoError(t, store2.Migrate(conn))
+		fn(t, NewStore(conn))
+	})
+	t.Run("mongo", func(t *testing.T) {
+		fn(t, newTestMongoStore(t))
+	})
+}
+
+// newTestMongoStore 使用 DONATE_TEST_MONGO_URI 上的空库, 事务需要副本集
+func newTestMongoStore(t *testing.T) Store {
+	uri := os.Getenv("DONATE_TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("DONATE_TEST_MONGO_URI not set")
+	}
+
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetRegistry(MongoRegistry()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Disconnect(ctx) })
+
+	db := client.Database("donate_test")
+	require.NoError(t, db.Drop(ctx))
+	require.NoError(t, EnsureMongoIndexes(ctx, db))
+	return NewMongoStore(db)
+}
+
+func newTestDB(t *testing.T, dialect, dsnEnv string) *store2.DB {
+	var (
+		conn *store2.DB
+		err  error
+	)
+	if dsnEnv == "" {
+		conn, err = store2.Open(db.SqliteInMemory(), nil)
+		require.NoError(t, err)
+
+		// 内存数据库每个连接都是独立的库, 限制为单连接
+		sqlDB, err := conn.DB.DB()
+		require.NoError(t, err)
+		sqlDB.SetMaxOpenConns(1)
+	} else {
+		dsn := os.Getenv(dsnEnv)
+		if dsn == "" {
+			t.Skipf("%s not set", dsnEnv)
+		}
+		conn, err = store2.Connect(dialect, dsn, nil)
+		require.NoError(t, err)
+
+		require.NoError(t, conn.Migrator().DropTable(testTables...))
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestCreatePayoutIdempotent(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		payout := &Payout{
+			RequestId:  "8f4b1a30-7c8d-3e9f-8a1b-2c3d4e5f6a7b",
+			SnapshotId: "snapshot-1",
+			Kind:       PayoutKindForward,
+			AssetId:    "965e5c6e-434c-3fa9-b780-c50f43cd955c",
+			Amount:     decimal.NewFromInt(1),
+			Member:     "member",
+			Status:     PayoutStatusPending,
+		}
+		require.NoError(t, s.CreatePayout(ctx, payout))
+
+		payout.Status = PayoutStatusConfirmed
+		require.NoError(t, s.UpdatePayout(ctx, payout))
+
+		// 重复写入不会覆盖已有状态
+		require.NoError(t, s.CreatePayout(ctx, &Payout{
+			RequestId: payout.RequestId,
+			Status:    PayoutStatusPending,
+		}))
+
+		got, err := s.GetPayout(ctx, payout.RequestId)
+		require.NoError(t, err)
+		assert.Equal(t, PayoutStatusConfirmed, got.Status)
+
+		unfinished, err := s.ListUnfinishedPayouts(ctx, 10)
+		require.NoError(t, err)
+		assert.Empty(t, unfinished)
+	})
+}
+
+func TestRecordDonationIdempotent(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		require.NoError(t, s.AddProject(ctx, &Project{PID: "4e3f6c2a-1b2d-3c4e-8f5a-6b7c8d9e0f1a", Title: "project"}))
+
+		record := &DonationRecord{
+			Snapshot: &Snapshot{SnapshotId: "snapshot-1", Amount: decimal.NewFromInt(1)},
+			Action: &DonateAction{
+				ID:        "a1b2c3d4-e5f6-3a7b-8c9d-0e1f2a3b4c5d",
+				PID:       "4e3f6c2a-1b2d-3c4e-8f5a-6b7c8d9e0f1a",
+				AssetID:   "965e5c6e-434c-3fa9-b780-c50f43cd955c",
+				Amount:    decimal.NewFromInt(1),
+				AmountUSD: decimal.NewFromInt(60000),
+			},
+			Payout: &Payout{RequestId: "b2c3d4e5-f6a7-3b8c-9d0e-1f2a3b4c5d6e", Status: PayoutStatusPending},
+		}
+
+		created, err := s.RecordDonation(ctx, record)
+		require.NoError(t, err)
+		assert.True(t, created)
+
+		// 重放同一个 snapshot 不产生任何修改
+		created, err = s.RecordDonation(ctx, record)
+		require.NoError(t, err)
+		assert.False(t, created)
+
+		// 同一资产的第二笔捐赠累加到统计中
+		created, err = s.RecordDonation(ctx, &DonationRecord{
+			Snapshot: &Snapshot{SnapshotId: "snapshot-2", Amount: decimal.NewFromInt(2)},
+			Action: &DonateAction{
+				ID:        "c3d4e5f6-a7b8-3c9d-8e1f-2a3b4c5d6e7f",
+				PID:       "4e3f6c2a-1b2d-3c4e-8f5a-6b7c8d9e0f1a",
+				AssetID:   "965e5c6e-434c-3fa9-b780-c50f43cd955c",
+				Amount:    decimal.NewFromInt(2),
+				AmountUSD: decimal.NewFromInt(120000),
+			},
+		})
+		require.NoError(t, err)
+		assert.True(t, created)
+
+		project, err := s.GetProject(ctx, "4e3f6c2a-1b2d-3c4e-8f5a-6b7c8d9e0f1a")
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, project.DonateCnt)
+		assert.True(t, project.RaisedUSD.Equal(decimal.NewFromInt(180000)))
+
+		totals, err := s.ListProjectAssetTotals(ctx, "4e3f6c2a-1b2d-3c4e-8f5a-6b7c8d9e0f1a")
+		require.NoError(t, err)
+		require.Len(t, totals, 1)
+		assert.True(t, totals[0].Amount.Equal(decimal.NewFromInt(3)))
+		assert.EqualValues(t, 2, totals[0].DonateCnt)
+
+		actions, err := s.QueryDonateActionsByPID(ctx, "4e3f6c2a-1b2d-3c4e-8f5a-6b7c8d9e0f1a")
+		require.NoError(t, err)
+		assert.Len(t, actions, 2)
+
+		// 已有捐赠的项目不能删除
+		assert.ErrorIs(t, s.DeleteProject(ctx, "4e3f6c2a-1b2d-3c4e-8f5a-6b7c8d9e0f1a"), ErrProjectHasDonations)
+		_, err = s.GetProject(ctx, "4e3f6c2a-1b2d-3c4e-8f5a-6b7c8d9e0f1a")
+		require.NoError(t, err)
+	})
+}
+
+func TestProjectAliasAndArchive(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		pid := "5f4e3d2c-1b0a-4c9d-8e7f-6a5b4c3d2e1f"
+		require.NoError(t, s.AddProject(ctx, &Project{PID: pid, Title: "project"}, "alias-1"))
+		require.NoError(t, s.AddProjectAlias(ctx, pid, "alias-2"))
+		// 重复登记别名被忽略
+		require.NoError(t, s.AddProjectAlias(ctx, pid, "alias-2"))
+
+		for _, alias := range []string{"alias-1", "alias-2"} {
+			project, err := s.GetProjectByAlias(ctx, alias)
+			require.NoError(t, err)
+			assert.Equal(t, pid, project.PID)
+		}
+
+		projects, _, err := s.ListProjects(ctx, &ProjectQuery{Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, projects, 1)
+
+		require.NoError(t, s.ArchiveProject(ctx, pid, time.Now()))
+		projects, _, err = s.ListProjects(ctx, &ProjectQuery{Limit: 10})
+		require.NoError(t, err)
+		assert.Empty(t, projects)
+
+		// 归档的项目仍可通过 pid 和别名访问
+		project, err := s.GetProjectByAlias(ctx, "alias-1")
+		require.NoError(t, err)
+		assert.NotNil(t, project.ArchivedAt)
+
+		require.NoError(t, s.DeleteProject(ctx, pid))
+		_, err = s.GetProjectByAlias(ctx, "alias-1")
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+}
+
+func TestUpdateUserLanguage(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		require.NoError(t, s.AddUser(ctx, &User{MixinUID: "user-1", IdentityNumber: "1001", FullName: "user"}))
+		require.NoError(t, s.UpdateUserBymuid(ctx, "user-1", &User{Language: "zh"}))
+		// 只更新非零值字段, 不会清空已保存的语言
+		require.NoError(t, s.UpdateUserBymuid(ctx, "user-1", &User{FullName: "renamed"}))
+
+		user, err := s.GetUserByUID(ctx, "user-1")
+		require.NoError(t, err)
+		assert.Equal(t, "zh", user.Language)
+		assert.Equal(t, "renamed", user.FullName)
+	})
+}
+
+func TestBatchQueries(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		require.NoError(t, s.AddUser(ctx, &User{MixinUID: "user-1", IdentityNumber: "1001"}))
+		require.NoError(t, s.AddUser(ctx, &User{MixinUID: "user-2", IdentityNumber: "1002"}))
+		require.NoError(t, s.AddProject(ctx, &Project{PID: "project-1", Title: "project 1"}))
+		require.NoError(t, s.AddProject(ctx, &Project{PID: "project-2", Title: "project 2"}))
+		for i, pid := range []string{"project-1", "project-1", "project-2"} {
+			_, err := s.RecordDonation(ctx, &DonationRecord{
+				Snapshot: &Snapshot{SnapshotId: fmt.Sprintf("snapshot-%d", i)},
+				Action: &DonateAction{
+					ID:        fmt.Sprintf("action-%d", i),
+					PID:       pid,
+					AssetID:   fmt.Sprintf("asset-%d", i),
+					Amount:    decimal.NewFromInt(1),
+					AmountUSD: decimal.NewFromInt(int64(i + 1)),
+				},
+			})
+			require.NoError(t, err)
+		}
+
+		// 超过一批的参数, 重复和不存在的值
+		idents := []string{"1001", "1001", "1002"}
+		for i := 0; i < inBatchSize; i++ {
+			idents = append(idents, fmt.Sprintf("missing-%d", i))
+		}
+		users, err := s.ListUsersByIdentityNumbers(ctx, idents)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"user-1", "user-2"}, lo.Map(users, func(u *User, _ int) string { return u.MixinUID }))
+
+		users, err = s.ListUsersByIdentityNumbers(ctx, nil)
+		require.NoError(t, err)
+		assert.Empty(t, users)
+
+		projects, err := s.ListProjectsByPIDs(ctx, []string{"project-2", "project-1", "project-3"})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"project-1", "project-2"}, lo.Map(projects, func(p *Project, _ int) string { return p.PID }))
+
+		totals, err := s.ListProjectAssetTotalsByPIDs(ctx, []string{"project-1", "project-2"})
+		require.NoError(t, err)
+		require.Len(t, totals, 3)
+		byPID := lo.GroupBy(totals, func(t *ProjectAssetTotal) string { return t.PID })
+		require.Len(t, byPID["project-1"], 2)
+		assert.Equal(t, "asset-1", byPID["project-1"][0].AssetID)
+		assert.Equal(t, "asset-2", byPID["project-2"][0].AssetID)
+	})
+}
+
+// collectPages 以 limit 逐页读取, 返回所有记录的 id 和页数, limit 为 0 时只有一页
+func collectPages(t *testing.T, limit int64, page func(cursor *Cursor) ([]string, *Cursor, error)) ([]string, int) {
+	var (
+		ids    []string
+		cursor *Cursor
+		pages  int
+	)
+	for {
+		items, next, err := page(cursor)
+		require.NoError(t, err)
+		if limit > 0 {
+			require.LessOrEqual(t, int64(len(items)), limit)
+		}
+		ids = append(ids, items...)
+		pages++
+		if next == nil {
+			return ids, pages
+		}
+		// cursor 经过编码后传回
+		cursor, err = ParseCursor(next.String())
+		require.NoError(t, err)
+		require.Less(t, pages, 10)
+	}
+}
+
+func TestQueryDonateActions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i, item := range []struct {
+			pid, ident, asset string
+			amount, usd       int64
+			anonymous         bool
+		}{
+			{"p1", "1001", "a", 1, 10, false},
+			{"p1", "1002", "a", 2, 40, false},
+			{"p1", "1001", "b", 2, 20, true},
+			{"p1", "1002", "a", 3, 30, false},
+			{"p1", "1001", "a", 5, 50, false},
+			{"p2", "1001", "a", 4, 60, false},
+		} {
+			require.NoError(t, s.AddDonateAction(ctx, &DonateAction{
+				ID:             fmt.Sprintf("action-%d", i+1),
+				PID:            item.pid,
+				IdentityNumber: item.ident,
+				AssetID:        item.asset,
+				Amount:         decimal.NewFromInt(item.amount),
+				AmountUSD:      decimal.NewFromInt(item.usd),
+				Anonymous:      item.anonymous,
+				CreatedAt:      base.Add(time.Duration(i) * time.Hour),
+			}))
+		}
+
+		query := func(q DonateActionQuery) ([]string, int) {
+			return collectPages(t, q.Limit, func(cursor *Cursor) ([]string, *Cursor, error) {
+				q.Cursor = cursor
+				actions, next, err := s.QueryDonateActions(ctx, &q)
+				return lo.Map(actions, func(a *DonateAction, _ int) string { return a.ID }), next, err
+			})
+		}
+
+		ids, pages := query(DonateActionQuery{PID: "p1", Limit: 2})
+		assert.Equal(t, []string{"action-5", "action-4", "action-3", "action-2", "action-1"}, ids)
+		assert.Equal(t, 3, pages)
+		// 刚好整页时没有下一页
+		_, pages = query(DonateActionQuery{PID: "p1", Limit: 5})
+		assert.Equal(t, 1, pages)
+
+		// 金额相同时按 id 排序
+		ids, _ = query(DonateActionQuery{PID: "p1", OrderBy: DonateActionOrderByAmount, Limit: 2})
+		assert.Equal(t, []string{"action-5", "action-4", "action-3", "action-2", "action-1"}, ids)
+		ids, _ = query(DonateActionQuery{PID: "p1", OrderBy: DonateActionOrderByAmount, Asc: true, Limit: 2})
+		assert.Equal(t, []string{"action-1", "action-2", "action-3", "action-4", "action-5"}, ids)
+		ids, _ = query(DonateActionQuery{OrderBy: DonateActionOrderByAmountUSD, Limit: 4})
+		assert.Equal(t, []string{"action-6", "action-5", "action-2", "action-4", "action-3", "action-1"}, ids)
+
+		ids, _ = query(DonateActionQuery{
+			IdentityNumber:   "1001",
+			AssetID:          "a",
+			Since:            base.Add(time.Hour),
+			Until:            base.Add(5 * time.Hour),
+			MinAmount:        decimal.NewFromInt(2),
+			ExcludeAnonymous: true,
+			Limit:            1,
+		})
+		assert.Equal(t, []string{"action-5"}, ids)
+		ids, _ = query(DonateActionQuery{IdentityNumber: "1001", ExcludeAnonymous: true})
+		assert.Equal(t, []string{"action-6", "action-5", "action-1"}, ids)
+
+		// cursor 与查询的排序不一致
+		_, next, err := s.QueryDonateActions(ctx, &DonateActionQuery{Limit: 1})
+		require.NoError(t, err)
+		require.NotNil(t, next)
+		_, _, err = s.QueryDonateActions(ctx, &DonateActionQuery{OrderBy: DonateActionOrderByAmount, Limit: 1, Cursor: next})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+		_, _, err = s.QueryDonateActions(ctx, &DonateActionQuery{Asc: true, Limit: 1, Cursor: next})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+}
+
+func TestListPages(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		for i, cnt := range []int64{3, 1, 3, 2} {
+			pid := fmt.Sprintf("project-%d", i+1)
+			require.NoError(t, s.AddProject(ctx, &Project{PID: pid, IdentityNumber: "1001"}))
+			for j := int64(0); j < cnt; j++ {
+				require.NoError(t, s.IncrProjectDonateCnt(ctx, pid))
+			}
+			// 时间相同的 snapshot 按 id 排序
+			require.NoError(t, s.InsertSnapshot(ctx, &Snapshot{SnapshotId: fmt.Sprintf("snapshot-%d", i+1), CreatedAt: int64(i/2) + 1}))
+			require.NoError(t, s.AddAdminAudit(ctx, &AdminAudit{Action: fmt.Sprintf("audit-%d", i+1), CreatedAt: int64(i)}))
+		}
+
+		pids, pages := collectPages(t, 3, func(cursor *Cursor) ([]string, *Cursor, error) {
+			projects, next, err := s.ListProjects(ctx, &ProjectQuery{IdentityNumber: "1001", Limit: 3, Cursor: cursor})
+			return lo.Map(projects, func(p *Project, _ int) string { return p.PID }), next, err
+		})
+		assert.Equal(t, []string{"project-3", "project-1", "project-4", "project-2"}, pids)
+		assert.Equal(t, 2, pages)
+		// 兼容 offset 分页
+		projects, _, err := s.ListProjects(ctx, &ProjectQuery{Limit: 2, Offset: 2})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"project-4", "project-2"}, lo.Map(projects, func(p *Project, _ int) string { return p.PID }))
+		_, _, err = s.ListProjects(ctx, &ProjectQuery{OrderBy: ProjectOrderByRaisedUSD, Cursor: &Cursor{Sort: "donate_cnt", Key: "1"}})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+
+		ids, _ := collectPages(t, 3, func(cursor *Cursor) ([]string, *Cursor, error) {
+			snapshots, next, err := s.ListSnapshots(ctx, 3, cursor)
+			return lo.Map(snapshots, func(s *Snapshot, _ int) string { return s.SnapshotId }), next, err
+		})
+		assert.Equal(t, []string{"snapshot-4", "snapshot-3", "snapshot-2", "snapshot-1"}, ids)
+
+		actions, _ := collectPages(t, 1, func(cursor *Cursor) ([]string, *Cursor, error) {
+			audits, next, err := s.ListAdminAudits(ctx, 1, cursor)
+			return lo.Map(audits, func(a *AdminAudit, _ int) string { return a.Action }), next, err
+		})
+		assert.Equal(t, []string{"audit-4", "audit-3", "audit-2", "audit-1"}, actions)
+		_, _, err = s.ListAdminAudits(ctx, 1, &Cursor{Sort: "id", Key: "not a number"})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+}
+
+func TestListProjectsHidesModerated(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		require.NoError(t, s.AddUser(ctx, &User{MixinUID: "owner-1", IdentityNumber: "1001"}))
+		require.NoError(t, s.AddUser(ctx, &User{MixinUID: "owner-2", IdentityNumber: "1002"}))
+		require.NoError(t, s.AddProject(ctx, &Project{PID: "project-1", MixinUID: "owner-1", IdentityNumber: "1001"}))
+		require.NoError(t, s.AddProject(ctx, &Project{PID: "project-2", MixinUID: "owner-1", IdentityNumber: "1001"}))
+		require.NoError(t, s.AddProject(ctx, &Project{PID: "project-3", MixinUID: "owner-2", IdentityNumber: "1002"}))
+
+		now := time.Now()
+		require.NoError(t, s.UpdateProjectModeration(ctx, "project-1", &now, nil))
+		require.NoError(t, s.UpdateUserBanned(ctx, "owner-2", &now))
+
+		projects, _, err := s.ListProjects(ctx, &ProjectQuery{Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, projects, 1)
+		assert.Equal(t, "project-2", projects[0].PID)
+
+		// 解除后重新公开
+		require.NoError(t, s.UpdateProjectModeration(ctx, "project-1", nil, nil))
+		require.NoError(t, s.UpdateUserBanned(ctx, "owner-2", nil))
+		projects, _, err = s.ListProjects(ctx, &ProjectQuery{Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, projects, 3)
+	})
+}
+
+func TestModelTypesAcrossDialects(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		pid := "7a8b9c0d-1e2f-4a3b-8c4d-5e6f7a8b9c0d"
+		require.NoError(t, s.AddProject(ctx, &Project{PID: pid, Title: "project"}))
+
+		// 保留 8 位小数, created_at 由存储层写入
+		amount := decimal.RequireFromString("1234567.12345678")
+		_, err := s.RecordDonation(ctx, &DonationRecord{
+			Snapshot: &Snapshot{SnapshotId: "d4e5f6a7-b8c9-4d0e-9f1a-2b3c4d5e6f7a", Amount: amount, CreatedAt: time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC).Unix()},
+			Action: &DonateAction{
+				ID:        "e5f6a7b8-c9d0-4e1f-8a2b-3c4d5e6f7a8b",
+				PID:       pid,
+				AssetID:   "965e5c6e-434c-3fa9-b780-c50f43cd955c",
+				Amount:    amount,
+				AmountUSD: amount,
+			},
+		})
+		require.NoError(t, err)
+
+		actions, err := s.QueryDonateActionsByPID(ctx, pid)
+		require.NoError(t, err)
+		require.Len(t, actions, 1)
+		assert.True(t, actions[0].Amount.Equal(amount), actions[0].Amount.String())
+		assert.False(t, actions[0].CreatedAt.IsZero())
+
+		project, err := s.GetProject(ctx, pid)
+		require.NoError(t, err)
+		assert.True(t, project.RaisedUSD.Equal(amount), project.RaisedUSD.String())
+		assert.False(t, project.CreatedAt.IsZero())
+
+		// 超出 int32 的时间戳
+		snapshot, err := s.GetSnapshotById(ctx, "d4e5f6a7-b8c9-4d0e-9f1a-2b3c4d5e6f7a")
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC).Unix(), snapshot.CreatedAt)
+	})
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		pid := "4e3f6c2a-1b2d-3c4e-8f5a-6b7c8d9e0f1a"
+		require.NoError(t, s.AddProject(ctx, &Project{PID: pid, Title: "project"}))
+		webhook := &Webhook{ID: "d4e5f6a7-b8c9-3d0e-8f1a-2b3c4d5e6f7a", PID: pid, URL: "https://example.com/hook", Secret: "secret"}
+		require.NoError(t, s.AddWebhook(ctx, webhook))
+
+		webhooks, err := s.ListWebhooksByPID(ctx, pid)
+		require.NoError(t, err)
+		require.Len(t, webhooks, 1)
+		assert.Equal(t, "secret", webhooks[0].Secret)
+
+		webhook.PreviousSecret, webhook.Secret, webhook.RotatedAt = webhook.Secret, "rotated", 100
+		require.NoError(t, s.UpdateWebhook(ctx, webhook))
+		webhook, err = s.GetWebhook(ctx, webhook.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "rotated", webhook.Secret)
+		assert.Equal(t, "secret", webhook.PreviousSecret)
+
+		// 投递随捐赠写入, 重复的 snapshot 不会重复投递
+		delivery := &WebhookDelivery{
+			ID:            "e5f6a7b8-c9d0-3e1f-8a2b-3c4d5e6f7a8b",
+			WebhookID:     webhook.ID,
+			PID:           pid,
+			Event:         WebhookEventDonation,
+			Payload:       `{"id":"1"}`,
+			Status:        WebhookDeliveryPending,
+			NextAttemptAt: 100,
+		}
+		record := &DonationRecord{
+			Snapshot:   &Snapshot{SnapshotId: "snapshot-1", Amount: decimal.NewFromInt(1)},
+			Deliveries: []*WebhookDelivery{delivery},
+		}
+		_, err = s.RecordDonation(ctx, record)
+		require.NoError(t, err)
+		require.NoError(t, s.CreateWebhookDelivery(ctx, delivery))
+
+		due, err := s.ListDueWebhookDeliveries(ctx, 99, 10)
+		require.NoError(t, err)
+		assert.Empty(t, due)
+		due, err = s.ListDueWebhookDeliveries(ctx, 100, 10)
+		require.NoError(t, err)
+		require.Len(t, due, 1)
+
+		due[0].Status = WebhookDeliverySucceeded
+		due[0].Attempts = 1
+		due[0].ResponseStatus = 204
+		require.NoError(t, s.UpdateWebhookDelivery(ctx, due[0]))
+		due, err = s.ListDueWebhookDeliveries(ctx, 100, 10)
+		require.NoError(t, err)
+		assert.Empty(t, due)
+
+		deliveries, _, err := s.ListWebhookDeliveries(ctx, webhook.ID, 10, nil)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, WebhookDeliverySucceeded, deliveries[0].Status)
+		assert.Equal(t, 204, deliveries[0].ResponseStatus)
+
+		// 删除 webhook 同时删除投递记录
+		require.NoError(t, s.DeleteWebhook(ctx, webhook.ID))
+		_, err = s.GetWebhook(ctx, webhook.ID)
+		assert.Equal(t, gorm.ErrRecordNotFound, err)
+		_, err = s.GetWebhookDelivery(ctx, delivery.ID)
+		assert.Equal(t, gorm.ErrRecordNotFound, err)
+	})
+}
+
+func TestReconciliations(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		const (
+			usdt = "4d8c508b-91c5-375b-92b0-ee702ed2dac5"
+			btc  = "c6d0c728-2624-429b-8e0d-d9d19b6592fa"
+		)
+
+		latest, err := s.GetLatestReconciliations(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, latest)
+
+		for i, item := range []struct {
+			asset  string
+			amount string
+		}{
+			{usdt, "1.1"}, {usdt, "2.2"}, {btc, "0.001"},
+		} {
+			_, err := s.RecordDonation(ctx, &DonationRecord{Snapshot: &Snapshot{
+				SnapshotId: fmt.Sprintf("snapshot-%d", i),
+				AssetId:    item.asset,
+				Amount:     decimal.RequireFromString(item.amount),
+				CreatedAt:  int64(i) + 1,
+			}})
+			require.NoError(t, err)
+		}
+		for i, item := range []struct {
+			status string
+			amount string
+		}{
+			{PayoutStatusConfirmed, "1"}, {PayoutStatusSubmitted, "0.5"}, {PayoutStatusPending, "0.2"}, {PayoutStatusFailed, "9"},
+		} {
+			require.NoError(t, s.CreatePayout(ctx, &Payout{
+				RequestId: fmt.Sprintf("payout-%d", i),
+				AssetId:   usdt,
+				Amount:    decimal.RequireFromString(item.amount),
+				Status:    item.status,
+				CreatedAt: 1,
+				UpdatedAt: 1,
+			}))
+		}
+
+		ledgers, err := s.ListAssetLedgers(ctx)
+		require.NoError(t, err)
+		require.Len(t, ledgers, 2)
+		assert.Equal(t, usdt, ledgers[0].AssetID)
+		assert.Equal(t, "3.3", ledgers[0].Received.String())
+		assert.Equal(t, "1", ledgers[0].Paid.String())
+		assert.Equal(t, "0.7", ledgers[0].Pending.String())
+		assert.Equal(t, btc, ledgers[1].AssetID)
+		assert.Equal(t, "0.001", ledgers[1].Received.String())
+		assert.True(t, ledgers[1].Paid.IsZero())
+
+		for i, run := range []string{"run-1", "run-2"} {
+			require.NoError(t, s.AddReconciliations(ctx, []*Reconciliation{
+				{RunID: run, AssetID: usdt, Difference: decimal.NewFromInt(int64(i)), CreatedAt: int64(i) + 1},
+				{RunID: run, AssetID: btc, CreatedAt: int64(i) + 1},
+			}))
+		}
+
+		latest, err = s.GetLatestReconciliations(ctx)
+		require.NoError(t, err)
+		require.Len(t, latest, 2)
+		for _, item := range latest {
+			assert.Equal(t, "run-2", item.RunID)
+		}
+
+		items, next, err := s.ListReconciliations(ctx, usdt, 1, nil)
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, "1", items[0].Difference.String())
+		require.NotNil(t, next)
+		items, next, err = s.ListReconciliations(ctx, usdt, 1, next)
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, "run-1", items[0].RunID)
+		assert.Nil(t, next)
+
+		items, _, err = s.ListReconciliations(ctx, "", 0, nil)
+		require.NoError(t, err)
+		assert.Len(t, items, 4)
+	})
+}
+
+func TestLedger(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		const (
+			asset = "965e5c6e-434c-3fa9-b780-c50f43cd955c"
+			donor = "donor"
+			pid   = "5d7e9f1a-3b4c-4d6e-9f8a-0b2c4d5e6f7a"
+		)
+		require.NoError(t, s.AddProject(ctx, &Project{PID: pid, Title: "project", IdentityNumber: "2001"}))
+
+		// 计入项目的捐赠和无法处理的转入
+		donation := &Snapshot{SnapshotId: "snapshot-1", UserId: donor, AssetId: asset, Amount: decimal.NewFromInt(10), CreatedAt: 100}
+		_, err := s.RecordDonation(ctx, &DonationRecord{
+			Snapshot: donation,
+			Action:   &DonateAction{ID: "action-1", PID: pid, AssetID: asset, Amount: donation.Amount},
+		})
+		require.NoError(t, err)
+		_, err = s.RecordDonation(ctx, &DonationRecord{Snapshot: &Snapshot{
+			SnapshotId: "snapshot-2", UserId: donor, AssetId: asset, Amount: decimal.NewFromInt(3), CreatedAt: 200,
+		}})
+		require.NoError(t, err)
+
+		// 转给项目方, 重复写入只记一次
+		payout := &Payout{RequestId: "payout-1", Kind: PayoutKindForward, AssetId: asset, Amount: decimal.NewFromInt(10), PID: pid}
+		require.NoError(t, s.PostLedgerEntries(ctx, PayoutLedgerEntries(payout, 300)))
+		require.NoError(t, s.PostLedgerEntries(ctx, PayoutLedgerEntries(payout, 400)))
+
+		unbalanced := PayoutLedgerEntries(&Payout{RequestId: "payout-2", AssetId: asset, Amount: decimal.NewFromInt(1), Member: donor}, 500)
+		unbalanced[0].Amount = decimal.NewFromInt(2)
+		assert.ErrorIs(t, s.PostLedgerEntries(ctx, unbalanced), ErrUnbalancedLedgerTx)
+
+		balances := func(account string, at int64) map[string]string {
+			items, err := s.ListLedgerBalances(ctx, account, at)
+			require.NoError(t, err)
+			m := map[string]string{}
+			for _, item := range items {
+				assert.Equal(t, asset, item.AssetID)
+				m[item.Account] = item.Amount.String()
+			}
+			return m
+		}
+		assert.Equal(t, map[string]string{
+			LedgerAccountWallet: "3",
+			UserAccount(donor):  "-3",
+		}, balances("", 0))
+		assert.Equal(t, map[string]string{
+			LedgerAccountWallet: "13",
+			UserAccount(donor):  "-3",
+			ProjectAccount(pid): "-10",
+		}, balances("", 200))
+		assert.Equal(t, map[string]string{ProjectAccount(pid): "-10"}, balances(ProjectAccount(pid), 299))
+		assert.Empty(t, balances("", 99))
+
+		imbalances, err := s.ListLedgerImbalances(ctx, 0)
+		require.NoError(t, err)
+		assert.Empty(t, imbalances)
+	})
+}
+
+func TestConsolidations(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		const (
+			usdt = "4d8c508b-91c5-375b-92b0-ee702ed2dac5"
+			btc  = "c6d0c728-2624-429b-8e0d-d9d19b6592fa"
+		)
+
+		for i, asset := range []string{usdt, btc, usdt} {
+			require.NoError(t, s.CreateConsolidation(ctx, &Consolidation{
+				RequestId: fmt.Sprintf("consolidation-%d", i),
+				AssetId:   asset,
+				Inputs:    2,
+				Amount:    decimal.RequireFromString("1.5"),
+				Outputs:   "a,b",
+				Status:    ConsolidationStatusPending,
+				CreatedAt: int64(i) + 1,
+				UpdatedAt: int64(i) + 1,
+			}))
+		}
+		// 重复写入被忽略
+		require.NoError(t, s.CreateConsolidation(ctx, &Consolidation{RequestId: "consolidation-0", AssetId: btc, Status: ConsolidationStatusFailed, CreatedAt: 9, UpdatedAt: 9}))
+
+		consolidation, err := s.GetConsolidation(ctx, "consolidation-0")
+		require.NoError(t, err)
+		assert.Equal(t, usdt, consolidation.AssetId)
+		assert.Equal(t, "a,b", consolidation.Outputs)
+		_, err = s.GetConsolidation(ctx, "missing")
+		assert.Error(t, err)
+
+		consolidation.Status = ConsolidationStatusSubmitted
+		consolidation.Attempts = 1
+		consolidation.UpdatedAt = 10
+		require.NoError(t, s.UpdateConsolidation(ctx, consolidation))
+		require.NoError(t, s.UpdateConsolidation(ctx, &Consolidation{RequestId: "consolidation-1", Status: ConsolidationStatusFailed, Attempts: 5, LastError: "boom", UpdatedAt: 10}))
+
+		unfinished, err := s.ListUnfinishedConsolidations(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, unfinished, 2)
+		assert.Equal(t, "consolidation-0", unfinished[0].RequestId)
+		assert.Equal(t, ConsolidationStatusSubmitted, unfinished[0].Status)
+		assert.Equal(t, 1, unfinished[0].Attempts)
+		assert.Equal(t, "consolidation-2", unfinished[1].RequestId)
+
+		// 按时间倒序翻页
+		page, next, err := s.ListConsolidations(ctx, "", 2, nil)
+		require.NoError(t, err)
+		require.Len(t, page, 2)
+		assert.Equal(t, "consolidation-2", page[0].RequestId)
+		assert.Equal(t, "consolidation-1", page[1].RequestId)
+		assert.Equal(t, "boom", page[1].LastError)
+		require.NotNil(t, next)
+		page, next, err = s.ListConsolidations(ctx, "", 2, next)
+		require.NoError(t, err)
+		require.Len(t, page, 1)
+		assert.Equal(t, "consolidation-0", page[0].RequestId)
+		assert.Nil(t, next)
+
+		page, _, err = s.ListConsolidations(ctx, btc, 10, nil)
+		require.NoError(t, err)
+		require.Len(t, page, 1)
+		assert.Equal(t, "consolidation-1", page[0].RequestId)
+	})
+}
+
+func TestCreateSnapshotPayout(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		newPayout := func(requestId, kind string) *Payout {
+			return &Payout{
+				RequestId:  requestId,
+				SnapshotId: "snapshot-1",
+				Kind:       kind,
+				AssetId:    "965e5c6e-434c-3fa9-b780-c50f43cd955c",
+				Amount:     decimal.NewFromInt(1),
+				Status:     PayoutStatusPending,
+				CreatedAt:  1,
+				UpdatedAt:  1,
+			}
+		}
+
+		payout, err := s.CreateSnapshotPayout(ctx, newPayout("refund-1", PayoutKindRefund))
+		require.NoError(t, err)
+		assert.Equal(t, "refund-1", payout.RequestId)
+
+		// 相同 request id 返回已有记录, 其他出账被拒绝
+		payout, err = s.CreateSnapshotPayout(ctx, newPayout("refund-1", PayoutKindRefund))
+		require.NoError(t, err)
+		assert.Equal(t, PayoutKindRefund, payout.Kind)
+		_, err = s.CreateSnapshotPayout(ctx, newPayout("forward-1", PayoutKindForward))
+		assert.ErrorIs(t, err, ErrSnapshotHasPayout)
+
+		// 已有的出账失败后可以再出账
+		payout.Status = PayoutStatusFailed
+		require.NoError(t, s.UpdatePayout(ctx, payout))
+		payout, err = s.CreateSnapshotPayout(ctx, newPayout("forward-1", PayoutKindForward))
+		require.NoError(t, err)
+		assert.Equal(t, PayoutKindForward, payout.Kind)
+	})
+}
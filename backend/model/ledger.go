@@ -0,0 +1,154 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrUnbalancedLedgerTx 交易中某个资产的分录之和不为 0
+var ErrUnbalancedLedgerTx = errors.New("unbalanced ledger tx")
+
+// UserAccount 平台代用户持有的资产
+func UserAccount(uid string) string {
+	return "user:" + uid
+}
+
+// ProjectAccount 平台代项目持有, 尚未转给项目方的资产
+func ProjectAccount(pid string) string {
+	return "project:" + pid
+}
+
+type ledgerLine struct {
+	account string
+	amount  decimal.Decimal
+}
+
+// ledgerTx 生成一笔交易的分录, Line 为分录在交易中的序号
+func ledgerTx(txID, kind, ref, assetID string, createdAt int64, lines ...ledgerLine) []*LedgerEntry {
+	entries := make([]*LedgerEntry, 0, len(lines))
+	for i, line := range lines {
+		entries = append(entries, &LedgerEntry{
+			TxID:      txID,
+			Line:      i,
+			Kind:      kind,
+			Account:   line.account,
+			AssetID:   assetID,
+			Amount:    line.amount,
+			Ref:       ref,
+			CreatedAt: createdAt,
+		})
+	}
+	return entries
+}
+
+// DepositLedgerEntries 收到 snapshot: 钱包增加, 平台代转入的用户持有
+func DepositLedgerEntries(snapshot *Snapshot) []*LedgerEntry {
+	return ledgerTx("deposit:"+snapshot.SnapshotId, LedgerKindDeposit, snapshot.SnapshotId, snapshot.AssetId, snapshot.CreatedAt,
+		ledgerLine{LedgerAccountWallet, snapshot.Amount},
+		ledgerLine{UserAccount(snapshot.UserId), snapshot.Amount.Neg()},
+	)
+}
+
+// DonationLedgerEntries snapshot 计入项目: 从捐赠者转到项目, 每个 snapshot 只计入一次
+func DonationLedgerEntries(snapshot *Snapshot, pid string, createdAt int64) []*LedgerEntry {
+	return ledgerTx("donation:"+snapshot.SnapshotId, LedgerKindDonation, snapshot.SnapshotId, snapshot.AssetId, createdAt,
+		ledgerLine{UserAccount(snapshot.UserId), snapshot.Amount},
+		ledgerLine{ProjectAccount(pid), snapshot.Amount.Neg()},
+	)
+}
+
+// PayoutLedgerEntries 出账确认: 钱包减少, 转给项目方时从项目扣除, 退款时从收款用户扣除
+// 没有记录项目的旧出账从收款用户扣除
+func PayoutLedgerEntries(payout *Payout, createdAt int64) []*LedgerEntry {
+	kind, account := LedgerKindRefund, UserAccount(payout.Member)
+	if payout.Kind == PayoutKindForward {
+		kind = LedgerKindForward
+		if payout.PID != "" {
+			account = ProjectAccount(payout.PID)
+		}
+	}
+	return ledgerTx("payout:"+payout.RequestId, kind, payout.RequestId, payout.AssetId, createdAt,
+		ledgerLine{account, payout.Amount},
+		ledgerLine{LedgerAccountWallet, payout.Amount.Neg()},
+	)
+}
+
+// ConsolidationLedgerEntries 聚合确认: 花费的输入转出钱包, 聚合的输出转入钱包
+// 输入与输出的差额为网络收取的手续费
+func ConsolidationLedgerEntries(consolidation *Consolidation, output decimal.Decimal, createdAt int64) []*LedgerEntry {
+	lines := []ledgerLine{
+		{LedgerAccountWallet, consolidation.Amount.Neg()},
+		{LedgerAccountWallet, output},
+	}
+	fee := consolidation.Amount.Sub(output)
+	if !fee.IsZero() {
+		lines = append(lines, ledgerLine{LedgerAccountFee, fee})
+	}
+	entries := ledgerTx("consolidation:"+consolidation.RequestId, LedgerKindConsolidation, consolidation.RequestId, consolidation.AssetId, createdAt, lines...)
+	if len(entries) > 2 {
+		entries[2].Kind = LedgerKindFee
+	}
+	return entries
+}
+
+// ledgerEntries 入账时的分录, 计入捐赠时同时计入项目
+func (r *DonationRecord) ledgerEntries() []*LedgerEntry {
+	entries := DepositLedgerEntries(r.Snapshot)
+	if r.Action != nil {
+		entries = append(entries, DonationLedgerEntries(r.Snapshot, r.Action.PID, r.Snapshot.CreatedAt)...)
+	}
+	return entries
+}
+
+// groupLedgerTxs 按 TxID 分组并检查每笔交易是否平衡, 保持交易的先后顺序
+func groupLedgerTxs(entries []*LedgerEntry) ([][]*LedgerEntry, error) {
+	var (
+		txs   [][]*LedgerEntry
+		index = map[string]int{}
+	)
+	for _, entry := range entries {
+		i, ok := index[entry.TxID]
+		if !ok {
+			i = len(txs)
+			index[entry.TxID] = i
+			txs = append(txs, nil)
+		}
+		txs[i] = append(txs[i], entry)
+	}
+
+	for _, tx := range txs {
+		sums := map[string]decimal.Decimal{}
+		for _, entry := range tx {
+			sums[entry.AssetID] = sums[entry.AssetID].Add(entry.Amount)
+		}
+		for assetID, sum := range sums {
+			if !sum.IsZero() {
+				return nil, fmt.Errorf("%w: tx %s asset %s sum %s", ErrUnbalancedLedgerTx, tx[0].TxID, assetID, sum)
+			}
+		}
+	}
+	return txs, nil
+}
+
+// ledgerSum 按账户和资产汇总的金额
+type ledgerSum struct {
+	Account string          `gorm:"column:account"`
+	AssetID string          `gorm:"column:asset_id"`
+	Amount  decimal.Decimal `gorm:"column:amount"`
+}
+
+// ledgerBalances 去掉余额为 0 的账户
+// sqlite 的 SUM 以浮点计算, 统一保留到列的精度
+func ledgerBalances(sums []*ledgerSum) []*LedgerBalance {
+	balances := make([]*LedgerBalance, 0, len(sums))
+	for _, sum := range sums {
+		amount := sum.Amount.Round(8)
+		if amount.IsZero() {
+			continue
+		}
+		balances = append(balances, &LedgerBalance{Account: sum.Account, AssetID: sum.AssetID, Amount: amount})
+	}
+	return balances
+}
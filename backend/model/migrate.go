@@ -0,0 +1,128 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fox-one/pkg/store2"
+	"github.com/rs/zerolog/log"
+)
+
+// Migration 一次数据库结构变更, 按 Version 顺序执行
+// 发布后的迁移不能再修改, 需要调整时追加新的版本
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *store2.DB) error
+	Down    func(tx *store2.DB) error
+}
+
+// SchemaVersion 已执行的迁移
+type SchemaVersion struct {
+	Version   int64  `gorm:"column:version;primaryKey;autoIncrement:false" json:"version"`
+	Name      string `gorm:"column:name;type:varchar(128)" json:"name"`
+	AppliedAt int64  `gorm:"column:applied_at;not null" json:"appliedAt"`
+}
+
+func (SchemaVersion) TableName() string {
+	return "schema_version"
+}
+
+// Migrations 所有迁移, 按版本升序
+func Migrations() []*Migration {
+	return migrations
+}
+
+// LatestSchemaVersion 最新的迁移版本
+func LatestSchemaVersion() int64 {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// CurrentSchemaVersion 数据库当前的版本, 0 表示还没有执行过迁移
+func CurrentSchemaVersion(db *store2.DB) (int64, error) {
+	if err := db.Update().AutoMigrate(&SchemaVersion{}); err != nil {
+		return 0, err
+	}
+
+	var versions []*SchemaVersion
+	if err := db.Update().Order("version DESC").Limit(1).Find(&versions).Error; err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, nil
+	}
+	return versions[0].Version, nil
+}
+
+// MigrateUp 依次执行版本不超过 target 的未执行迁移, target 为 0 表示升级到最新
+func MigrateUp(db *store2.DB, target int64) error {
+	current, err := CurrentSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if target > 0 && m.Version > target {
+			break
+		}
+
+		// mysql 的 DDL 会隐式提交, 失败时可能需要手动清理
+		if err := db.Tx(func(tx *store2.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaVersion{
+				Version:   m.Version,
+				Name:      m.Name,
+				AppliedAt: time.Now().Unix(),
+			}).Error
+		}); err != nil {
+			return fmt.Errorf("migrate up %d_%s: %w", m.Version, m.Name, err)
+		}
+		log.Info().Int64("version", m.Version).Str("name", m.Name).Msg("migrated up")
+	}
+	return nil
+}
+
+// MigrateDown 回滚最近执行的 steps 个迁移
+func MigrateDown(db *store2.DB, steps int) error {
+	for i := 0; i < steps; i++ {
+		current, err := CurrentSchemaVersion(db)
+		if err != nil {
+			return err
+		}
+		if current == 0 {
+			return nil
+		}
+
+		m := findMigration(current)
+		if m == nil {
+			return fmt.Errorf("migrate down: unknown schema version %d", current)
+		}
+		if err := db.Tx(func(tx *store2.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Where("version = ?", m.Version).Delete(&SchemaVersion{}).Error
+		}); err != nil {
+			return fmt.Errorf("migrate down %d_%s: %w", m.Version, m.Name, err)
+		}
+		log.Info().Int64("version", m.Version).Str("name", m.Name).Msg("migrated down")
+	}
+	return nil
+}
+
+func findMigration(version int64) *Migration {
+	for _, m := range migrations {
+		if m.Version == version {
+			return m
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fox-one/pkg/store2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateUpDown(t *testing.T) {
+	forEachDB(t, func(t *testing.T, conn *store2.DB) {
+		require.NoError(t, MigrateUp(conn, 0))
+		version, err := CurrentSchemaVersion(conn)
+		require.NoError(t, err)
+		assert.Equal(t, LatestSchemaVersion(), version)
+
+		// 重复执行不做任何修改
+		require.NoError(t, MigrateUp(conn, 0))
+
+		require.NoError(t, MigrateDown(conn, len(Migrations())))
+		version, err = CurrentSchemaVersion(conn)
+		require.NoError(t, err)
+		assert.EqualValues(t, 0, version)
+		assert.False(t, conn.Migrator().HasTable("users"))
+
+		require.NoError(t, MigrateUp(conn, 0))
+		assert.True(t, conn.Migrator().HasColumn(&Asset{}, "price_usd"))
+		assert.True(t, conn.Migrator().HasColumn(&User{}, "language"))
+	})
+}
+
+func TestMigrateUsersPrimaryKey(t *testing.T) {
+	forEachDB(t, func(t *testing.T, conn *store2.DB) {
+		ctx := context.Background()
+		require.NoError(t, MigrateUp(conn, 1))
+
+		// 旧表没有约束, 同一个用户可能登记了多次
+		now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, conn.Create([]*userV1{
+			{MixinUID: "uid-1", IdentityNumber: "1001", FullName: "old", CreatedAt: now, UpdatedAt: now},
+			{MixinUID: "uid-1", IdentityNumber: "1001", FullName: "new", CreatedAt: now, UpdatedAt: now.Add(time.Hour)},
+			{MixinUID: "uid-2", IdentityNumber: "1002", FullName: "other", CreatedAt: now.Add(time.Minute), UpdatedAt: now},
+		}).Error)
+		require.NoError(t, conn.Create(&assetV1{AssetID: "965e5c6e-434c-3fa9-b780-c50f43cd955c", PriceUSD: decimal.NewFromInt(1)}).Error)
+
+		require.NoError(t, MigrateUp(conn, 0))
+		s := NewStore(conn)
+
+		users, err := s.ListUsers(ctx)
+		require.NoError(t, err)
+		require.Len(t, users, 2)
+		user, err := s.GetUserByUID(ctx, "uid-1")
+		require.NoError(t, err)
+		assert.Equal(t, "new", user.FullName)
+		assert.EqualValues(t, 1, user.ID)
+
+		assert.Error(t, s.AddUser(ctx, &User{MixinUID: "uid-1", IdentityNumber: "1003"}))
+		assert.Error(t, s.AddUser(ctx, &User{MixinUID: "uid-3", IdentityNumber: "1002"}))
+
+		asset, err := s.GetAsset(ctx, "965e5c6e-434c-3fa9-b780-c50f43cd955c")
+		require.NoError(t, err)
+		assert.True(t, asset.PriceUSD.Equal(decimal.NewFromInt(1)))
+
+		// 回滚到 v1 后恢复旧的表结构和数据
+		require.NoError(t, MigrateDown(conn, int(LatestSchemaVersion()-1)))
+		assert.False(t, conn.Migrator().HasColumn("users", "id"))
+		assert.True(t, conn.Migrator().HasColumn("assets", "priceUsd"))
+		var count int64
+		require.NoError(t, conn.Model(&userV1{}).Count(&count).Error)
+		assert.EqualValues(t, 2, count)
+	})
+}
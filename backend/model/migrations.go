@@ -0,0 +1,462 @@
+package model
+
+import (
+	"sort"
+	"time"
+
+	"github.com/fox-one/pkg/store2"
+	"github.com/shopspring/decimal"
+)
+
+// 迁移中使用的表结构是当时的快照, 不随 model.go 变化
+var migrations = []*Migration{
+	{
+		// 原 AutoMigrate 建立的表结构, 已有的库执行时不做修改
+		Version: 1,
+		Name:    "baseline",
+		Up: func(tx *store2.DB) error {
+			if err := tx.AutoMigrate(&userV1{}, &projectV1{}, &projectAliasV1{}); err != nil {
+				return err
+			}
+			// 旧项目的 pid 即 base64 链接生成的 ID, 补齐别名
+			if err := tx.Exec(`INSERT INTO project_aliases (alias, pid, created_at)
+				SELECT pid, pid, created_at FROM projects
+				WHERE NOT EXISTS (SELECT 1 FROM project_aliases WHERE project_aliases.alias = projects.pid)`).Error; err != nil {
+				return err
+			}
+			return tx.AutoMigrate(
+				&projectAssetTotalV1{},
+				&donateActionV1{},
+				&assetV1{},
+				&snapshotV1{},
+				&payoutV1{},
+				&syncStateV1{},
+				&adminAuditV1{},
+			)
+		},
+		Down: func(tx *store2.DB) error {
+			return tx.Migrator().DropTable(
+				&adminAuditV1{},
+				&syncStateV1{},
+				&payoutV1{},
+				&snapshotV1{},
+				&assetV1{},
+				&donateActionV1{},
+				&projectAssetTotalV1{},
+				&projectAliasV1{},
+				&projectV1{},
+				&userV1{},
+			)
+		},
+	},
+	{
+		// users 表增加自增主键, mixin_uid 和 identity_number 唯一
+		// 重复的用户只保留最近更新的一条
+		Version: 2,
+		Name:    "users_primary_key",
+		Up: func(tx *store2.DB) error {
+			var users []*userV1
+			if err := tx.Order("updated_at DESC").Find(&users).Error; err != nil {
+				return err
+			}
+
+			var (
+				rows   []*userV2
+				uids   = make(map[string]bool)
+				idents = make(map[string]bool)
+			)
+			for _, u := range users {
+				if uids[u.MixinUID] || idents[u.IdentityNumber] {
+					continue
+				}
+				uids[u.MixinUID] = true
+				idents[u.IdentityNumber] = true
+				rows = append(rows, &userV2{
+					MixinUID:       u.MixinUID,
+					IdentityNumber: u.IdentityNumber,
+					FullName:       u.FullName,
+					AvatarUrl:      u.AvatarUrl,
+					Biography:      u.Biography,
+					MixinCreatedAt: u.MixinCreatedAt,
+					CreatedAt:      u.CreatedAt,
+					UpdatedAt:      u.UpdatedAt,
+					BannedAt:       u.BannedAt,
+				})
+			}
+			// 按注册顺序分配 id
+			sort.SliceStable(rows, func(i, j int) bool {
+				return rows[i].CreatedAt.Before(rows[j].CreatedAt)
+			})
+
+			return recreateTable(tx, "users", "users_v1", rows)
+		},
+		Down: func(tx *store2.DB) error {
+			var users []*userV2
+			if err := tx.Order("id ASC").Find(&users).Error; err != nil {
+				return err
+			}
+
+			rows := make([]*userV1, 0, len(users))
+			for _, u := range users {
+				rows = append(rows, &userV1{
+					MixinUID:       u.MixinUID,
+					IdentityNumber: u.IdentityNumber,
+					FullName:       u.FullName,
+					AvatarUrl:      u.AvatarUrl,
+					Biography:      u.Biography,
+					MixinCreatedAt: u.MixinCreatedAt,
+					CreatedAt:      u.CreatedAt,
+					UpdatedAt:      u.UpdatedAt,
+					BannedAt:       u.BannedAt,
+				})
+			}
+			return recreateTable(tx, "users", "users_v2", rows)
+		},
+	},
+	{
+		Version: 3,
+		Name:    "assets_price_usd",
+		Up: func(tx *store2.DB) error {
+			return tx.Migrator().RenameColumn("assets", "priceUsd", "price_usd")
+		},
+		Down: func(tx *store2.DB) error {
+			return tx.Migrator().RenameColumn("assets", "price_usd", "priceUsd")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "webhooks",
+		Up: func(tx *store2.DB) error {
+			return tx.AutoMigrate(&webhookV1{}, &webhookDeliveryV1{})
+		},
+		Down: func(tx *store2.DB) error {
+			return tx.Migrator().DropTable(&webhookDeliveryV1{}, &webhookV1{})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "users_language",
+		Up: func(tx *store2.DB) error {
+			return tx.Migrator().AddColumn(&userV3{}, "Language")
+		},
+		Down: func(tx *store2.DB) error {
+			return tx.Migrator().DropColumn(&userV3{}, "Language")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "reconciliations",
+		Up: func(tx *store2.DB) error {
+			return tx.AutoMigrate(&reconciliationV1{})
+		},
+		Down: func(tx *store2.DB) error {
+			return tx.Migrator().DropTable(&reconciliationV1{})
+		},
+	},
+	{
+		// 复式记账, 出账记录转给项目方时记录项目
+		Version: 7,
+		Name:    "ledger_entries",
+		Up: func(tx *store2.DB) error {
+			if err := tx.Migrator().AddColumn(&payoutV2{}, "PID"); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(&ledgerEntryV1{})
+		},
+		Down: func(tx *store2.DB) error {
+			if err := tx.Migrator().DropTable(&ledgerEntryV1{}); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&payoutV2{}, "PID")
+		},
+	},
+	{
+		Version: 8,
+		Name:    "consolidations",
+		Up: func(tx *store2.DB) error {
+			return tx.AutoMigrate(&consolidationV1{})
+		},
+		Down: func(tx *store2.DB) error {
+			return tx.Migrator().DropTable(&consolidationV1{})
+		},
+	},
+}
+
+// recreateTable 把 table 改名为 backup 后按 T 重建并写入 rows, 最后删除原表
+// 用于 sqlite 无法通过 ALTER TABLE 修改的主键等结构
+func recreateTable[T any](tx *store2.DB, table, backup string, rows []*T) error {
+	if err := tx.Migrator().RenameTable(table, backup); err != nil {
+		return err
+	}
+	if err := tx.Migrator().CreateTable(new(T)); err != nil {
+		return err
+	}
+	if len(rows) > 0 {
+		if err := tx.CreateInBatches(rows, 500).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Migrator().DropTable(backup)
+}
+
+type userV1 struct {
+	MixinUID       string     `gorm:"type:varchar(36);column:mixin_uid"`
+	IdentityNumber string     `gorm:"type:varchar(255);column:identity_number"`
+	FullName       string     `gorm:"type:varchar(255);column:full_name"`
+	AvatarUrl      string     `gorm:"type:varchar(255);column:avatar_url"`
+	Biography      string     `gorm:"type:text;column:biography"`
+	MixinCreatedAt time.Time  `gorm:"column:mixin_created_at"`
+	CreatedAt      time.Time  `gorm:"column:created_at"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at"`
+	BannedAt       *time.Time `gorm:"column:banned_at"`
+}
+
+func (userV1) TableName() string { return "users" }
+
+type userV2 struct {
+	ID             uint64     `gorm:"primaryKey;autoIncrement;column:id"`
+	MixinUID       string     `gorm:"uniqueIndex:idx_users_mixin_uid;type:varchar(36);column:mixin_uid"`
+	IdentityNumber string     `gorm:"uniqueIndex:idx_users_identity_number;type:varchar(255);column:identity_number"`
+	FullName       string     `gorm:"type:varchar(255);column:full_name"`
+	AvatarUrl      string     `gorm:"type:varchar(255);column:avatar_url"`
+	Biography      string     `gorm:"type:text;column:biography"`
+	MixinCreatedAt time.Time  `gorm:"column:mixin_created_at"`
+	CreatedAt      time.Time  `gorm:"column:created_at"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at"`
+	BannedAt       *time.Time `gorm:"column:banned_at"`
+}
+
+func (userV2) TableName() string { return "users" }
+
+type userV3 struct {
+	ID             uint64     `gorm:"primaryKey;autoIncrement;column:id"`
+	MixinUID       string     `gorm:"uniqueIndex:idx_users_mixin_uid;type:varchar(36);column:mixin_uid"`
+	IdentityNumber string     `gorm:"uniqueIndex:idx_users_identity_number;type:varchar(255);column:identity_number"`
+	FullName       string     `gorm:"type:varchar(255);column:full_name"`
+	AvatarUrl      string     `gorm:"type:varchar(255);column:avatar_url"`
+	Biography      string     `gorm:"type:text;column:biography"`
+	Language       string     `gorm:"type:varchar(16);column:language"`
+	MixinCreatedAt time.Time  `gorm:"column:mixin_created_at"`
+	CreatedAt      time.Time  `gorm:"column:created_at"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at"`
+	BannedAt       *time.Time `gorm:"column:banned_at"`
+}
+
+func (userV3) TableName() string { return "users" }
+
+type projectV1 struct {
+	PID            string          `gorm:"primaryKey;type:varchar(36);column:pid"`
+	Title          string          `gorm:"type:varchar(255);column:title"`
+	Description    string          `gorm:"type:text;column:description"`
+	ImgUrl         string          `gorm:"type:varchar(255);column:img_url"`
+	Link           string          `gorm:"type:varchar(255);column:link"`
+	IdentityNumber string          `gorm:"type:varchar(255);column:identity_number"`
+	MixinUID       string          `gorm:"type:varchar(36);column:mixin_uid"`
+	DonateCnt      int64           `gorm:"column:donate_cnt"`
+	RaisedUSD      decimal.Decimal `gorm:"type:decimal(64,8);default:0;column:raised_usd"`
+	GoalAssetID    string          `gorm:"type:varchar(36);column:goal_asset_id"`
+	GoalAmount     decimal.Decimal `gorm:"type:decimal(64,8);default:0;column:goal_amount"`
+	StartAt        *time.Time      `gorm:"column:start_at"`
+	EndAt          *time.Time      `gorm:"column:end_at"`
+	ArchivedAt     *time.Time      `gorm:"index;column:archived_at"`
+	HiddenAt       *time.Time      `gorm:"column:hidden_at"`
+	BannedAt       *time.Time      `gorm:"column:banned_at"`
+	CreatedAt      time.Time       `gorm:"column:created_at"`
+}
+
+func (projectV1) TableName() string { return "projects" }
+
+type projectAliasV1 struct {
+	Alias     string    `gorm:"primaryKey;type:varchar(36);column:alias"`
+	PID       string    `gorm:"index;type:varchar(36);column:pid"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
+
+func (projectAliasV1) TableName() string { return "project_aliases" }
+
+type projectAssetTotalV1 struct {
+	PID       string          `gorm:"primaryKey;type:varchar(36);column:pid"`
+	AssetID   string          `gorm:"primaryKey;type:varchar(36);column:asset_id"`
+	Amount    decimal.Decimal `gorm:"type:decimal(64,8);column:amount"`
+	AmountUSD decimal.Decimal `gorm:"type:decimal(64,8);column:amount_usd"`
+	DonateCnt int64           `gorm:"column:donate_cnt"`
+	UpdatedAt time.Time       `gorm:"column:updated_at"`
+}
+
+func (projectAssetTotalV1) TableName() string { return "project_asset_totals" }
+
+type donateActionV1 struct {
+	ID             string          `gorm:"primaryKey;type:varchar(36);column:id"`
+	PID            string          `gorm:"primaryKey;type:varchar(36);column:pid"`
+	IdentityNumber string          `gorm:"type:varchar(255);column:identity_number"`
+	AssetID        string          `gorm:"type:varchar(36);column:asset_id"`
+	Amount         decimal.Decimal `gorm:"type:decimal(64,8);column:amount"`
+	AmountUSD      decimal.Decimal `gorm:"type:decimal(64,8);default:0;column:amount_usd"`
+	Message        string          `gorm:"type:text;column:message"`
+	Anonymous      bool            `gorm:"not null;default:false;column:anonymous"`
+	ReferralCode   string          `gorm:"type:varchar(64);column:referral_code"`
+	CreatedAt      time.Time       `gorm:"column:created_at"`
+}
+
+func (donateActionV1) TableName() string { return "donate_actions" }
+
+type assetV1 struct {
+	AssetID      string          `gorm:"column:asset_id;primaryKey;type:varchar(36)"`
+	ChainID      string          `gorm:"column:chain_id;type:varchar(36)"`
+	ChainSymbol  string          `gorm:"column:chain_symbol;type:varchar(255)"`
+	ChainIconURL string          `gorm:"column:chain_icon_url;type:varchar(255)"`
+	Symbol       string          `gorm:"column:symbol;type:varchar(255)"`
+	Name         string          `gorm:"column:name;type:varchar(255)"`
+	IconURL      string          `gorm:"column:icon_url;type:varchar(255)"`
+	PriceUSD     decimal.Decimal `gorm:"column:priceUsd;type:decimal(64,8)"`
+}
+
+func (assetV1) TableName() string { return "assets" }
+
+type snapshotV1 struct {
+	SnapshotId string          `gorm:"column:snapshot_id;primaryKey;type:varchar(36)"`
+	RequestId  string          `gorm:"column:request_id;index;type:varchar(36)"`
+	UserId     string          `gorm:"column:user_id;index;type:varchar(36)"`
+	AssetId    string          `gorm:"column:asset_id;index;type:varchar(36)"`
+	Amount     decimal.Decimal `gorm:"column:amount;type:decimal(64,8)"`
+	Memo       string          `gorm:"column:memo;type:varchar(512)"`
+	CreatedAt  int64           `gorm:"column:created_at;type:bigint;not null"`
+}
+
+func (snapshotV1) TableName() string { return "snapshots" }
+
+type payoutV1 struct {
+	RequestId  string          `gorm:"column:request_id;primaryKey;type:varchar(36)"`
+	SnapshotId string          `gorm:"column:snapshot_id;index;type:varchar(36)"`
+	Kind       string          `gorm:"column:kind;type:varchar(16)"`
+	AssetId    string          `gorm:"column:asset_id;type:varchar(36)"`
+	Amount     decimal.Decimal `gorm:"column:amount;type:decimal(64,8)"`
+	Member     string          `gorm:"column:member;type:varchar(36)"`
+	Memo       string          `gorm:"column:memo;type:varchar(512)"`
+	Status     string          `gorm:"column:status;index;type:varchar(16)"`
+	Attempts   int             `gorm:"column:attempts;not null;default:0"`
+	LastError  string          `gorm:"column:last_error;type:text"`
+	CreatedAt  int64           `gorm:"column:created_at;not null"`
+	UpdatedAt  int64           `gorm:"column:updated_at;not null"`
+}
+
+func (payoutV1) TableName() string { return "payouts" }
+
+type payoutV2 struct {
+	RequestId  string          `gorm:"column:request_id;primaryKey;type:varchar(36)"`
+	SnapshotId string          `gorm:"column:snapshot_id;index;type:varchar(36)"`
+	Kind       string          `gorm:"column:kind;type:varchar(16)"`
+	AssetId    string          `gorm:"column:asset_id;type:varchar(36)"`
+	Amount     decimal.Decimal `gorm:"column:amount;type:decimal(64,8)"`
+	Member     string          `gorm:"column:member;type:varchar(36)"`
+	PID        string          `gorm:"column:pid;type:varchar(36)"`
+	Memo       string          `gorm:"column:memo;type:varchar(512)"`
+	Status     string          `gorm:"column:status;index;type:varchar(16)"`
+	Attempts   int             `gorm:"column:attempts;not null;default:0"`
+	LastError  string          `gorm:"column:last_error;type:text"`
+	CreatedAt  int64           `gorm:"column:created_at;not null"`
+	UpdatedAt  int64           `gorm:"column:updated_at;not null"`
+}
+
+func (payoutV2) TableName() string { return "payouts" }
+
+type syncStateV1 struct {
+	Name      string `gorm:"column:name;primaryKey;type:varchar(64)"`
+	Value     string `gorm:"column:value;type:varchar(255)"`
+	UpdatedAt int64  `gorm:"column:updated_at;not null"`
+}
+
+func (syncStateV1) TableName() string { return "sync_states" }
+
+type adminAuditV1 struct {
+	ID        uint64 `gorm:"column:id;primaryKey;autoIncrement"`
+	Operator  string `gorm:"column:operator;index;type:varchar(64)"`
+	Action    string `gorm:"column:action;type:varchar(128)"`
+	Target    string `gorm:"column:target;type:varchar(255)"`
+	Params    string `gorm:"column:params;type:text"`
+	Status    int    `gorm:"column:status"`
+	CreatedAt int64  `gorm:"column:created_at;index;not null"`
+}
+
+func (adminAuditV1) TableName() string { return "admin_audits" }
+
+type webhookV1 struct {
+	ID             string `gorm:"column:id;primaryKey;type:varchar(36)"`
+	PID            string `gorm:"column:pid;index;type:varchar(36)"`
+	URL            string `gorm:"column:url;type:varchar(512)"`
+	Secret         string `gorm:"column:secret;type:varchar(128)"`
+	PreviousSecret string `gorm:"column:previous_secret;type:varchar(128)"`
+	RotatedAt      int64  `gorm:"column:rotated_at;not null;default:0"`
+	Disabled       bool   `gorm:"column:disabled;not null;default:false"`
+	CreatedAt      int64  `gorm:"column:created_at;not null"`
+	UpdatedAt      int64  `gorm:"column:updated_at;not null"`
+}
+
+func (webhookV1) TableName() string { return "webhooks" }
+
+type webhookDeliveryV1 struct {
+	ID             string `gorm:"column:id;primaryKey;type:varchar(36)"`
+	WebhookID      string `gorm:"column:webhook_id;index;type:varchar(36)"`
+	PID            string `gorm:"column:pid;type:varchar(36)"`
+	Event          string `gorm:"column:event;type:varchar(32)"`
+	Payload        string `gorm:"column:payload;type:text"`
+	ReplayOf       string `gorm:"column:replay_of;type:varchar(36)"`
+	Status         string `gorm:"column:status;index:idx_webhook_deliveries_due;type:varchar(16)"`
+	Attempts       int    `gorm:"column:attempts;not null;default:0"`
+	NextAttemptAt  int64  `gorm:"column:next_attempt_at;index:idx_webhook_deliveries_due;not null"`
+	ResponseStatus int    `gorm:"column:response_status"`
+	ResponseBody   string `gorm:"column:response_body;type:text"`
+	LastError      string `gorm:"column:last_error;type:text"`
+	DeliveredAt    int64  `gorm:"column:delivered_at;not null;default:0"`
+	CreatedAt      int64  `gorm:"column:created_at;index;not null"`
+	UpdatedAt      int64  `gorm:"column:updated_at;not null"`
+}
+
+func (webhookDeliveryV1) TableName() string { return "webhook_deliveries" }
+
+type reconciliationV1 struct {
+	ID             uint64          `gorm:"column:id;primaryKey;autoIncrement"`
+	RunID          string          `gorm:"column:run_id;index;type:varchar(36)"`
+	AssetID        string          `gorm:"column:asset_id;index;type:varchar(36)"`
+	Received       decimal.Decimal `gorm:"column:received;type:decimal(64,8)"`
+	Paid           decimal.Decimal `gorm:"column:paid;type:decimal(64,8)"`
+	Pending        decimal.Decimal `gorm:"column:pending;type:decimal(64,8)"`
+	Expected       decimal.Decimal `gorm:"column:expected;type:decimal(64,8)"`
+	Actual         decimal.Decimal `gorm:"column:actual;type:decimal(64,8)"`
+	Difference     decimal.Decimal `gorm:"column:difference;type:decimal(64,8)"`
+	Discrepancy    decimal.Decimal `gorm:"column:discrepancy;type:decimal(64,8)"`
+	DiscrepancyUSD decimal.Decimal `gorm:"column:discrepancy_usd;type:decimal(64,8)"`
+	Exceeded       bool            `gorm:"column:exceeded;not null;default:false"`
+	CreatedAt      int64           `gorm:"column:created_at;not null"`
+}
+
+func (reconciliationV1) TableName() string { return "reconciliations" }
+
+type ledgerEntryV1 struct {
+	ID        uint64          `gorm:"column:id;primaryKey;autoIncrement"`
+	TxID      string          `gorm:"column:tx_id;uniqueIndex:idx_ledger_entries_tx_line;type:varchar(64)"`
+	Line      int             `gorm:"column:line;uniqueIndex:idx_ledger_entries_tx_line;not null"`
+	Kind      string          `gorm:"column:kind;type:varchar(16)"`
+	Account   string          `gorm:"column:account;index;type:varchar(64)"`
+	AssetID   string          `gorm:"column:asset_id;index;type:varchar(36)"`
+	Amount    decimal.Decimal `gorm:"column:amount;type:decimal(64,8)"`
+	Ref       string          `gorm:"column:ref;type:varchar(64)"`
+	CreatedAt int64           `gorm:"column:created_at;index;not null"`
+}
+
+func (ledgerEntryV1) TableName() string { return "ledger_entries" }
+
+type consolidationV1 struct {
+	RequestId string          `gorm:"column:request_id;primaryKey;type:varchar(36)"`
+	AssetId   string          `gorm:"column:asset_id;index;type:varchar(36)"`
+	Inputs    int             `gorm:"column:inputs;not null"`
+	Amount    decimal.Decimal `gorm:"column:amount;type:decimal(64,8)"`
+	Outputs   string          `gorm:"column:outputs;type:text"`
+	Status    string          `gorm:"column:status;index;type:varchar(16)"`
+	Attempts  int             `gorm:"column:attempts;not null;default:0"`
+	LastError string          `gorm:"column:last_error;type:text"`
+	CreatedAt int64           `gorm:"column:created_at;not null"`
+	UpdatedAt int64           `gorm:"column:updated_at;not null"`
+}
+
+func (consolidationV1) TableName() string { return "consolidations" }
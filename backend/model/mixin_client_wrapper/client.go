@@ -0,0 +1,35 @@
+package mixin_client_wrapper
+
+import (
+	"context"
+	"time"
+
+	"github.com/fox-one/mixin-sdk-go/v2"
+)
+
+// MixinClient 服务用到的 mixin 接口, 测试中可替换为 mixintest.Network
+type MixinClient interface {
+	// 读取机器人钱包的 snapshot
+	ReadSafeSnapshots(ctx context.Context, assetID string, offset time.Time, order string, limit int) ([]*mixin.SafeSnapshot, error)
+	ReadSafeSnapshot(ctx context.Context, snapshotID string) (*mixin.SafeSnapshot, error)
+
+	// 根据 user id 或 identity number 读取用户
+	ReadUser(ctx context.Context, userIdOrIdentityNumber string) (*mixin.User, error)
+
+	ListAssets(ctx context.Context) ([]*mixin.SafeAsset, error)
+	GetAsset(ctx context.Context, assetId string) (*mixin.SafeAsset, error)
+	// 机器人钱包所有未花费的 utxo, assetId 为空表示所有资产
+	ListUnspentUtxos(ctx context.Context, assetId string) ([]*mixin.SafeUtxo, error)
+
+	// 转账, 以 RequestId 保证幂等
+	TransferOneWithRetry(ctx context.Context, req *TransferOneRequest) error
+	// 把同一资产的 2 到 255 个 utxo 合并成一个, 以 requestId 保证幂等
+	ConsolidateUtxos(ctx context.Context, requestId string, utxos []*mixin.SafeUtxo) (*mixin.SafeTransactionRequest, error)
+	// 按 request id 查询转账, 不存在时返回 mixin.EndpointNotFound
+	SafeReadTransactionRequest(ctx context.Context, idOrHash string) (*mixin.SafeTransactionRequest, error)
+
+	SendMessageWithRetry(ctx context.Context, receiptId string, text string) error
+	SendCardWithRetry(ctx context.Context, receiptId string, card *mixin.AppCardMessage) error
+}
+
+var _ MixinClient = (*MixinClientWrapper)(nil)
@@ -4,4 +4,6 @@ import "errors"
 
 var (
 	ErrNotEnoughUtxos = errors.New("not enough utxos")
+	// ErrInvalidConsolidation 聚合的输入不足 2 个, 超过 255 个, 资产不一致或包含铭文
+	ErrInvalidConsolidation = errors.New("invalid utxo consolidation")
 )
@@ -35,7 +35,9 @@ func (m *MixinClientWrapper) SendMessageWithRetry(ctx context.Context, receiptId
 	for i := 0; i < defaultMaxMixinRetry; i++ {
 		if err = m.sendMessage(ctx, receiptId, text); err != nil {
 			log.Error().Err(err).Msg("send message failed, retrying...")
-			time.Sleep(time.Second << i)
+			if err := sleepContext(ctx, time.Second<<i); err != nil {
+				return err
+			}
 			continue
 		} else {
 			return nil
@@ -96,7 +98,9 @@ func (m *MixinClientWrapper) sendMessageV2(ctx context.Context, message *mixin.M
 			break
 		}
 		delay := baseDelay * time.Duration(1<<retry)
-		time.Sleep(delay)
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
 	}
 
 	return err
@@ -0,0 +1,457 @@
+// Package mixintest 提供内存中的 mixin 网络, 用于离线测试入账和转账流程
+package mixintest
+
+import (
+	"context"
+	"donate/model/mixin_client_wrapper"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fox-one/mixin-sdk-go/v2"
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+	"github.com/shopspring/decimal"
+)
+
+var _ mixin_client_wrapper.MixinClient = (*Network)(nil)
+
+// Message 机器人发出的消息
+type Message struct {
+	RecipientID string
+	Category    string
+	Text        string
+	Card        *mixin.AppCardMessage
+}
+
+// Network 模拟机器人钱包的 utxo 和 snapshot, 以及用户, 资产和消息投递
+// 机器人转出的资产记入接收者的余额
+type Network struct {
+	ClientID string // 机器人的 user id
+
+	// TransferErr 不为空时所有转账返回该错误, 模拟网络故障
+	TransferErr error
+	// CardErr 不为空时发送卡片返回该错误
+	CardErr error
+	// FreezeTime 为 true 时事件的时间不再递增, 模拟同一时间点的大量 snapshot
+	FreezeTime bool
+	// ConsolidationFee 每次聚合从输出中扣除的手续费
+	ConsolidationFee decimal.Decimal
+
+	mu        sync.Mutex
+	now       time.Time
+	users     map[string]*mixin.User
+	assets    map[string]*mixin.SafeAsset
+	utxos     []*mixin.SafeUtxo
+	snapshots []*mixin.SafeSnapshot
+	requests  map[string]*mixin.SafeTransactionRequest
+	balances  map[string]map[string]decimal.Decimal
+	messages  map[string][]*Message
+}
+
+// NewNetwork 创建机器人为 clientID 的网络, 之后每个事件的时间从 start 开始递增一秒
+func NewNetwork(clientID string, start time.Time) *Network {
+	return &Network{
+		ClientID: clientID,
+		now:      start,
+		users:    make(map[string]*mixin.User),
+		assets:   make(map[string]*mixin.SafeAsset),
+		requests: make(map[string]*mixin.SafeTransactionRequest),
+		balances: make(map[string]map[string]decimal.Decimal),
+		messages: make(map[string][]*Message),
+	}
+}
+
+func notFound() error {
+	return &mixin.Error{
+		Status:      202,
+		Code:        mixin.EndpointNotFound,
+		Description: "The endpoint is not found.",
+	}
+}
+
+// tick 推进网络时间, 调用方需持有锁
+func (n *Network) tick() time.Time {
+	if !n.FreezeTime {
+		n.now = n.now.Add(time.Second)
+	}
+	return n.now
+}
+
+func (n *Network) AddUser(user *mixin.User) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.users[user.UserID] = user
+}
+
+func (n *Network) AddAsset(asset *mixin.SafeAsset) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.assets[asset.AssetID] = asset
+}
+
+// Deposit 模拟用户向机器人转账, 生成一个 utxo 和对应的 snapshot
+func (n *Network) Deposit(opponentID, assetID string, amount decimal.Decimal, memo string) *mixin.SafeSnapshot {
+	return n.deposit(opponentID, assetID, amount, memo, mixinnet.Hash{})
+}
+
+// DepositInscription 模拟用户向机器人转入一个铭文 utxo
+func (n *Network) DepositInscription(opponentID, assetID string, amount decimal.Decimal, inscription mixinnet.Hash) *mixin.SafeSnapshot {
+	return n.deposit(opponentID, assetID, amount, "", inscription)
+}
+
+func (n *Network) deposit(opponentID, assetID string, amount decimal.Decimal, memo string, inscription mixinnet.Hash) *mixin.SafeSnapshot {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := n.tick()
+	requestID := mixin.RandomTraceID()
+	n.utxos = append(n.utxos, &mixin.SafeUtxo{
+		OutputID:           mixin.RandomTraceID(),
+		RequestID:          requestID,
+		AssetID:            assetID,
+		Amount:             amount,
+		Senders:            []string{opponentID},
+		SendersThreshold:   1,
+		Receivers:          []string{n.ClientID},
+		ReceiversThreshold: 1,
+		InscriptionHash:    inscription,
+		State:              mixin.SafeUtxoStateUnspent,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	})
+
+	snapshot := &mixin.SafeSnapshot{
+		SnapshotID: mixin.RandomTraceID(),
+		RequestID:  requestID,
+		UserID:     n.ClientID,
+		OpponentID: opponentID,
+		AssetID:    assetID,
+		Amount:     amount,
+		Memo:       memo,
+		CreatedAt:  now,
+	}
+	n.snapshots = append(n.snapshots, snapshot)
+	return snapshot
+}
+
+// Balance 用户从机器人收到的资产总额
+func (n *Network) Balance(userID, assetID string) decimal.Decimal {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.balances[userID][assetID]
+}
+
+// Messages 发给用户的消息
+func (n *Network) Messages(userID string) []*Message {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]*Message(nil), n.messages[userID]...)
+}
+
+// Utxos 机器人钱包中某个资产指定状态的 utxo
+func (n *Network) Utxos(assetID string, state mixin.SafeUtxoState) []*mixin.SafeUtxo {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var utxos []*mixin.SafeUtxo
+	for _, utxo := range n.utxos {
+		if utxo.AssetID == assetID && utxo.State == state {
+			utxos = append(utxos, utxo)
+		}
+	}
+	return utxos
+}
+
+func (n *Network) ListUnspentUtxos(ctx context.Context, assetId string) ([]*mixin.SafeUtxo, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var utxos []*mixin.SafeUtxo
+	for _, utxo := range n.utxos {
+		if utxo.State == mixin.SafeUtxoStateUnspent && (assetId == "" || utxo.AssetID == assetId) {
+			u := *utxo
+			utxos = append(utxos, &u)
+		}
+	}
+	return utxos, nil
+}
+
+func (n *Network) ReadSafeSnapshots(ctx context.Context, assetID string, offset time.Time, order string, limit int) ([]*mixin.SafeSnapshot, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	desc := order == "DESC"
+	var snapshots []*mixin.SafeSnapshot
+	for _, snapshot := range n.snapshots {
+		if assetID != "" && snapshot.AssetID != assetID {
+			continue
+		}
+		if !offset.IsZero() {
+			if desc && snapshot.CreatedAt.After(offset) {
+				continue
+			}
+			if !desc && snapshot.CreatedAt.Before(offset) {
+				continue
+			}
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		if desc {
+			return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+		}
+		return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+	})
+	if limit > 0 && len(snapshots) > limit {
+		snapshots = snapshots[:limit]
+	}
+	return snapshots, nil
+}
+
+func (n *Network) ReadSafeSnapshot(ctx context.Context, snapshotID string) (*mixin.SafeSnapshot, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, snapshot := range n.snapshots {
+		if snapshot.SnapshotID == snapshotID {
+			return snapshot, nil
+		}
+	}
+	return nil, notFound()
+}
+
+func (n *Network) ReadUser(ctx context.Context, userIdOrIdentityNumber string) (*mixin.User, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, user := range n.users {
+		if user.UserID == userIdOrIdentityNumber || user.IdentityNumber == userIdOrIdentityNumber {
+			return user, nil
+		}
+	}
+	return nil, notFound()
+}
+
+func (n *Network) ListAssets(ctx context.Context) ([]*mixin.SafeAsset, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	assets := make([]*mixin.SafeAsset, 0, len(n.assets))
+	for _, asset := range n.assets {
+		assets = append(assets, asset)
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		return assets[i].AssetID < assets[j].AssetID
+	})
+	return assets, nil
+}
+
+func (n *Network) GetAsset(ctx context.Context, assetId string) (*mixin.SafeAsset, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	asset, ok := n.assets[assetId]
+	if !ok {
+		return nil, notFound()
+	}
+	return asset, nil
+}
+
+// TransferOneWithRetry 消耗机器人的 utxo 转给 req.Member, 找零留在钱包中
+// 相同 RequestId 的转账只执行一次
+func (n *Network) TransferOneWithRetry(ctx context.Context, req *mixin_client_wrapper.TransferOneRequest) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.TransferErr != nil {
+		return n.TransferErr
+	}
+	if _, ok := n.requests[req.RequestId]; ok {
+		return nil
+	}
+
+	var (
+		inputs []*mixin.SafeUtxo
+		total  decimal.Decimal
+	)
+	for _, utxo := range n.utxos {
+		if total.GreaterThanOrEqual(req.Amount) {
+			break
+		}
+		if utxo.AssetID == req.AssetId && utxo.State == mixin.SafeUtxoStateUnspent {
+			inputs = append(inputs, utxo)
+			total = total.Add(utxo.Amount)
+		}
+	}
+	if total.LessThan(req.Amount) {
+		return mixin_client_wrapper.ErrNotEnoughUtxos
+	}
+
+	now := n.tick()
+	for _, utxo := range inputs {
+		utxo.State = mixin.SafeUtxoStateSpent
+		utxo.UpdatedAt = now
+		utxo.SpentAt = &now
+	}
+	if change := total.Sub(req.Amount); change.IsPositive() {
+		n.utxos = append(n.utxos, &mixin.SafeUtxo{
+			OutputID:           mixin.RandomTraceID(),
+			RequestID:          req.RequestId,
+			AssetID:            req.AssetId,
+			Amount:             change,
+			Receivers:          []string{n.ClientID},
+			ReceiversThreshold: 1,
+			State:              mixin.SafeUtxoStateUnspent,
+			CreatedAt:          now,
+			UpdatedAt:          now,
+		})
+	}
+
+	n.requests[req.RequestId] = &mixin.SafeTransactionRequest{
+		RequestID: req.RequestId,
+		UserID:    n.ClientID,
+		Amount:    req.Amount,
+		Extra:     req.Memo,
+		Receivers: []*mixin.SafeTransactionReceiver{{
+			Members:   []string{req.Member},
+			Threshold: 1,
+		}},
+		State:      mixin.SafeUtxoStateSpent,
+		SnapshotAt: &now,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	n.snapshots = append(n.snapshots, &mixin.SafeSnapshot{
+		SnapshotID: mixin.RandomTraceID(),
+		RequestID:  req.RequestId,
+		UserID:     n.ClientID,
+		OpponentID: req.Member,
+		AssetID:    req.AssetId,
+		Amount:     req.Amount.Neg(),
+		Memo:       req.Memo,
+		CreatedAt:  now,
+	})
+
+	if n.balances[req.Member] == nil {
+		n.balances[req.Member] = make(map[string]decimal.Decimal)
+	}
+	n.balances[req.Member][req.AssetId] = n.balances[req.Member][req.AssetId].Add(req.Amount)
+	return nil
+}
+
+// ConsolidateUtxos 把输入的 utxo 合并为一个, 不产生 snapshot, 相同 requestId 只执行一次
+func (n *Network) ConsolidateUtxos(ctx context.Context, requestId string, utxos []*mixin.SafeUtxo) (*mixin.SafeTransactionRequest, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.TransferErr != nil {
+		return nil, n.TransferErr
+	}
+	if req, ok := n.requests[requestId]; ok {
+		return req, nil
+	}
+	if len(utxos) < 2 || len(utxos) > mixin_client_wrapper.MAX_UTXO_NUM {
+		return nil, mixin_client_wrapper.ErrInvalidConsolidation
+	}
+
+	inputs := make(map[string]bool, len(utxos))
+	for _, utxo := range utxos {
+		if utxo.AssetID != utxos[0].AssetID || utxo.InscriptionHash.HasValue() {
+			return nil, mixin_client_wrapper.ErrInvalidConsolidation
+		}
+		inputs[utxo.OutputID] = true
+	}
+
+	var (
+		spent []*mixin.SafeUtxo
+		total decimal.Decimal
+	)
+	for _, utxo := range n.utxos {
+		if inputs[utxo.OutputID] {
+			if utxo.State != mixin.SafeUtxoStateUnspent {
+				return nil, mixin_client_wrapper.ErrNotEnoughUtxos
+			}
+			spent = append(spent, utxo)
+			total = total.Add(utxo.Amount)
+		}
+	}
+	if len(spent) != len(inputs) {
+		return nil, mixin_client_wrapper.ErrNotEnoughUtxos
+	}
+
+	now := n.tick()
+	for _, utxo := range spent {
+		utxo.State = mixin.SafeUtxoStateSpent
+		utxo.UpdatedAt = now
+		utxo.SpentAt = &now
+	}
+	total = total.Sub(n.ConsolidationFee)
+	n.utxos = append(n.utxos, &mixin.SafeUtxo{
+		OutputID:           mixin.RandomTraceID(),
+		RequestID:          requestId,
+		AssetID:            utxos[0].AssetID,
+		Amount:             total,
+		Receivers:          []string{n.ClientID},
+		ReceiversThreshold: 1,
+		State:              mixin.SafeUtxoStateUnspent,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	})
+
+	req := &mixin.SafeTransactionRequest{
+		RequestID: requestId,
+		UserID:    n.ClientID,
+		Amount:    total,
+		Extra:     mixin_client_wrapper.AGGREGRATE_UTXO_MEMO,
+		Receivers: []*mixin.SafeTransactionReceiver{{
+			Members:   []string{n.ClientID},
+			Threshold: 1,
+		}},
+		State:      mixin.SafeUtxoStateSpent,
+		SnapshotAt: &now,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	n.requests[requestId] = req
+	return req, nil
+}
+
+func (n *Network) SafeReadTransactionRequest(ctx context.Context, idOrHash string) (*mixin.SafeTransactionRequest, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	req, ok := n.requests[idOrHash]
+	if !ok {
+		return nil, notFound()
+	}
+	return req, nil
+}
+
+func (n *Network) SendMessageWithRetry(ctx context.Context, receiptId string, text string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.messages[receiptId] = append(n.messages[receiptId], &Message{
+		RecipientID: receiptId,
+		Category:    mixin.MessageCategoryPlainText,
+		Text:        text,
+	})
+	return nil
+}
+
+func (n *Network) SendCardWithRetry(ctx context.Context, receiptId string, card *mixin.AppCardMessage) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.CardErr != nil {
+		return n.CardErr
+	}
+
+	n.messages[receiptId] = append(n.messages[receiptId], &Message{
+		RecipientID: receiptId,
+		Category:    mixin.MessageCategoryAppCard,
+		Card:        card,
+	})
+	return nil
+}
@@ -1,6 +1,7 @@
 package mixin_client_wrapper
 
 import (
+	"context"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -52,3 +53,15 @@ type InscriptionTransferRequest struct {
 	Memo   string
 	Member string
 }
+
+// sleepContext 重试间隔, ctx 取消时立即返回
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
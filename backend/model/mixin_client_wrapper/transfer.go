@@ -82,7 +82,9 @@ func (m *MixinClientWrapper) transferManyWithRetry(ctx context.Context, req *Tra
 	for i := 0; i < defaultMaxMixinRetry; i++ {
 		if _, err = m.transferMany(ctx, req); err != nil {
 			log.Error().Err(err).Msg("send transfer many failed, retrying...")
-			time.Sleep(time.Second << i)
+			if err := sleepContext(ctx, time.Second<<i); err != nil {
+				return err
+			}
 			continue
 		} else {
 			return nil
@@ -96,7 +98,9 @@ func (m *MixinClientWrapper) TransferOneWithRetry(ctx context.Context, req *Tran
 	for i := 0; i < defaultMaxMixinRetry; i++ {
 		if _, err = m.transferOne(ctx, req); err != nil {
 			log.Error().Err(err).Msg("send transfer one failed, retrying...")
-			time.Sleep(time.Second << i)
+			if err := sleepContext(ctx, time.Second<<i); err != nil {
+				return err
+			}
 			continue
 		} else {
 			return nil
@@ -106,28 +110,13 @@ func (m *MixinClientWrapper) TransferOneWithRetry(ctx context.Context, req *Tran
 }
 
 func (m *MixinClientWrapper) transferOne(ctx context.Context, req *TransferOneRequest) (*mixin.SafeTransactionRequest, error) {
-	var err error
-	var utxos []*mixin.SafeUtxo
-
-	utxos, err = m.SyncArrgegateUtxos(ctx, req.AssetId)
-	if err != nil {
-		return nil, err
-	}
-
+	// utxo 的聚合由后台任务完成, 转账不等待聚合
 	m.transferMutex.Lock()
 	defer m.transferMutex.Unlock()
 
-	for i := 0; i < 3 && len(utxos) == 0; i++ {
-		utxos, _ = m.SafeListUtxos(ctx, mixin.SafeListUtxoOption{
-			Asset:     req.AssetId,
-			State:     mixin.SafeUtxoStateUnspent,
-			Threshold: 1,
-			Limit:     500,
-		})
-		if len(utxos) > 0 {
-			break
-		}
-		time.Sleep(time.Second << 1)
+	utxos, err := m.ListUnspentUtxos(ctx, req.AssetId)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(utxos) == 0 {
@@ -153,8 +142,8 @@ func (m *MixinClientWrapper) transferOne(ctx context.Context, req *TransferOneRe
 		useUtxos = append(useUtxos, utxo)
 
 		if len(useUtxos) > MAX_UTXO_NUM {
+			useAmount = useAmount.Sub(useUtxos[0].Amount)
 			useUtxos = useUtxos[1:]
-			useAmount = useAmount.Sub(utxos[0].Amount)
 		}
 
 		if useAmount.GreaterThanOrEqual(req.Amount) {
@@ -226,13 +215,7 @@ func (m *MixinClientWrapper) transferOne(ctx context.Context, req *TransferOneRe
 }
 
 func (m *MixinClientWrapper) transferMany(ctx context.Context, req *TransferManyRequest) (*mixin.SafeTransactionRequest, error) {
-	var utxos []*mixin.SafeUtxo
-	var err error
-	utxos, err = m.SyncArrgegateUtxos(ctx, req.AssetId)
-	if err != nil {
-		return nil, err
-	}
-
+	// utxo 的聚合由后台任务完成, 转账不等待聚合
 	m.transferMutex.Lock()
 	defer m.transferMutex.Unlock()
 
@@ -240,18 +223,13 @@ func (m *MixinClientWrapper) transferMany(ctx context.Context, req *TransferMany
 	lo.ForEach(req.MemberAmount, func(item MemberAmount, _ int) {
 		totalAmount = totalAmount.Add(item.Amount)
 	})
-	retryCount := 0
-	for len(utxos) == 0 && retryCount < 3 {
-		// 1. 将utxos聚合
-		utxos, _ = m.Client.SafeListUtxos(ctx, mixin.SafeListUtxoOption{
-			Asset:     req.AssetId,
-			State:     mixin.SafeUtxoStateUnspent,
-			Threshold: 1,
-			Limit:     500,
-		})
-		time.Sleep(time.Second << retryCount)
-		retryCount++
+	utxos, err := m.ListUnspentUtxos(ctx, req.AssetId)
+	if err != nil {
+		return nil, err
 	}
+	utxos = lo.Filter(utxos, func(utxo *mixin.SafeUtxo, _ int) bool {
+		return !utxo.InscriptionHash.HasValue()
+	})
 	if len(utxos) == 0 {
 		return nil, ErrNotEnoughUtxos
 	}
@@ -268,8 +246,8 @@ func (m *MixinClientWrapper) transferMany(ctx context.Context, req *TransferMany
 		useUtxos = append(useUtxos, utxo)
 
 		if len(useUtxos) > MAX_UTXO_NUM {
+			useAmount = useAmount.Sub(useUtxos[0].Amount)
 			useUtxos = useUtxos[1:]
-			useAmount = useAmount.Sub(utxos[0].Amount)
 		}
 
 		if useAmount.GreaterThanOrEqual(totalAmount) {
@@ -35,12 +35,52 @@ func (m *MixinClientWrapper) GetAsset(ctx context.Context, assetId string) (*mix
 	return asset, nil
 }
 
-// 获取某种资产的总数额
-// !!! TODO
+const listUtxosPageSize = 500
+
+// ListUnspentUtxos 分页读取机器人钱包所有未花费的 utxo, assetId 为空表示所有资产
+func (m *MixinClientWrapper) ListUnspentUtxos(ctx context.Context, assetId string) ([]*mixin.SafeUtxo, error) {
+	var (
+		utxos  []*mixin.SafeUtxo
+		seen   = make(map[string]bool)
+		offset uint64
+	)
+	for {
+		page, err := m.Client.SafeListUtxos(ctx, mixin.SafeListUtxoOption{
+			Asset:     assetId,
+			State:     mixin.SafeUtxoStateUnspent,
+			Threshold: 1,
+			Offset:    offset,
+			Limit:     listUtxosPageSize,
+			Order:     "ASC",
+		})
+		if err != nil {
+			return nil, err
+		}
+		// offset 为 sequence, 按 output id 去重, 不依赖边界是否包含
+		added := 0
+		for _, utxo := range page {
+			if !seen[utxo.OutputID] {
+				seen[utxo.OutputID] = true
+				utxos = append(utxos, utxo)
+				added++
+			}
+			offset = max(offset, utxo.Sequence)
+		}
+		if len(page) < listUtxosPageSize || added == 0 {
+			return utxos, nil
+		}
+	}
+}
+
+// GetAssetTotalAmount 机器人钱包中某种资产未花费 utxo 的总额
 func (m *MixinClientWrapper) GetAssetTotalAmount(ctx context.Context, assetId string) (decimal.Decimal, error) {
-	asset, err := m.Client.SafeReadAsset(ctx, assetId)
+	utxos, err := m.ListUnspentUtxos(ctx, assetId)
 	if err != nil {
 		return decimal.Zero, err
 	}
-	return asset.PriceBTC, nil
+	total := decimal.Zero
+	for _, utxo := range utxos {
+		total = total.Add(utxo.Amount)
+	}
+	return total, nil
 }
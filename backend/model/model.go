@@ -1,32 +1,64 @@
 package model
 
 import (
+	"errors"
 	"time"
 
 	"github.com/shopspring/decimal"
 )
 
 type User struct {
-	MixinUID       string    `json:"-" gorm:"type:varchar(36);column:mixin_uid"` // mixin id
-	IdentityNumber string    `json:"identityNumber" gorm:"type:varchar(255);column:identity_number"`
-	FullName       string    `json:"fullName" gorm:"type:varchar(255);column:full_name"`
-	AvatarUrl      string    `json:"avatarUrl" gorm:"type:varchar(255);column:avatar_url"`
-	Biography      string    `json:"biography" gorm:"type:text;column:biography"`
-	MixinCreatedAt time.Time `json:"-" gorm:"autoCreateTime;column:mixin_created_at"`
-	CreatedAt      time.Time `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP;column:created_at"`
-	UpdatedAt      time.Time `json:"updatedAt" gorm:"autoUpdateTime;column:updated_at"`
+	ID             uint64     `json:"-" gorm:"primaryKey;autoIncrement;column:id"`
+	MixinUID       string     `json:"-" gorm:"uniqueIndex:idx_users_mixin_uid;type:varchar(36);column:mixin_uid"` // mixin id
+	IdentityNumber string     `json:"identityNumber" gorm:"uniqueIndex:idx_users_identity_number;type:varchar(255);column:identity_number"`
+	FullName       string     `json:"fullName" gorm:"type:varchar(255);column:full_name"`
+	AvatarUrl      string     `json:"avatarUrl" gorm:"type:varchar(255);column:avatar_url"`
+	Biography      string     `json:"biography" gorm:"type:text;column:biography"`
+	Language       string     `json:"language,omitempty" gorm:"type:varchar(16);column:language"` // 通知和转账 memo 的语言, 为空时使用默认语言
+	MixinCreatedAt time.Time  `json:"-" gorm:"autoCreateTime;column:mixin_created_at"`
+	CreatedAt      time.Time  `json:"createdAt" gorm:"autoCreateTime;column:created_at"`
+	UpdatedAt      time.Time  `json:"updatedAt" gorm:"autoUpdateTime;column:updated_at"`
+	BannedAt       *time.Time `json:"bannedAt,omitempty" gorm:"column:banned_at"` // 封禁后不能登录, 名下项目不再接收捐赠
 }
 
+// ErrProjectHasDonations 项目已有捐赠记录, 只能归档不能删除
+var ErrProjectHasDonations = errors.New("project has donations")
+
 type Project struct {
-	PID            string    `json:"pid" gorm:"primaryKey;type:varchar(36);column:pid"`
-	Title          string    `json:"title" gorm:"type:varchar(255);column:title"`
-	Description    string    `json:"description,omitempty" gorm:"type:text;column:description"`
-	ImgUrl         string    `json:"imgUrl,omitempty" gorm:"type:varchar(255);column:img_url"`
-	Link           string    `json:"link,omitempty" gorm:"type:varchar(255);column:link"`
-	IdentityNumber string    `json:"identityNumber" gorm:"type:varchar(255);column:identity_number"`
-	MixinUID       string    `json:"-" gorm:"type:varchar(36);column:mixin_uid"` // mixin id
-	DonateCnt      int64     `json:"donateCnt" gorm:"column:donate_cnt"`         // 被捐赠次数
-	CreatedAt      time.Time `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP;column:created_at"`
+	PID            string          `json:"pid" gorm:"primaryKey;type:varchar(36);column:pid"`
+	Title          string          `json:"title" gorm:"type:varchar(255);column:title"`
+	Description    string          `json:"description,omitempty" gorm:"type:text;column:description"`
+	ImgUrl         string          `json:"imgUrl,omitempty" gorm:"type:varchar(255);column:img_url"`
+	Link           string          `json:"link,omitempty" gorm:"type:varchar(255);column:link"`
+	IdentityNumber string          `json:"identityNumber" gorm:"type:varchar(255);column:identity_number"`
+	MixinUID       string          `json:"-" gorm:"type:varchar(36);column:mixin_uid"`                         // mixin id
+	DonateCnt      int64           `json:"donateCnt" gorm:"column:donate_cnt"`                                 // 被捐赠次数
+	RaisedUSD      decimal.Decimal `json:"raisedUsd" gorm:"type:decimal(64,8);default:0;column:raised_usd"`    // 累计捐赠的 USD 价值
+	GoalAssetID    string          `json:"goalAssetId,omitempty" gorm:"type:varchar(36);column:goal_asset_id"` // 目标资产, 为空表示以 USD 计
+	GoalAmount     decimal.Decimal `json:"goalAmount" gorm:"type:decimal(64,8);default:0;column:goal_amount"`  // 募捐目标, 0 表示不设目标
+	StartAt        *time.Time      `json:"startAt,omitempty" gorm:"column:start_at"`                           // 募捐开始时间
+	EndAt          *time.Time      `json:"endAt,omitempty" gorm:"column:end_at"`                               // 募捐截止时间
+	ArchivedAt     *time.Time      `json:"archivedAt,omitempty" gorm:"index;column:archived_at"`               // 归档后不再接收捐赠
+	HiddenAt       *time.Time      `json:"hiddenAt,omitempty" gorm:"column:hidden_at"`                         // 管理员隐藏, 不出现在列表中
+	BannedAt       *time.Time      `json:"bannedAt,omitempty" gorm:"column:banned_at"`                         // 管理员封禁, 不再接收捐赠
+	CreatedAt      time.Time       `json:"createdAt" gorm:"autoCreateTime;column:created_at"`
+}
+
+// ProjectAlias 旧版 base64 链接 (按项目内容生成的 ID) 到 pid 的映射
+type ProjectAlias struct {
+	Alias     string    `json:"alias" gorm:"primaryKey;type:varchar(36);column:alias"`
+	PID       string    `json:"pid" gorm:"index;type:varchar(36);column:pid"`
+	CreatedAt time.Time `json:"createdAt" gorm:"autoCreateTime;column:created_at"`
+}
+
+// ProjectAssetTotal 项目按资产统计的累计捐赠
+type ProjectAssetTotal struct {
+	PID       string          `json:"pid" gorm:"primaryKey;type:varchar(36);column:pid"`
+	AssetID   string          `json:"assetId" gorm:"primaryKey;type:varchar(36);column:asset_id"`
+	Amount    decimal.Decimal `json:"amount" gorm:"type:decimal(64,8);column:amount"`
+	AmountUSD decimal.Decimal `json:"amountUsd" gorm:"type:decimal(64,8);column:amount_usd"` // 按捐赠时价格计算
+	DonateCnt int64           `json:"donateCnt" gorm:"column:donate_cnt"`
+	UpdatedAt time.Time       `json:"updatedAt" gorm:"autoUpdateTime;column:updated_at"`
 }
 
 type DonateAction struct {
@@ -35,7 +67,11 @@ type DonateAction struct {
 	IdentityNumber string          `json:"identityNumber" gorm:"type:varchar(255);column:identity_number"`
 	AssetID        string          `json:"assetId" gorm:"type:varchar(36);column:asset_id"`
 	Amount         decimal.Decimal `json:"amount" gorm:"type:decimal(64,8);column:amount"`
-	CreatedAt      time.Time       `json:"createdAt" gorm:"default:CURRENT_TIMESTAMP;column:created_at"`
+	AmountUSD      decimal.Decimal `json:"amountUsd" gorm:"type:decimal(64,8);default:0;column:amount_usd"`     // 按捐赠时价格计算
+	Message        string          `json:"message,omitempty" gorm:"type:text;column:message"`                   // 捐赠留言
+	Anonymous      bool            `json:"anonymous" gorm:"not null;default:false;column:anonymous"`            // 不公开捐赠者
+	ReferralCode   string          `json:"referralCode,omitempty" gorm:"type:varchar(64);column:referral_code"` // 推荐码
+	CreatedAt      time.Time       `json:"createdAt" gorm:"autoCreateTime;column:created_at"`
 }
 
 type Asset struct {
@@ -46,15 +82,185 @@ type Asset struct {
 	Symbol       string          `json:"symbol,omitempty" gorm:"column:symbol;type:varchar(255)"`
 	Name         string          `json:"name,omitempty" gorm:"column:name;type:varchar(255)"`
 	IconURL      string          `json:"iconUrl,omitempty" gorm:"column:icon_url;type:varchar(255)"`
-	PriceUSD     decimal.Decimal `json:"priceUsd,omitempty" gorm:"column:priceUsd;type:decimal(64,8)"`
+	PriceUSD     decimal.Decimal `json:"priceUsd,omitempty" gorm:"column:price_usd;type:decimal(64,8)"`
 }
 
 type Snapshot struct {
-	SnapshotId string          `gorm:"column:snapshot_id;primaryKey" json:"snapshotId"`
+	SnapshotId string          `gorm:"column:snapshot_id;primaryKey;type:varchar(36)" json:"snapshotId"`
 	RequestId  string          `gorm:"column:request_id;index;type:varchar(36)" json:"requestId"`
 	UserId     string          `gorm:"column:user_id;index;type:varchar(36)" json:"userId"`
 	AssetId    string          `gorm:"column:asset_id;index;type:varchar(36)" json:"assetId"`
 	Amount     decimal.Decimal `gorm:"column:amount;type:decimal(64,8)" json:"amount"`
 	Memo       string          `gorm:"column:memo;type:varchar(512)" json:"memo"`
-	CreatedAt  int64           `gorm:"column:created_at;type:int;not null" json:"createdAt"`
+	CreatedAt  int64           `gorm:"column:created_at;type:bigint;not null" json:"createdAt"`
+}
+
+const (
+	PayoutKindForward = "forward" // 转给项目方
+	PayoutKindRefund  = "refund"  // 退还给捐赠者
+
+	PayoutStatusPending   = "pending"
+	PayoutStatusSubmitted = "submitted"
+	PayoutStatusConfirmed = "confirmed"
+	PayoutStatusFailed    = "failed"
+)
+
+// Payout 出账记录, 转账提交前先落库, 由后台任务推进状态
+type Payout struct {
+	RequestId  string          `gorm:"column:request_id;primaryKey;type:varchar(36)" json:"requestId"`
+	SnapshotId string          `gorm:"column:snapshot_id;index;type:varchar(36)" json:"snapshotId"`
+	Kind       string          `gorm:"column:kind;type:varchar(16)" json:"kind"`
+	AssetId    string          `gorm:"column:asset_id;type:varchar(36)" json:"assetId"`
+	Amount     decimal.Decimal `gorm:"column:amount;type:decimal(64,8)" json:"amount"`
+	Member     string          `gorm:"column:member;type:varchar(36)" json:"member"`
+	PID        string          `gorm:"column:pid;type:varchar(36)" json:"pid,omitempty"` // 转给项目方时的项目
+	Memo       string          `gorm:"column:memo;type:varchar(512)" json:"memo"`
+	Status     string          `gorm:"column:status;index;type:varchar(16)" json:"status"`
+	Attempts   int             `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	LastError  string          `gorm:"column:last_error;type:text" json:"lastError,omitempty"`
+	CreatedAt  int64           `gorm:"column:created_at;not null" json:"createdAt"`
+	UpdatedAt  int64           `gorm:"column:updated_at;not null" json:"updatedAt"`
+}
+
+const (
+	SyncStateSnapshotCursor = "snapshot_cursor" // 已处理到的 snapshot created_at
+	// 加上资产 id, 记录该资产最近一次无法读完的 snapshot 时间点
+	SyncStateSnapshotGap = "snapshot_gap:"
+)
+
+// SyncState 后台任务的同步进度
+type SyncState struct {
+	Name      string `gorm:"column:name;primaryKey;type:varchar(64)" json:"name"`
+	Value     string `gorm:"column:value;type:varchar(255)" json:"value"`
+	UpdatedAt int64  `gorm:"column:updated_at;not null" json:"updatedAt"`
+}
+
+// AdminAudit 管理员操作记录
+type AdminAudit struct {
+	ID        uint64 `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Operator  string `gorm:"column:operator;index;type:varchar(64)" json:"operator"` // admin access key
+	Action    string `gorm:"column:action;type:varchar(128)" json:"action"`          // method + 路由
+	Target    string `gorm:"column:target;type:varchar(255)" json:"target"`          // 请求路径
+	Params    string `gorm:"column:params;type:text" json:"params"`                  // query 和请求体
+	Status    int    `gorm:"column:status" json:"status"`                            // 响应状态码
+	CreatedAt int64  `gorm:"column:created_at;index;not null" json:"createdAt"`
+}
+
+const (
+	WebhookEventDonation = "donation.created"
+
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook 项目方登记的回调地址, 收到捐赠时推送
+type Webhook struct {
+	ID             string `gorm:"column:id;primaryKey;type:varchar(36)" json:"id"`
+	PID            string `gorm:"column:pid;index;type:varchar(36)" json:"pid"`
+	URL            string `gorm:"column:url;type:varchar(512)" json:"url"`
+	Secret         string `gorm:"column:secret;type:varchar(128)" json:"-"`          // 签名密钥, 只在创建和轮换时返回
+	PreviousSecret string `gorm:"column:previous_secret;type:varchar(128)" json:"-"` // 轮换前的密钥, 过渡期内同时签名
+	RotatedAt      int64  `gorm:"column:rotated_at;not null;default:0" json:"rotatedAt,omitempty"`
+	Disabled       bool   `gorm:"column:disabled;not null;default:false" json:"disabled"` // 停用后不再创建投递
+	CreatedAt      int64  `gorm:"column:created_at;not null" json:"createdAt"`
+	UpdatedAt      int64  `gorm:"column:updated_at;not null" json:"updatedAt"`
+}
+
+// WebhookDelivery 一次推送, 落库后由后台任务投递, 失败按退避时间重试
+type WebhookDelivery struct {
+	ID             string `gorm:"column:id;primaryKey;type:varchar(36)" json:"id"`
+	WebhookID      string `gorm:"column:webhook_id;index;type:varchar(36)" json:"webhookId"`
+	PID            string `gorm:"column:pid;type:varchar(36)" json:"pid"`
+	Event          string `gorm:"column:event;type:varchar(32)" json:"event"`
+	Payload        string `gorm:"column:payload;type:text" json:"payload"`
+	ReplayOf       string `gorm:"column:replay_of;type:varchar(36)" json:"replayOf,omitempty"` // 重放的原投递
+	Status         string `gorm:"column:status;index:idx_webhook_deliveries_due;type:varchar(16)" json:"status"`
+	Attempts       int    `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	NextAttemptAt  int64  `gorm:"column:next_attempt_at;index:idx_webhook_deliveries_due;not null" json:"nextAttemptAt"`
+	ResponseStatus int    `gorm:"column:response_status" json:"responseStatus,omitempty"`       // 最近一次响应的状态码
+	ResponseBody   string `gorm:"column:response_body;type:text" json:"responseBody,omitempty"` // 最近一次响应, 截断保存
+	LastError      string `gorm:"column:last_error;type:text" json:"lastError,omitempty"`
+	DeliveredAt    int64  `gorm:"column:delivered_at;not null;default:0" json:"deliveredAt,omitempty"`
+	CreatedAt      int64  `gorm:"column:created_at;index;not null" json:"createdAt"`
+	UpdatedAt      int64  `gorm:"column:updated_at;not null" json:"updatedAt"`
+}
+
+// Reconciliation 一次钱包对账中某个资产的结果, 同一次对账的记录 RunID 相同
+type Reconciliation struct {
+	ID             uint64          `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	RunID          string          `gorm:"column:run_id;index;type:varchar(36)" json:"runId"`
+	AssetID        string          `gorm:"column:asset_id;index;type:varchar(36)" json:"assetId"`
+	Received       decimal.Decimal `gorm:"column:received;type:decimal(64,8)" json:"received"`              // 入账的 snapshot
+	Paid           decimal.Decimal `gorm:"column:paid;type:decimal(64,8)" json:"paid"`                      // 已确认的出账和手续费
+	Pending        decimal.Decimal `gorm:"column:pending;type:decimal(64,8)" json:"pending"`                // 未完成的出账和聚合, 可能已花费 utxo
+	Expected       decimal.Decimal `gorm:"column:expected;type:decimal(64,8)" json:"expected"`              // 账面应持有, Received - Paid
+	Actual         decimal.Decimal `gorm:"column:actual;type:decimal(64,8)" json:"actual"`                  // 钱包中未花费的 utxo
+	Difference     decimal.Decimal `gorm:"column:difference;type:decimal(64,8)" json:"difference"`          // Actual - Expected
+	Discrepancy    decimal.Decimal `gorm:"column:discrepancy;type:decimal(64,8)" json:"discrepancy"`        // 扣除未完成的出账后仍无法解释的差额
+	DiscrepancyUSD decimal.Decimal `gorm:"column:discrepancy_usd;type:decimal(64,8)" json:"discrepancyUsd"` // 按当前价格计算, 没有价格时为 0
+	Exceeded       bool            `gorm:"column:exceeded;not null;default:false" json:"exceeded"`          // 差额超过告警阈值
+	CreatedAt      int64           `gorm:"column:created_at;not null" json:"createdAt"`
+}
+
+// AssetLedger 按资产汇总的账面数据
+type AssetLedger struct {
+	AssetID  string
+	Received decimal.Decimal // 入账的 snapshot
+	Paid     decimal.Decimal // 已确认的出账
+	Pending  decimal.Decimal // 未完成 (pending / submitted) 的出账
+}
+
+const (
+	LedgerKindDeposit       = "deposit"       // 收到 snapshot
+	LedgerKindDonation      = "donation"      // 捐赠计入项目
+	LedgerKindForward       = "forward"       // 转给项目方
+	LedgerKindRefund        = "refund"        // 退还给捐赠者
+	LedgerKindConsolidation = "consolidation" // 钱包内聚合 utxo
+	LedgerKindFee           = "fee"           // 网络收取的手续费
+
+	LedgerAccountWallet = "platform:wallet" // 机器人钱包持有的资产
+	LedgerAccountFee    = "platform:fee"    // 平台支付的手续费
+)
+
+// LedgerEntry 复式记账的分录, 借记为正, 贷记为负
+// 同一笔交易 (TxID 相同) 每个资产的分录之和为 0, 交易以 TxID 保证幂等
+type LedgerEntry struct {
+	ID        uint64          `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	TxID      string          `gorm:"column:tx_id;uniqueIndex:idx_ledger_entries_tx_line;type:varchar(64)" json:"txId"`
+	Line      int             `gorm:"column:line;uniqueIndex:idx_ledger_entries_tx_line;not null" json:"line"`
+	Kind      string          `gorm:"column:kind;type:varchar(16)" json:"kind"`
+	Account   string          `gorm:"column:account;index;type:varchar(64)" json:"account"` // platform:*, user:{uid} 或 project:{pid}
+	AssetID   string          `gorm:"column:asset_id;index;type:varchar(36)" json:"assetId"`
+	Amount    decimal.Decimal `gorm:"column:amount;type:decimal(64,8)" json:"amount"`
+	Ref       string          `gorm:"column:ref;type:varchar(64)" json:"ref"` // snapshot id 或 payout 的 request id
+	CreatedAt int64           `gorm:"column:created_at;index;not null" json:"createdAt"`
+}
+
+// LedgerBalance 账户在某个资产上的余额, 用户和项目的余额为负表示平台代为持有
+type LedgerBalance struct {
+	Account string          `json:"account,omitempty"`
+	AssetID string          `json:"assetId"`
+	Amount  decimal.Decimal `json:"amount"`
+}
+
+const (
+	ConsolidationStatusPending   = "pending"
+	ConsolidationStatusSubmitted = "submitted"
+	ConsolidationStatusConfirmed = "confirmed"
+	ConsolidationStatusFailed    = "failed"
+)
+
+// Consolidation 把同一资产的小额 utxo 合并为一个的交易, request id 由输入确定性生成
+type Consolidation struct {
+	RequestId string          `gorm:"column:request_id;primaryKey;type:varchar(36)" json:"requestId"`
+	AssetId   string          `gorm:"column:asset_id;index;type:varchar(36)" json:"assetId"`
+	Inputs    int             `gorm:"column:inputs;not null" json:"inputs"` // 合并的 utxo 数量
+	Amount    decimal.Decimal `gorm:"column:amount;type:decimal(64,8)" json:"amount"`
+	Outputs   string          `gorm:"column:outputs;type:text" json:"-"` // 输入 utxo 的 output id, 以逗号分隔
+	Status    string          `gorm:"column:status;index;type:varchar(16)" json:"status"`
+	Attempts  int             `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	LastError string          `gorm:"column:last_error;type:text" json:"lastError,omitempty"`
+	CreatedAt int64           `gorm:"column:created_at;not null" json:"createdAt"`
+	UpdatedAt int64           `gorm:"column:updated_at;not null" json:"updatedAt"`
 }
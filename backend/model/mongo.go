@@ -0,0 +1,243 @@
+package model
+
+import (
+	"context"
+	"donate/pkg/bigdecimal"
+	"donate/pkg/muuid"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+)
+
+// mongo 的集合名与 sql 的表名相同
+const (
+	mongoUsers              = "users"
+	mongoProjects           = "projects"
+	mongoProjectAliases     = "project_aliases"
+	mongoProjectAssetTotals = "project_asset_totals"
+	mongoDonateActions      = "donate_actions"
+	mongoAssets             = "assets"
+	mongoSnapshots          = "snapshots"
+	mongoPayouts            = "payouts"
+	mongoSyncStates         = "sync_states"
+	mongoAdminAudits        = "admin_audits"
+	mongoWebhooks           = "webhooks"
+	mongoWebhookDeliveries  = "webhook_deliveries"
+	mongoReconciliations    = "reconciliations"
+	mongoLedgerEntries      = "ledger_entries"
+	mongoConsolidations     = "consolidations"
+	mongoCounters           = "counters" // 自增 id
+)
+
+// MongoRegistry decimal 以 Decimal128, uuid 以 binary 存储
+// 结构体的字段名取 gorm 的 column, 与 sql 的列名一致
+func MongoRegistry() *bsoncodec.Registry {
+	reg := bson.NewRegistry()
+	reg.RegisterTypeEncoder(reflect.TypeOf(decimal.Decimal{}), &bigdecimal.MongoDecimal{})
+	reg.RegisterTypeDecoder(reflect.TypeOf(decimal.Decimal{}), &bigdecimal.MongoDecimal{})
+	reg.RegisterTypeEncoder(reflect.TypeOf(uuid.UUID{}), &muuid.MongoUUID{})
+	reg.RegisterTypeDecoder(reflect.TypeOf(uuid.UUID{}), &muuid.MongoUUID{})
+
+	structCodec, err := bsoncodec.NewStructCodec(bsoncodec.StructTagParserFunc(gormColumnTagParser))
+	if err != nil {
+		panic(err)
+	}
+	reg.RegisterKindEncoder(reflect.Struct, structCodec)
+	reg.RegisterKindDecoder(reflect.Struct, structCodec)
+	return reg
+}
+
+// gormColumnTagParser 优先使用 bson tag, 其次是 gorm 的 column
+func gormColumnTagParser(sf reflect.StructField) (bsoncodec.StructTags, error) {
+	if _, ok := sf.Tag.Lookup("bson"); ok {
+		return bsoncodec.DefaultStructTagParser(sf)
+	}
+
+	tag := sf.Tag.Get("gorm")
+	if tag == "-" {
+		return bsoncodec.StructTags{Skip: true}, nil
+	}
+	for _, part := range strings.Split(tag, ";") {
+		if name, ok := strings.CutPrefix(part, "column:"); ok {
+			return bsoncodec.StructTags{Name: name}, nil
+		}
+	}
+	return bsoncodec.DefaultStructTagParser(sf)
+}
+
+// OpenMongo 连接 mongo, 并创建需要的索引
+func OpenMongo(ctx context.Context, uri, database string) (*mongo.Client, *mongo.Database, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetRegistry(MongoRegistry()))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		_ = client.Disconnect(ctx)
+		return nil, nil, err
+	}
+
+	db := client.Database(database)
+	if err := EnsureMongoIndexes(ctx, db); err != nil {
+		_ = client.Disconnect(ctx)
+		return nil, nil, err
+	}
+	return client, db, nil
+}
+
+// EnsureMongoIndexes 创建唯一索引和查询用到的索引, 已存在时不做修改
+func EnsureMongoIndexes(ctx context.Context, db *mongo.Database) error {
+	unique := options.Index().SetUnique(true)
+	indexes := map[string][]mongo.IndexModel{
+		mongoUsers: {
+			{Keys: bson.D{{Key: "id", Value: 1}}, Options: unique},
+			{Keys: bson.D{{Key: "mixin_uid", Value: 1}}, Options: unique},
+			{Keys: bson.D{{Key: "identity_number", Value: 1}}, Options: unique},
+		},
+		mongoProjects: {
+			{Keys: bson.D{{Key: "pid", Value: 1}}, Options: unique},
+			{Keys: bson.D{{Key: "identity_number", Value: 1}}},
+		},
+		mongoProjectAliases: {
+			{Keys: bson.D{{Key: "alias", Value: 1}}, Options: unique},
+			{Keys: bson.D{{Key: "pid", Value: 1}}},
+		},
+		mongoProjectAssetTotals: {
+			{Keys: bson.D{{Key: "pid", Value: 1}, {Key: "asset_id", Value: 1}}, Options: unique},
+		},
+		mongoDonateActions: {
+			{Keys: bson.D{{Key: "id", Value: 1}, {Key: "pid", Value: 1}}, Options: unique},
+			{Keys: bson.D{{Key: "pid", Value: 1}, {Key: "created_at", Value: -1}}},
+			{Keys: bson.D{{Key: "identity_number", Value: 1}}},
+		},
+		mongoAssets: {
+			{Keys: bson.D{{Key: "asset_id", Value: 1}}, Options: unique},
+		},
+		mongoSnapshots: {
+			{Keys: bson.D{{Key: "snapshot_id", Value: 1}}, Options: unique},
+			{Keys: bson.D{{Key: "created_at", Value: -1}}},
+		},
+		mongoPayouts: {
+			{Keys: bson.D{{Key: "request_id", Value: 1}}, Options: unique},
+			{Keys: bson.D{{Key: "snapshot_id", Value: 1}}},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+		},
+		mongoSyncStates: {
+			{Keys: bson.D{{Key: "name", Value: 1}}, Options: unique},
+		},
+		mongoAdminAudits: {
+			{Keys: bson.D{{Key: "id", Value: 1}}, Options: unique},
+			{Keys: bson.D{{Key: "operator", Value: 1}}},
+		},
+		mongoWebhooks: {
+			{Keys: bson.D{{Key: "id", Value: 1}}, Options: unique},
+			{Keys: bson.D{{Key: "pid", Value: 1}}},
+		},
+		mongoWebhookDeliveries: {
+			{Keys: bson.D{{Key: "id", Value: 1}}, Options: unique},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+			{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		},
+		mongoReconciliations: {
+			{Keys: bson.D{{Key: "id", Value: 1}}, Options: unique},
+			{Keys: bson.D{{Key: "run_id", Value: 1}}},
+			{Keys: bson.D{{Key: "asset_id", Value: 1}, {Key: "id", Value: -1}}},
+		},
+		mongoLedgerEntries: {
+			{Keys: bson.D{{Key: "tx_id", Value: 1}, {Key: "line", Value: 1}}, Options: unique},
+			{Keys: bson.D{{Key: "account", Value: 1}, {Key: "created_at", Value: 1}}},
+			{Keys: bson.D{{Key: "asset_id", Value: 1}}},
+		},
+		mongoConsolidations: {
+			{Keys: bson.D{{Key: "request_id", Value: 1}}, Options: unique},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+			{Keys: bson.D{{Key: "created_at", Value: -1}}},
+		},
+	}
+
+	for name, models := range indexes {
+		if _, err := db.Collection(name).Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mongoNotFound 与 gorm 的实现返回相同的错误, 调用方不需要区分存储
+func mongoNotFound(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return gorm.ErrRecordNotFound
+	}
+	return err
+}
+
+func mongoFindOne[T any](ctx context.Context, coll *mongo.Collection, filter interface{}, opts ...*options.FindOneOptions) (*T, error) {
+	var item T
+	if err := coll.FindOne(ctx, filter, opts...).Decode(&item); err != nil {
+		return nil, mongoNotFound(err)
+	}
+	return &item, nil
+}
+
+func mongoFind[T any](ctx context.Context, coll *mongo.Collection, filter interface{}, opts ...*options.FindOptions) ([]*T, error) {
+	cursor, err := coll.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	var items []*T
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// mongoPage 对应 sql 的 order / limit / offset
+func mongoPage(sort bson.D, limit, offset int64) *options.FindOptions {
+	opts := options.Find().SetSort(sort)
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	if offset > 0 {
+		opts.SetSkip(offset)
+	}
+	return opts
+}
+
+// mongoNextID 生成 name 对应的自增 id
+func mongoNextID(ctx context.Context, db *mongo.Database, name string) (uint64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := db.Collection(mongoCounters).FindOneAndUpdate(ctx,
+		bson.M{"_id": name},
+		bson.M{"$inc": bson.M{"seq": int64(1)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(counter.Seq), nil
+}
+
+// mongoTx 在事务中执行 fn, 需要 mongo 以副本集方式部署
+func mongoTx(ctx context.Context, db *mongo.Database, fn func(ctx mongo.SessionContext) error) error {
+	return db.Client().UseSession(ctx, func(sc mongo.SessionContext) error {
+		_, err := sc.WithTransaction(sc, func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sc)
+		})
+		return err
+	})
+}
+
+// mongoExists 是否存在满足 filter 的文档
+func mongoExists(ctx context.Context, coll *mongo.Collection, filter interface{}) (bool, error) {
+	n, err := coll.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	return n > 0, err
+}
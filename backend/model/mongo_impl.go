@@ -0,0 +1,921 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewMongoStore 以 mongo 实现的 Store, db 需要使用 MongoRegistry 连接
+func NewMongoStore(db *mongo.Database) Store {
+	s := &mongoStore{db: db}
+	return Store{
+		UserStore:           &mongoUserStore{s},
+		ProjectStore:        &mongoProjectStore{s},
+		DonateActionStore:   &mongoDonateActionStore{s},
+		AssetStore:          &mongoAssetStore{s},
+		SnapshotStore:       &mongoSnapshotStore{s},
+		PayoutStore:         &mongoPayoutStore{s},
+		SyncStateStore:      &mongoSyncStateStore{s},
+		DonationStore:       &mongoDonationStore{s},
+		AdminAuditStore:     &mongoAdminAuditStore{s},
+		WebhookStore:        &mongoWebhookStore{s},
+		ReconciliationStore: &mongoReconciliationStore{s},
+		LedgerStore:         &mongoLedgerStore{s},
+		ConsolidationStore:  &mongoConsolidationStore{s},
+	}
+}
+
+type mongoStore struct {
+	db *mongo.Database
+}
+
+func (s *mongoStore) coll(name string) *mongo.Collection {
+	return s.db.Collection(name)
+}
+
+// User 实现
+type mongoUserStore struct {
+	*mongoStore
+}
+
+func (s *mongoUserStore) AddUser(ctx context.Context, user *User) error {
+	id, err := mongoNextID(ctx, s.db, mongoUsers)
+	if err != nil {
+		return err
+	}
+	user.ID = id
+	now := time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	if user.MixinCreatedAt.IsZero() {
+		user.MixinCreatedAt = now
+	}
+	if user.UpdatedAt.IsZero() {
+		user.UpdatedAt = now
+	}
+	_, err = s.coll(mongoUsers).InsertOne(ctx, user)
+	return err
+}
+
+func (s *mongoUserStore) ListUsers(ctx context.Context) ([]*User, error) {
+	return mongoFind[User](ctx, s.coll(mongoUsers), bson.M{})
+}
+
+func (s *mongoUserStore) GetUserByDID(ctx context.Context, did string) (*User, error) {
+	return mongoFindOne[User](ctx, s.coll(mongoUsers), bson.M{"did": did})
+}
+
+func (s *mongoUserStore) GetUserByUID(ctx context.Context, mixin_uid string) (*User, error) {
+	return mongoFindOne[User](ctx, s.coll(mongoUsers), bson.M{"mixin_uid": mixin_uid})
+}
+
+func (s *mongoUserStore) GetUserByIdentityNumber(ctx context.Context, ident string) (*User, error) {
+	return mongoFindOne[User](ctx, s.coll(mongoUsers), bson.M{"identity_number": ident})
+}
+
+func (s *mongoUserStore) ListUsersByIdentityNumbers(ctx context.Context, idents []string) ([]*User, error) {
+	if len(idents) == 0 {
+		return nil, nil
+	}
+	return mongoFind[User](ctx, s.coll(mongoUsers), bson.M{"identity_number": bson.M{"$in": lo.Uniq(idents)}})
+}
+
+func (s *mongoUserStore) UpdateUserBymuid(ctx context.Context, mixin_uid string, user *User) error {
+	// 与 gorm 的 Updates 一致, 只更新非零值字段
+	set := bson.M{"updated_at": time.Now()}
+	for name, value := range map[string]string{
+		"identity_number": user.IdentityNumber,
+		"full_name":       user.FullName,
+		"avatar_url":      user.AvatarUrl,
+		"biography":       user.Biography,
+		"language":        user.Language,
+	} {
+		if value != "" {
+			set[name] = value
+		}
+	}
+	if !user.MixinCreatedAt.IsZero() {
+		set["mixin_created_at"] = user.MixinCreatedAt
+	}
+	_, err := s.coll(mongoUsers).UpdateMany(ctx, bson.M{"mixin_uid": mixin_uid}, bson.M{"$set": set})
+	return err
+}
+
+func (s *mongoUserStore) UpdateUserBanned(ctx context.Context, mixin_uid string, bannedAt *time.Time) error {
+	_, err := s.coll(mongoUsers).UpdateMany(ctx, bson.M{"mixin_uid": mixin_uid}, bson.M{"$set": bson.M{"banned_at": bannedAt}})
+	return err
+}
+
+// Project 实现
+type mongoProjectStore struct {
+	*mongoStore
+}
+
+func (s *mongoProjectStore) AddProject(ctx context.Context, project *Project, aliases ...string) error {
+	if project.CreatedAt.IsZero() {
+		project.CreatedAt = time.Now()
+	}
+	return mongoTx(ctx, s.db, func(sc mongo.SessionContext) error {
+		if _, err := s.coll(mongoProjects).InsertOne(sc, project); err != nil {
+			return err
+		}
+		for _, alias := range aliases {
+			if _, err := s.coll(mongoProjectAliases).InsertOne(sc, &ProjectAlias{Alias: alias, PID: project.PID, CreatedAt: project.CreatedAt}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *mongoProjectStore) DeleteProject(ctx context.Context, id string) error {
+	return mongoTx(ctx, s.db, func(sc mongo.SessionContext) error {
+		exists, err := mongoExists(sc, s.coll(mongoDonateActions), bson.M{"pid": id})
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrProjectHasDonations
+		}
+		if _, err := s.coll(mongoProjectAliases).DeleteMany(sc, bson.M{"pid": id}); err != nil {
+			return err
+		}
+		_, err = s.coll(mongoProjects).DeleteOne(sc, bson.M{"pid": id})
+		return err
+	})
+}
+
+func (s *mongoProjectStore) UpdateProject(ctx context.Context, project *Project) error {
+	_, err := s.coll(mongoProjects).UpdateOne(ctx, bson.M{"pid": project.PID}, bson.M{"$set": bson.M{
+		"title":         project.Title,
+		"description":   project.Description,
+		"img_url":       project.ImgUrl,
+		"link":          project.Link,
+		"goal_asset_id": project.GoalAssetID,
+		"goal_amount":   project.GoalAmount,
+		"start_at":      project.StartAt,
+		"end_at":        project.EndAt,
+	}})
+	return err
+}
+
+func (s *mongoProjectStore) ArchiveProject(ctx context.Context, pid string, at time.Time) error {
+	_, err := s.coll(mongoProjects).UpdateOne(ctx, bson.M{"pid": pid}, bson.M{"$set": bson.M{"archived_at": at}})
+	return err
+}
+
+func (s *mongoProjectStore) UpdateProjectModeration(ctx context.Context, pid string, hiddenAt, bannedAt *time.Time) error {
+	_, err := s.coll(mongoProjects).UpdateOne(ctx, bson.M{"pid": pid}, bson.M{"$set": bson.M{
+		"hidden_at": hiddenAt,
+		"banned_at": bannedAt,
+	}})
+	return err
+}
+
+func (s *mongoProjectStore) AddProjectAlias(ctx context.Context, pid, alias string) error {
+	_, err := s.coll(mongoProjectAliases).InsertOne(ctx, &ProjectAlias{Alias: alias, PID: pid, CreatedAt: time.Now()})
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *mongoProjectStore) GetProjectByAlias(ctx context.Context, alias string) (*Project, error) {
+	item, err := mongoFindOne[ProjectAlias](ctx, s.coll(mongoProjectAliases), bson.M{"alias": alias})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetProject(ctx, item.PID)
+}
+
+// publicProjectFilter 与 publicProjectCond 相同
+func (s *mongoProjectStore) publicProjectFilter(ctx context.Context) (bson.M, error) {
+	banned, err := s.coll(mongoUsers).Distinct(ctx, "mixin_uid", bson.M{"banned_at": bson.M{"$ne": nil}})
+	if err != nil {
+		return nil, err
+	}
+	if banned == nil {
+		banned = []interface{}{}
+	}
+	return bson.M{
+		"archived_at": nil,
+		"hidden_at":   nil,
+		"banned_at":   nil,
+		"mixin_uid":   bson.M{"$nin": banned},
+	}, nil
+}
+
+func (s *mongoProjectStore) ListProjects(ctx context.Context, q *ProjectQuery) ([]*Project, *Cursor, error) {
+	column, value, err := q.sort()
+	if err != nil {
+		return nil, nil, err
+	}
+	filter, err := s.publicProjectFilter(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if q.IdentityNumber != "" {
+		filter["identity_number"] = q.IdentityNumber
+	}
+	var offset int64
+	if q.Cursor == nil {
+		offset = q.Offset
+	}
+	sort := mongoKeyset(filter, column, "pid", false, value, q.Cursor.id())
+	projects, err := mongoFind[Project](ctx, s.coll(mongoProjects), filter, mongoPage(sort, int64(pageLimit(q.Limit)), offset))
+	if err != nil {
+		return nil, nil, err
+	}
+	projects, next := pageOf(projects, q.Limit, projectCursor(column))
+	return projects, next, nil
+}
+
+func (s *mongoProjectStore) GetProject(ctx context.Context, pid string) (*Project, error) {
+	return mongoFindOne[Project](ctx, s.coll(mongoProjects), bson.M{"pid": pid})
+}
+
+func (s *mongoProjectStore) ListProjectsByPIDs(ctx context.Context, pids []string) ([]*Project, error) {
+	if len(pids) == 0 {
+		return nil, nil
+	}
+	return mongoFind[Project](ctx, s.coll(mongoProjects), bson.M{"pid": bson.M{"$in": lo.Uniq(pids)}})
+}
+
+func (s *mongoProjectStore) IncrProjectDonateCnt(ctx context.Context, pid string) error {
+	_, err := s.coll(mongoProjects).UpdateOne(ctx, bson.M{"pid": pid}, bson.M{"$inc": bson.M{"donate_cnt": int64(1)}})
+	return err
+}
+
+func (s *mongoProjectStore) ListProjectAssetTotals(ctx context.Context, pid string) ([]*ProjectAssetTotal, error) {
+	return mongoFind[ProjectAssetTotal](ctx, s.coll(mongoProjectAssetTotals), bson.M{"pid": pid},
+		options.Find().SetSort(bson.D{{Key: "amount_usd", Value: -1}}))
+}
+
+func (s *mongoProjectStore) ListProjectAssetTotalsByPIDs(ctx context.Context, pids []string) ([]*ProjectAssetTotal, error) {
+	if len(pids) == 0 {
+		return nil, nil
+	}
+	return mongoFind[ProjectAssetTotal](ctx, s.coll(mongoProjectAssetTotals), bson.M{"pid": bson.M{"$in": lo.Uniq(pids)}},
+		options.Find().SetSort(bson.D{{Key: "pid", Value: 1}, {Key: "amount_usd", Value: -1}}))
+}
+
+// DonateAction 实现
+type mongoDonateActionStore struct {
+	*mongoStore
+}
+
+func (s *mongoDonateActionStore) AddDonateAction(ctx context.Context, action *DonateAction) error {
+	if action.CreatedAt.IsZero() {
+		action.CreatedAt = time.Now()
+	}
+	_, err := s.coll(mongoDonateActions).InsertOne(ctx, action)
+	return err
+}
+
+func (s *mongoDonateActionStore) QueryDonateActionsByIdentityNumber(ctx context.Context, ident string) ([]*DonateAction, error) {
+	return mongoFind[DonateAction](ctx, s.coll(mongoDonateActions), bson.M{"identity_number": ident})
+}
+
+func (s *mongoDonateActionStore) QueryDonateActionsByPID(ctx context.Context, pid string) ([]*DonateAction, error) {
+	return mongoFind[DonateAction](ctx, s.coll(mongoDonateActions), bson.M{"pid": pid})
+}
+
+func (s *mongoDonateActionStore) QueryDonateActions(ctx context.Context, q *DonateActionQuery) ([]*DonateAction, *Cursor, error) {
+	column, value, err := q.sort()
+	if err != nil {
+		return nil, nil, err
+	}
+	filter := bson.M{}
+	if q.PID != "" {
+		filter["pid"] = q.PID
+	}
+	if q.IdentityNumber != "" {
+		filter["identity_number"] = q.IdentityNumber
+	}
+	if q.AssetID != "" {
+		filter["asset_id"] = q.AssetID
+	}
+	createdAt := bson.M{}
+	if !q.Since.IsZero() {
+		createdAt["$gte"] = q.Since
+	}
+	if !q.Until.IsZero() {
+		createdAt["$lt"] = q.Until
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+	if q.MinAmount.IsPositive() {
+		filter["amount"] = bson.M{"$gte": q.MinAmount}
+	}
+	if q.ExcludeAnonymous {
+		filter["anonymous"] = false
+	}
+	sort := mongoKeyset(filter, column, "id", q.Asc, value, q.Cursor.id())
+	actions, err := mongoFind[DonateAction](ctx, s.coll(mongoDonateActions), filter, mongoPage(sort, int64(pageLimit(q.Limit)), 0))
+	if err != nil {
+		return nil, nil, err
+	}
+	actions, next := pageOf(actions, q.Limit, donateActionCursor(column, q.Asc))
+	return actions, next, nil
+}
+
+// Asset 实现
+type mongoAssetStore struct {
+	*mongoStore
+}
+
+func (s *mongoAssetStore) ListAssets(ctx context.Context) ([]*Asset, error) {
+	return mongoFind[Asset](ctx, s.coll(mongoAssets), bson.M{})
+}
+
+func (s *mongoAssetStore) GetAsset(ctx context.Context, id string) (*Asset, error) {
+	return mongoFindOne[Asset](ctx, s.coll(mongoAssets), bson.M{"asset_id": id})
+}
+
+func (s *mongoAssetStore) AddAsset(ctx context.Context, asset *Asset) error {
+	_, err := s.coll(mongoAssets).InsertOne(ctx, asset)
+	return err
+}
+
+// Snapshot 实现
+type mongoSnapshotStore struct {
+	*mongoStore
+}
+
+func (s *mongoSnapshotStore) UpsertSnapshot(ctx context.Context, snapshot *Snapshot) error {
+	_, err := s.coll(mongoSnapshots).ReplaceOne(ctx, bson.M{"snapshot_id": snapshot.SnapshotId}, snapshot, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *mongoSnapshotStore) GetSnapshotCount(ctx context.Context) (int64, error) {
+	return s.coll(mongoSnapshots).CountDocuments(ctx, bson.M{})
+}
+
+func (s *mongoSnapshotStore) InsertSnapshot(ctx context.Context, snapshot *Snapshot) error {
+	_, err := s.coll(mongoSnapshots).InsertOne(ctx, snapshot)
+	return err
+}
+
+func (s *mongoSnapshotStore) GetSnapshotById(ctx context.Context, snapshotId string) (*Snapshot, error) {
+	return mongoFindOne[Snapshot](ctx, s.coll(mongoSnapshots), bson.M{"snapshot_id": snapshotId})
+}
+
+func (s *mongoSnapshotStore) GetLastestSnapshot(ctx context.Context) (*Snapshot, error) {
+	return mongoFindOne[Snapshot](ctx, s.coll(mongoSnapshots), bson.M{},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+}
+
+func (s *mongoSnapshotStore) ListSnapshots(ctx context.Context, limit int64, cursor *Cursor) ([]*Snapshot, *Cursor, error) {
+	value, err := cursor.value("created_at", false, parseIntKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	filter := bson.M{}
+	sort := mongoKeyset(filter, "created_at", "snapshot_id", false, value, cursor.id())
+	snapshots, err := mongoFind[Snapshot](ctx, s.coll(mongoSnapshots), filter, mongoPage(sort, int64(pageLimit(limit)), 0))
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshots, next := pageOf(snapshots, limit, snapshotCursor)
+	return snapshots, next, nil
+}
+
+// Payout 实现
+type mongoPayoutStore struct {
+	*mongoStore
+}
+
+func (s *mongoPayoutStore) CreatePayout(ctx context.Context, payout *Payout) error {
+	return insertPayout(ctx, s.coll(mongoPayouts), payout)
+}
+
+// insertPayout 与 gorm 的 autoCreateTime 一致补齐时间, request_id 已存在时忽略
+func insertPayout(ctx context.Context, coll *mongo.Collection, payout *Payout) error {
+	now := time.Now().Unix()
+	if payout.CreatedAt == 0 {
+		payout.CreatedAt = now
+	}
+	if payout.UpdatedAt == 0 {
+		payout.UpdatedAt = now
+	}
+	_, err := coll.InsertOne(ctx, payout)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *mongoPayoutStore) CreateSnapshotPayout(ctx context.Context, payout *Payout) (*Payout, error) {
+	var result *Payout
+	err := mongoTx(ctx, s.db, func(sc mongo.SessionContext) error {
+		payouts, err := mongoFind[Payout](sc, s.coll(mongoPayouts), bson.M{"snapshot_id": payout.SnapshotId})
+		if err != nil {
+			return err
+		}
+		existing, err := snapshotPayout(payouts, payout)
+		if existing != nil || err != nil {
+			result = existing
+			return err
+		}
+		if err := insertPayout(sc, s.coll(mongoPayouts), payout); err != nil {
+			return err
+		}
+		result = payout
+		return nil
+	})
+	return result, err
+}
+
+func (s *mongoPayoutStore) GetPayout(ctx context.Context, requestId string) (*Payout, error) {
+	return mongoFindOne[Payout](ctx, s.coll(mongoPayouts), bson.M{"request_id": requestId})
+}
+
+func (s *mongoPayoutStore) ListUnfinishedPayouts(ctx context.Context, limit int) ([]*Payout, error) {
+	return mongoFind[Payout](ctx, s.coll(mongoPayouts),
+		bson.M{"status": bson.M{"$in": []string{PayoutStatusPending, PayoutStatusSubmitted}}},
+		mongoPage(bson.D{{Key: "created_at", Value: 1}}, int64(limit), 0))
+}
+
+func (s *mongoPayoutStore) UpdatePayout(ctx context.Context, payout *Payout) error {
+	if payout.UpdatedAt == 0 {
+		payout.UpdatedAt = time.Now().Unix()
+	}
+	_, err := s.coll(mongoPayouts).UpdateOne(ctx, bson.M{"request_id": payout.RequestId}, bson.M{"$set": bson.M{
+		"status":     payout.Status,
+		"attempts":   payout.Attempts,
+		"last_error": payout.LastError,
+		"updated_at": payout.UpdatedAt,
+	}})
+	return err
+}
+
+// SyncState 实现
+type mongoSyncStateStore struct {
+	*mongoStore
+}
+
+func (s *mongoSyncStateStore) GetSyncState(ctx context.Context, name string) (*SyncState, error) {
+	return mongoFindOne[SyncState](ctx, s.coll(mongoSyncStates), bson.M{"name": name})
+}
+
+func (s *mongoSyncStateStore) SaveSyncState(ctx context.Context, state *SyncState) error {
+	state.UpdatedAt = time.Now().Unix()
+	_, err := s.coll(mongoSyncStates).ReplaceOne(ctx, bson.M{"name": state.Name}, state, options.Replace().SetUpsert(true))
+	return err
+}
+
+// Donation 实现
+type mongoDonationStore struct {
+	*mongoStore
+}
+
+func (s *mongoDonationStore) RecordDonation(ctx context.Context, record *DonationRecord) (created bool, err error) {
+	err = mongoTx(ctx, s.db, func(sc mongo.SessionContext) error {
+		// 事务中的写入冲突会中止事务, 先查询再写入
+		created = false
+		exists, err := mongoExists(sc, s.coll(mongoSnapshots), bson.M{"snapshot_id": record.Snapshot.SnapshotId})
+		if err != nil || exists {
+			return err
+		}
+		if _, err := s.coll(mongoSnapshots).InsertOne(sc, record.Snapshot); err != nil {
+			return err
+		}
+
+		if action := record.Action; action != nil {
+			if action.CreatedAt.IsZero() {
+				action.CreatedAt = time.Now()
+			}
+			if _, err := s.coll(mongoDonateActions).InsertOne(sc, action); err != nil {
+				return err
+			}
+			if _, err := s.coll(mongoProjects).UpdateOne(sc, bson.M{"pid": action.PID}, bson.M{"$inc": bson.M{
+				"donate_cnt": int64(1),
+				"raised_usd": action.AmountUSD,
+			}}); err != nil {
+				return err
+			}
+			if _, err := s.coll(mongoProjectAssetTotals).UpdateOne(sc,
+				bson.M{"pid": action.PID, "asset_id": action.AssetID},
+				bson.M{
+					"$inc": bson.M{
+						"amount":     action.Amount,
+						"amount_usd": action.AmountUSD,
+						"donate_cnt": int64(1),
+					},
+					"$set": bson.M{"updated_at": time.Now()},
+				},
+				options.Update().SetUpsert(true),
+			); err != nil {
+				return err
+			}
+		}
+
+		if payout := record.Payout; payout != nil {
+			exists, err := mongoExists(sc, s.coll(mongoPayouts), bson.M{"request_id": payout.RequestId})
+			if err != nil {
+				return err
+			}
+			if !exists {
+				if err := insertPayout(sc, s.coll(mongoPayouts), payout); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, delivery := range record.Deliveries {
+			exists, err := mongoExists(sc, s.coll(mongoWebhookDeliveries), bson.M{"id": delivery.ID})
+			if err != nil {
+				return err
+			}
+			if !exists {
+				if err := insertWebhookDelivery(sc, s.coll(mongoWebhookDeliveries), delivery); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := mongoInsertLedgerEntries(sc, s.db, record.ledgerEntries()); err != nil {
+			return err
+		}
+
+		created = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return created, nil
+}
+
+// AdminAudit 实现
+type mongoAdminAuditStore struct {
+	*mongoStore
+}
+
+func (s *mongoAdminAuditStore) AddAdminAudit(ctx context.Context, audit *AdminAudit) error {
+	id, err := mongoNextID(ctx, s.db, mongoAdminAudits)
+	if err != nil {
+		return err
+	}
+	audit.ID = id
+	_, err = s.coll(mongoAdminAudits).InsertOne(ctx, audit)
+	return err
+}
+
+func (s *mongoAdminAuditStore) ListAdminAudits(ctx context.Context, limit int64, cursor *Cursor) ([]*AdminAudit, *Cursor, error) {
+	value, err := cursor.value("id", false, parseUintKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	filter := bson.M{}
+	sort := mongoKeyset(filter, "id", "id", false, value, nil)
+	audits, err := mongoFind[AdminAudit](ctx, s.coll(mongoAdminAudits), filter, mongoPage(sort, int64(pageLimit(limit)), 0))
+	if err != nil {
+		return nil, nil, err
+	}
+	audits, next := pageOf(audits, limit, adminAuditCursor)
+	return audits, next, nil
+}
+
+// Webhook 实现
+type mongoWebhookStore struct {
+	*mongoStore
+}
+
+func (s *mongoWebhookStore) AddWebhook(ctx context.Context, webhook *Webhook) error {
+	now := time.Now().Unix()
+	if webhook.CreatedAt == 0 {
+		webhook.CreatedAt = now
+	}
+	if webhook.UpdatedAt == 0 {
+		webhook.UpdatedAt = now
+	}
+	_, err := s.coll(mongoWebhooks).InsertOne(ctx, webhook)
+	return err
+}
+
+func (s *mongoWebhookStore) GetWebhook(ctx context.Context, id string) (*Webhook, error) {
+	return mongoFindOne[Webhook](ctx, s.coll(mongoWebhooks), bson.M{"id": id})
+}
+
+func (s *mongoWebhookStore) ListWebhooksByPID(ctx context.Context, pid string) ([]*Webhook, error) {
+	return mongoFind[Webhook](ctx, s.coll(mongoWebhooks), bson.M{"pid": pid}, mongoPage(bson.D{{Key: "created_at", Value: 1}}, 0, 0))
+}
+
+func (s *mongoWebhookStore) UpdateWebhook(ctx context.Context, webhook *Webhook) error {
+	if webhook.UpdatedAt == 0 {
+		webhook.UpdatedAt = time.Now().Unix()
+	}
+	_, err := s.coll(mongoWebhooks).UpdateOne(ctx, bson.M{"id": webhook.ID}, bson.M{"$set": bson.M{
+		"url":             webhook.URL,
+		"secret":          webhook.Secret,
+		"previous_secret": webhook.PreviousSecret,
+		"rotated_at":      webhook.RotatedAt,
+		"disabled":        webhook.Disabled,
+		"updated_at":      webhook.UpdatedAt,
+	}})
+	return err
+}
+
+func (s *mongoWebhookStore) DeleteWebhook(ctx context.Context, id string) error {
+	return mongoTx(ctx, s.db, func(sc mongo.SessionContext) error {
+		if _, err := s.coll(mongoWebhookDeliveries).DeleteMany(sc, bson.M{"webhook_id": id}); err != nil {
+			return err
+		}
+		_, err := s.coll(mongoWebhooks).DeleteOne(sc, bson.M{"id": id})
+		return err
+	})
+}
+
+func (s *mongoWebhookStore) CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	return insertWebhookDelivery(ctx, s.coll(mongoWebhookDeliveries), delivery)
+}
+
+// insertWebhookDelivery 与 insertPayout 相同, id 已存在时忽略
+func insertWebhookDelivery(ctx context.Context, coll *mongo.Collection, delivery *WebhookDelivery) error {
+	now := time.Now().Unix()
+	if delivery.CreatedAt == 0 {
+		delivery.CreatedAt = now
+	}
+	if delivery.UpdatedAt == 0 {
+		delivery.UpdatedAt = now
+	}
+	_, err := coll.InsertOne(ctx, delivery)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *mongoWebhookStore) GetWebhookDelivery(ctx context.Context, id string) (*WebhookDelivery, error) {
+	return mongoFindOne[WebhookDelivery](ctx, s.coll(mongoWebhookDeliveries), bson.M{"id": id})
+}
+
+func (s *mongoWebhookStore) ListDueWebhookDeliveries(ctx context.Context, now int64, limit int) ([]*WebhookDelivery, error) {
+	return mongoFind[WebhookDelivery](ctx, s.coll(mongoWebhookDeliveries),
+		bson.M{"status": WebhookDeliveryPending, "next_attempt_at": bson.M{"$lte": now}},
+		mongoPage(bson.D{{Key: "next_attempt_at", Value: 1}}, int64(limit), 0))
+}
+
+func (s *mongoWebhookStore) UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	if delivery.UpdatedAt == 0 {
+		delivery.UpdatedAt = time.Now().Unix()
+	}
+	_, err := s.coll(mongoWebhookDeliveries).UpdateOne(ctx, bson.M{"id": delivery.ID}, bson.M{"$set": bson.M{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"response_status": delivery.ResponseStatus,
+		"response_body":   delivery.ResponseBody,
+		"last_error":      delivery.LastError,
+		"delivered_at":    delivery.DeliveredAt,
+		"updated_at":      delivery.UpdatedAt,
+	}})
+	return err
+}
+
+func (s *mongoWebhookStore) ListWebhookDeliveries(ctx context.Context, webhookID string, limit int64, cursor *Cursor) ([]*WebhookDelivery, *Cursor, error) {
+	value, err := cursor.value("created_at", false, parseIntKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	filter := bson.M{"webhook_id": webhookID}
+	sort := mongoKeyset(filter, "created_at", "id", false, value, cursor.id())
+	deliveries, err := mongoFind[WebhookDelivery](ctx, s.coll(mongoWebhookDeliveries), filter, mongoPage(sort, int64(pageLimit(limit)), 0))
+	if err != nil {
+		return nil, nil, err
+	}
+	deliveries, next := pageOf(deliveries, limit, webhookDeliveryCursor)
+	return deliveries, next, nil
+}
+
+type mongoReconciliationStore struct {
+	*mongoStore
+}
+
+// mongoSumByAsset 按资产汇总 filter 匹配的 amount
+func mongoSumByAsset(ctx context.Context, coll *mongo.Collection, filter bson.M) ([]*assetSum, error) {
+	cursor, err := coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{"_id": "$asset_id", "amount": bson.M{"$sum": "$amount"}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var items []*assetSum
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (s *mongoReconciliationStore) ListAssetLedgers(ctx context.Context) ([]*AssetLedger, error) {
+	received, err := mongoSumByAsset(ctx, s.coll(mongoSnapshots), bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	paid, err := mongoSumByAsset(ctx, s.coll(mongoPayouts), bson.M{"status": PayoutStatusConfirmed})
+	if err != nil {
+		return nil, err
+	}
+	unfinished := bson.A{PayoutStatusPending, PayoutStatusSubmitted}
+	pending, err := mongoSumByAsset(ctx, s.coll(mongoPayouts), bson.M{"status": bson.M{"$in": unfinished}})
+	if err != nil {
+		return nil, err
+	}
+	return mergeAssetLedgers(received, paid, pending), nil
+}
+
+func (s *mongoReconciliationStore) AddReconciliations(ctx context.Context, items []*Reconciliation) error {
+	if len(items) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		id, err := mongoNextID(ctx, s.db, mongoReconciliations)
+		if err != nil {
+			return err
+		}
+		item.ID = id
+		docs = append(docs, item)
+	}
+	_, err := s.coll(mongoReconciliations).InsertMany(ctx, docs)
+	return err
+}
+
+func (s *mongoReconciliationStore) GetLatestReconciliations(ctx context.Context) ([]*Reconciliation, error) {
+	latest, err := mongoFind[Reconciliation](ctx, s.coll(mongoReconciliations), bson.M{},
+		mongoPage(bson.D{{Key: "id", Value: -1}}, 1, 0))
+	if err != nil || len(latest) == 0 {
+		return nil, err
+	}
+	return mongoFind[Reconciliation](ctx, s.coll(mongoReconciliations), bson.M{"run_id": latest[0].RunID},
+		mongoPage(bson.D{{Key: "asset_id", Value: 1}}, 0, 0))
+}
+
+func (s *mongoReconciliationStore) ListReconciliations(ctx context.Context, assetID string, limit int64, cursor *Cursor) ([]*Reconciliation, *Cursor, error) {
+	value, err := cursor.value("id", false, parseUintKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	filter := bson.M{}
+	if assetID != "" {
+		filter["asset_id"] = assetID
+	}
+	sort := mongoKeyset(filter, "id", "id", false, value, nil)
+	items, err := mongoFind[Reconciliation](ctx, s.coll(mongoReconciliations), filter, mongoPage(sort, int64(pageLimit(limit)), 0))
+	if err != nil {
+		return nil, nil, err
+	}
+	items, next := pageOf(items, limit, reconciliationCursor)
+	return items, next, nil
+}
+
+type mongoLedgerStore struct {
+	*mongoStore
+}
+
+// mongoInsertLedgerEntries 检查每笔交易是否平衡, 跳过已存在的交易
+func mongoInsertLedgerEntries(ctx context.Context, db *mongo.Database, entries []*LedgerEntry) error {
+	txs, err := groupLedgerTxs(entries)
+	if err != nil {
+		return err
+	}
+	coll := db.Collection(mongoLedgerEntries)
+	for _, items := range txs {
+		exists, err := mongoExists(ctx, coll, bson.M{"tx_id": items[0].TxID})
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		docs := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			id, err := mongoNextID(ctx, db, mongoLedgerEntries)
+			if err != nil {
+				return err
+			}
+			item.ID = id
+			docs = append(docs, item)
+		}
+		if _, err := coll.InsertMany(ctx, docs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *mongoLedgerStore) PostLedgerEntries(ctx context.Context, entries []*LedgerEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return mongoTx(ctx, s.db, func(sc mongo.SessionContext) error {
+		return mongoInsertLedgerEntries(sc, s.db, entries)
+	})
+}
+
+// sumLedger 按 group 汇总 filter 匹配的分录
+func (s *mongoLedgerStore) sumLedger(ctx context.Context, filter bson.M, group bson.M) ([]*LedgerBalance, error) {
+	cursor, err := s.coll(mongoLedgerEntries).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{"_id": group, "amount": bson.M{"$sum": "$amount"}}}},
+		{{Key: "$project", Value: bson.M{"account": "$_id.account", "asset_id": "$_id.asset_id", "amount": 1}}},
+		{{Key: "$sort", Value: bson.D{{Key: "account", Value: 1}, {Key: "asset_id", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var sums []*ledgerSum
+	if err := cursor.All(ctx, &sums); err != nil {
+		return nil, err
+	}
+	return ledgerBalances(sums), nil
+}
+
+func (s *mongoLedgerStore) ListLedgerBalances(ctx context.Context, account string, at int64) ([]*LedgerBalance, error) {
+	filter := bson.M{}
+	if account != "" {
+		filter["account"] = account
+	}
+	if at > 0 {
+		filter["created_at"] = bson.M{"$lte": at}
+	}
+	return s.sumLedger(ctx, filter, bson.M{"account": "$account", "asset_id": "$asset_id"})
+}
+
+func (s *mongoLedgerStore) ListLedgerImbalances(ctx context.Context, at int64) ([]*LedgerBalance, error) {
+	filter := bson.M{}
+	if at > 0 {
+		filter["created_at"] = bson.M{"$lte": at}
+	}
+	return s.sumLedger(ctx, filter, bson.M{"asset_id": "$asset_id"})
+}
+
+type mongoConsolidationStore struct {
+	*mongoStore
+}
+
+// CreateConsolidation 与 gorm 的 autoCreateTime 一致补齐时间, request_id 已存在时忽略
+func (s *mongoConsolidationStore) CreateConsolidation(ctx context.Context, consolidation *Consolidation) error {
+	now := time.Now().Unix()
+	if consolidation.CreatedAt == 0 {
+		consolidation.CreatedAt = now
+	}
+	if consolidation.UpdatedAt == 0 {
+		consolidation.UpdatedAt = now
+	}
+	_, err := s.coll(mongoConsolidations).InsertOne(ctx, consolidation)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *mongoConsolidationStore) GetConsolidation(ctx context.Context, requestId string) (*Consolidation, error) {
+	return mongoFindOne[Consolidation](ctx, s.coll(mongoConsolidations), bson.M{"request_id": requestId})
+}
+
+func (s *mongoConsolidationStore) ListUnfinishedConsolidations(ctx context.Context, limit int) ([]*Consolidation, error) {
+	return mongoFind[Consolidation](ctx, s.coll(mongoConsolidations),
+		bson.M{"status": bson.M{"$in": []string{ConsolidationStatusPending, ConsolidationStatusSubmitted}}},
+		mongoPage(bson.D{{Key: "created_at", Value: 1}}, int64(limit), 0))
+}
+
+func (s *mongoConsolidationStore) UpdateConsolidation(ctx context.Context, consolidation *Consolidation) error {
+	if consolidation.UpdatedAt == 0 {
+		consolidation.UpdatedAt = time.Now().Unix()
+	}
+	_, err := s.coll(mongoConsolidations).UpdateOne(ctx, bson.M{"request_id": consolidation.RequestId}, bson.M{"$set": bson.M{
+		"status":     consolidation.Status,
+		"attempts":   consolidation.Attempts,
+		"last_error": consolidation.LastError,
+		"updated_at": consolidation.UpdatedAt,
+	}})
+	return err
+}
+
+func (s *mongoConsolidationStore) ListConsolidations(ctx context.Context, assetID string, limit int64, cursor *Cursor) ([]*Consolidation, *Cursor, error) {
+	value, err := cursor.value("created_at", false, parseIntKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	filter := bson.M{}
+	if assetID != "" {
+		filter["asset_id"] = assetID
+	}
+	sort := mongoKeyset(filter, "created_at", "request_id", false, value, cursor.id())
+	consolidations, err := mongoFind[Consolidation](ctx, s.coll(mongoConsolidations), filter, mongoPage(sort, int64(pageLimit(limit)), 0))
+	if err != nil {
+		return nil, nil, err
+	}
+	consolidations, next := pageOf(consolidations, limit, consolidationCursor)
+	return consolidations, next, nil
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+func TestMongoRegistry(t *testing.T) {
+	reg := MongoRegistry()
+	archivedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	project := &Project{
+		PID:        "5d7e9f1a-3b4c-4d6e-9f8a-0b2c4d5e6f7a",
+		MixinUID:   "owner",
+		RaisedUSD:  decimal.RequireFromString("1234567.12345678"),
+		ArchivedAt: &archivedAt,
+	}
+
+	data, err := bson.MarshalWithRegistry(reg, project)
+	require.NoError(t, err)
+
+	// 字段名与 sql 列名一致, decimal 存为 Decimal128
+	raw := bson.Raw(data)
+	assert.Equal(t, project.PID, raw.Lookup("pid").StringValue())
+	assert.Equal(t, "owner", raw.Lookup("mixin_uid").StringValue())
+	assert.Equal(t, bsontype.Decimal128, raw.Lookup("raised_usd").Type)
+	assert.Equal(t, bsontype.Null, raw.Lookup("hidden_at").Type)
+
+	var got Project
+	require.NoError(t, bson.UnmarshalWithRegistry(reg, data, &got))
+	assert.Equal(t, project.PID, got.PID)
+	assert.True(t, project.RaisedUSD.Equal(got.RaisedUSD))
+	require.NotNil(t, got.ArchivedAt)
+	assert.True(t, archivedAt.Equal(*got.ArchivedAt))
+	assert.Nil(t, got.HiddenAt)
+}
@@ -0,0 +1,219 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCursor cursor 无法解析或与查询的排序不一致
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor 键集分页的位置, 记录上一页最后一条的排序字段值和主键
+type Cursor struct {
+	Sort string `json:"s"`           // 排序字段
+	Asc  bool   `json:"a,omitempty"` // 是否正序
+	Key  string `json:"k"`           // 排序字段的值
+	ID   string `json:"i,omitempty"` // 排序字段相同时按主键
+}
+
+// String 编码为 url 安全的字符串, 客户端原样传回
+func (c *Cursor) String() string {
+	if c == nil {
+		return ""
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseCursor 解析 Cursor.String 的结果, 空字符串表示第一页
+func ParseCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// value 校验排序并解析 Key, 第一页返回 nil
+func (c *Cursor) value(sort string, asc bool, parse func(string) (interface{}, error)) (interface{}, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.Sort != sort || c.Asc != asc {
+		return nil, ErrInvalidCursor
+	}
+	v, err := parse(c.Key)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return v, nil
+}
+
+// id 排序字段相同时比较的主键, 第一页返回 nil
+func (c *Cursor) id() interface{} {
+	if c == nil {
+		return nil
+	}
+	return c.ID
+}
+
+func parseTimeKey(s string) (interface{}, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+func parseDecimalKey(s string) (interface{}, error) {
+	return decimal.NewFromString(s)
+}
+
+func parseIntKey(s string) (interface{}, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func parseUintKey(s string) (interface{}, error) {
+	return strconv.ParseUint(s, 10, 64)
+}
+
+func formatTimeKey(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// pageLimit 查询时多取一条用于判断是否有下一页, 0 表示不限制
+func pageLimit(limit int64) int {
+	if limit <= 0 {
+		return -1
+	}
+	return int(limit + 1)
+}
+
+// pageOf 去掉多取的一条, 有下一页时返回最后一条的 cursor
+func pageOf[T any](items []*T, limit int64, cursor func(*T) *Cursor) ([]*T, *Cursor) {
+	if limit <= 0 || int64(len(items)) <= limit {
+		return items, nil
+	}
+	items = items[:limit]
+	return items, cursor(items[limit-1])
+}
+
+// keyset 按 (column, idColumn) 排序并从 cursor 之后开始, value 为空表示第一页
+// column 与 idColumn 相同时只按 column 比较
+func keyset(tx *gorm.DB, column, idColumn string, asc bool, value, id interface{}) *gorm.DB {
+	op, dir := "<", " DESC"
+	if asc {
+		op, dir = ">", " ASC"
+	}
+	if value != nil {
+		if column == idColumn {
+			tx = tx.Where(column+" "+op+" ?", value)
+		} else {
+			tx = tx.Where("("+column+" "+op+" ? OR ("+column+" = ? AND "+idColumn+" "+op+" ?))", value, value, id)
+		}
+	}
+	if column == idColumn {
+		return tx.Order(column + dir)
+	}
+	return tx.Order(column + dir + ", " + idColumn + dir)
+}
+
+// mongoKeyset 与 keyset 相同的条件, 写入 filter 并返回排序
+func mongoKeyset(filter bson.M, field, idField string, asc bool, value, id interface{}) bson.D {
+	op, dir := "$lt", -1
+	if asc {
+		op, dir = "$gt", 1
+	}
+	if value != nil {
+		if field == idField {
+			filter["$and"] = bson.A{bson.M{field: bson.M{op: value}}}
+		} else {
+			filter["$and"] = bson.A{bson.M{"$or": bson.A{
+				bson.M{field: bson.M{op: value}},
+				bson.M{field: value, idField: bson.M{op: id}},
+			}}}
+		}
+	}
+	if field == idField {
+		return bson.D{{Key: field, Value: dir}}
+	}
+	return bson.D{{Key: field, Value: dir}, {Key: idField, Value: dir}}
+}
+
+// sort 排序字段和 cursor 中排序字段的值
+func (q *ProjectQuery) sort() (column string, value interface{}, err error) {
+	column, parse := "donate_cnt", parseIntKey
+	if q.OrderBy == ProjectOrderByRaisedUSD {
+		column, parse = "raised_usd", parseDecimalKey
+	}
+	value, err = q.Cursor.value(column, false, parse)
+	return column, value, err
+}
+
+func projectCursor(column string) func(*Project) *Cursor {
+	return func(p *Project) *Cursor {
+		c := &Cursor{Sort: column, ID: p.PID, Key: strconv.FormatInt(p.DonateCnt, 10)}
+		if column == "raised_usd" {
+			c.Key = p.RaisedUSD.String()
+		}
+		return c
+	}
+}
+
+// sort 排序字段和 cursor 中排序字段的值
+func (q *DonateActionQuery) sort() (column string, value interface{}, err error) {
+	column, parse := "created_at", parseTimeKey
+	switch q.OrderBy {
+	case DonateActionOrderByAmount:
+		column, parse = "amount", parseDecimalKey
+	case DonateActionOrderByAmountUSD:
+		column, parse = "amount_usd", parseDecimalKey
+	}
+	value, err = q.Cursor.value(column, q.Asc, parse)
+	return column, value, err
+}
+
+func donateActionCursor(column string, asc bool) func(*DonateAction) *Cursor {
+	return func(a *DonateAction) *Cursor {
+		c := &Cursor{Sort: column, Asc: asc, ID: a.ID}
+		switch column {
+		case "amount":
+			c.Key = a.Amount.String()
+		case "amount_usd":
+			c.Key = a.AmountUSD.String()
+		default:
+			c.Key = formatTimeKey(a.CreatedAt)
+		}
+		return c
+	}
+}
+
+func snapshotCursor(s *Snapshot) *Cursor {
+	return &Cursor{Sort: "created_at", Key: strconv.FormatInt(s.CreatedAt, 10), ID: s.SnapshotId}
+}
+
+func adminAuditCursor(a *AdminAudit) *Cursor {
+	return &Cursor{Sort: "id", Key: strconv.FormatUint(a.ID, 10)}
+}
+
+func webhookDeliveryCursor(d *WebhookDelivery) *Cursor {
+	return &Cursor{Sort: "created_at", Key: strconv.FormatInt(d.CreatedAt, 10), ID: d.ID}
+}
+
+func reconciliationCursor(r *Reconciliation) *Cursor {
+	return &Cursor{Sort: "id", Key: strconv.FormatUint(r.ID, 10)}
+}
+
+func consolidationCursor(c *Consolidation) *Cursor {
+	return &Cursor{Sort: "created_at", Key: strconv.FormatInt(c.CreatedAt, 10), ID: c.RequestId}
+}
@@ -0,0 +1,22 @@
+package model
+
+import "errors"
+
+// ErrSnapshotHasPayout snapshot 已有未失败的出账, 再次出账会重复转出
+var ErrSnapshotHasPayout = errors.New("snapshot already has payout")
+
+// snapshotPayout 检查 snapshot 已有的出账, request_id 相同时返回已有的记录
+// 其他出账只要有一笔未失败就不能再出账
+func snapshotPayout(payouts []*Payout, payout *Payout) (*Payout, error) {
+	for _, p := range payouts {
+		if p.RequestId == payout.RequestId {
+			return p, nil
+		}
+	}
+	for _, p := range payouts {
+		if p.Status != PayoutStatusFailed {
+			return nil, ErrSnapshotHasPayout
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,164 @@
+// Package apierr HTTP 接口的错误
+//
+// 每个错误有固定的 HTTP 状态码和稳定的错误码, 客户端按错误码区分错误.
+// 错误码同时是 i18n 目录中的消息 id, 响应中的消息按请求的语言翻译.
+package apierr
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Error 接口错误, cause 只用于日志, 不返回给客户端
+type Error struct {
+	Status int
+	Code   string
+	cause  error
+}
+
+func New(status int, code string) *Error {
+	return &Error{Status: status, Code: code}
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Code + ": " + e.cause.Error()
+	}
+	return e.Code
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is 错误码相同即为同一错误, errors.Is(err, apierr.ErrProjectNotFound) 不受 Wrap 影响
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap 返回附带原因的副本
+func (e *Error) Wrap(cause error) *Error {
+	return &Error{Status: e.Status, Code: e.Code, cause: cause}
+}
+
+// From 返回 err 链上的 *Error, 没有时视为 ErrInternal
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return ErrInternal.Wrap(err)
+}
+
+var (
+	// 400
+	ErrCodeIsRequired                   = New(http.StatusBadRequest, "code_is_required")
+	ErrIdentityNumberIsRequired         = New(http.StatusBadRequest, "identity_number_is_required")
+	ErrIdentityNumberOrPrefixIsRequired = New(http.StatusBadRequest, "identity_number_or_prefix_is_required")
+	ErrInvalidAmount                    = New(http.StatusBadRequest, "invalid_amount")
+	ErrInvalidAsset                     = New(http.StatusBadRequest, "invalid_asset")
+	ErrInvalidBase64String              = New(http.StatusBadRequest, "invalid_base64_string")
+	ErrInvalidCursor                    = New(http.StatusBadRequest, "invalid_cursor")
+	ErrInvalidFormat                    = New(http.StatusBadRequest, "invalid_format")
+	ErrInvalidJSON                      = New(http.StatusBadRequest, "invalid_json")
+	ErrInvalidLanguage                  = New(http.StatusBadRequest, "invalid_language")
+	ErrInvalidMessage                   = New(http.StatusBadRequest, "invalid_message")
+	ErrInvalidPID                       = New(http.StatusBadRequest, "invalid_pid")
+	ErrInvalidProject                   = New(http.StatusBadRequest, "invalid_project")
+	ErrInvalidReferral                  = New(http.StatusBadRequest, "invalid_referral")
+	ErrInvalidRequest                   = New(http.StatusBadRequest, "invalid_request")
+	ErrInvalidReturnTo                  = New(http.StatusBadRequest, "invalid_return_to")
+	ErrInvalidSort                      = New(http.StatusBadRequest, "invalid_sort")
+	ErrInvalidTimeRange                 = New(http.StatusBadRequest, "invalid_time_range")
+	ErrInvalidWebhookURL                = New(http.StatusBadRequest, "invalid_webhook_url")
+	ErrMemoTooLong                      = New(http.StatusBadRequest, "memo_too_long")
+	ErrPIDIsRequired                    = New(http.StatusBadRequest, "pid_is_required")
+	ErrTitleOrMixinUidIsEmpty           = New(http.StatusBadRequest, "title_or_mixin_uid_is_empty")
+	ErrUnsupportedAsset                 = New(http.StatusBadRequest, "unsupported_asset")
+
+	// 401
+	ErrFailedToAuthorize = New(http.StatusUnauthorized, "failed_to_authorize")
+	ErrInvalidAdminToken = New(http.StatusUnauthorized, "invalid_admin_token")
+	ErrInvalidToken      = New(http.StatusUnauthorized, "invalid_token")
+
+	// 403
+	ErrNotTheProjectOwner = New(http.StatusForbidden, "not_the_project_owner")
+	ErrProjectBanned      = New(http.StatusForbidden, "project_banned")
+	ErrUserBanned         = New(http.StatusForbidden, "user_banned")
+
+	// 404
+	ErrDeliveryNotFound = New(http.StatusNotFound, "delivery_not_found")
+	ErrNoUsersFound     = New(http.StatusNotFound, "no_users_found")
+	ErrProjectNotFound  = New(http.StatusNotFound, "project_not_found")
+	ErrSnapshotNotFound = New(http.StatusNotFound, "snapshot_not_found")
+	ErrUserNotFound     = New(http.StatusNotFound, "user_not_found")
+	ErrWebhookNotFound  = New(http.StatusNotFound, "webhook_not_found")
+
+	// 409
+	ErrProjectAlreadyExists     = New(http.StatusConflict, "project_already_exists")
+	ErrProjectHasDonations      = New(http.StatusConflict, "project_has_donations")
+	ErrSnapshotAlreadyProcessed = New(http.StatusConflict, "snapshot_already_processed")
+	ErrSnapshotHasPayout        = New(http.StatusConflict, "snapshot_has_payout")
+	ErrTooManyWebhooks          = New(http.StatusConflict, "too_many_webhooks")
+	ErrWebhookDisabled          = New(http.StatusConflict, "webhook_disabled")
+
+	// 410
+	ErrProjectArchived = New(http.StatusGone, "project_archived")
+
+	// 422
+	ErrSnapshotSkipped = New(http.StatusUnprocessableEntity, "snapshot_skipped")
+
+	// 429
+	ErrTooManyRequests = New(http.StatusTooManyRequests, "too_many_requests")
+
+	// 500
+	ErrInternal                      = New(http.StatusInternalServerError, "internal_error")
+	ErrFailedToAddProject            = New(http.StatusInternalServerError, "failed_to_add_project")
+	ErrFailedToAddWebhook            = New(http.StatusInternalServerError, "failed_to_add_webhook")
+	ErrFailedToArchiveProject        = New(http.StatusInternalServerError, "failed_to_archive_project")
+	ErrFailedToCheckLedger           = New(http.StatusInternalServerError, "failed_to_check_ledger")
+	ErrFailedToCreatePayout          = New(http.StatusInternalServerError, "failed_to_create_payout")
+	ErrFailedToCreateUser            = New(http.StatusInternalServerError, "failed_to_create_user")
+	ErrFailedToCreateWebhookDelivery = New(http.StatusInternalServerError, "failed_to_create_webhook_delivery")
+	ErrFailedToDeleteProject         = New(http.StatusInternalServerError, "failed_to_delete_project")
+	ErrFailedToDeleteWebhook         = New(http.StatusInternalServerError, "failed_to_delete_webhook")
+	ErrFailedToEncodeMemo            = New(http.StatusInternalServerError, "failed_to_encode_memo")
+	ErrFailedToEncodeQRCode          = New(http.StatusInternalServerError, "failed_to_encode_qrcode")
+	ErrFailedToGenerateToken         = New(http.StatusInternalServerError, "failed_to_generate_token")
+	ErrFailedToGetDonateActions      = New(http.StatusInternalServerError, "failed_to_get_donate_actions")
+	ErrFailedToGetLedgerBalances     = New(http.StatusInternalServerError, "failed_to_get_ledger_balances")
+	ErrFailedToGetPayout             = New(http.StatusInternalServerError, "failed_to_get_payout")
+	ErrFailedToGetProject            = New(http.StatusInternalServerError, "failed_to_get_project")
+	ErrFailedToGetProjects           = New(http.StatusInternalServerError, "failed_to_get_projects")
+	ErrFailedToGetSnapshot           = New(http.StatusInternalServerError, "failed_to_get_snapshot")
+	ErrFailedToGetUser               = New(http.StatusInternalServerError, "failed_to_get_user")
+	ErrFailedToGetWebhook            = New(http.StatusInternalServerError, "failed_to_get_webhook")
+	ErrFailedToGetWebhookDelivery    = New(http.StatusInternalServerError, "failed_to_get_webhook_delivery")
+	ErrFailedToHandleSnapshot        = New(http.StatusInternalServerError, "failed_to_handle_snapshot")
+	ErrFailedToListAudits            = New(http.StatusInternalServerError, "failed_to_list_audits")
+	ErrFailedToListConsolidations    = New(http.StatusInternalServerError, "failed_to_list_consolidations")
+	ErrFailedToListDonations         = New(http.StatusInternalServerError, "failed_to_list_donations")
+	ErrFailedToListReconciliations   = New(http.StatusInternalServerError, "failed_to_list_reconciliations")
+	ErrFailedToListSnapshots         = New(http.StatusInternalServerError, "failed_to_list_snapshots")
+	ErrFailedToListUsers             = New(http.StatusInternalServerError, "failed_to_list_users")
+	ErrFailedToListWebhookDeliveries = New(http.StatusInternalServerError, "failed_to_list_webhook_deliveries")
+	ErrFailedToListWebhooks          = New(http.StatusInternalServerError, "failed_to_list_webhooks")
+	ErrFailedToQueryDonateActions    = New(http.StatusInternalServerError, "failed_to_query_donate_actions")
+	ErrFailedToReconcile             = New(http.StatusInternalServerError, "failed_to_reconcile")
+	ErrFailedToRotateWebhookSecret   = New(http.StatusInternalServerError, "failed_to_rotate_webhook_secret")
+	ErrFailedToSaveUser              = New(http.StatusInternalServerError, "failed_to_save_user")
+	ErrFailedToSearchUsers           = New(http.StatusInternalServerError, "failed_to_search_users")
+	ErrFailedToUpdateProject         = New(http.StatusInternalServerError, "failed_to_update_project")
+	ErrFailedToUpdateUser            = New(http.StatusInternalServerError, "failed_to_update_user")
+	ErrFailedToUpdateWebhook         = New(http.StatusInternalServerError, "failed_to_update_webhook")
+	ErrPaymentNotAvailable           = New(http.StatusInternalServerError, "payment_not_available") // 未配置 mixin client id
+
+	// 502, mixin 接口失败
+	ErrFailedToGetAssets    = New(http.StatusBadGateway, "failed_to_get_assets")
+	ErrFailedToReadSnapshot = New(http.StatusBadGateway, "failed_to_read_snapshot")
+	ErrFailedToReadUser     = New(http.StatusBadGateway, "failed_to_read_user")
+
+	// 503
+	ErrStreamUnavailable = New(http.StatusServiceUnavailable, "stream_unavailable")
+)
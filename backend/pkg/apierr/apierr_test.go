@@ -0,0 +1,26 @@
+package apierr
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := ErrFailedToGetProject.Wrap(cause)
+	assert.ErrorIs(t, err, ErrFailedToGetProject)
+	assert.ErrorIs(t, err, cause)
+	assert.NotErrorIs(t, err, ErrProjectNotFound)
+	assert.Equal(t, "failed_to_get_project: connection refused", err.Error())
+
+	// 原有的错误不受 Wrap 影响
+	assert.Nil(t, ErrFailedToGetProject.Unwrap())
+	assert.Same(t, ErrProjectNotFound, From(ErrProjectNotFound))
+
+	e := From(errors.New("boom"))
+	assert.Equal(t, http.StatusInternalServerError, e.Status)
+	assert.Equal(t, ErrInternal.Code, e.Code)
+}
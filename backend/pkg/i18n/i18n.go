@@ -0,0 +1,161 @@
+// Package i18n 用户可见消息的多语言目录
+//
+// 消息按 id 查找, 当前语言缺少的消息依次使用默认语言和英文, 都没有时返回 id.
+// 语言代码使用 BCP 47 的主语言 (en, zh), zh-CN 等带地区的语言匹配到主语言.
+package i18n
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	English = "en"
+	Chinese = "zh"
+)
+
+var (
+	ErrUnknownLanguage = errors.New("i18n: unknown language")
+)
+
+// Config 配置中覆盖或增加的消息, 语言 -> 消息 id -> 译文
+type Config struct {
+	DefaultLanguage string                       `mapstructure:"default_language" default:"en"`
+	Messages        map[string]map[string]string `mapstructure:"messages"`
+}
+
+// Catalog 支持的语言和消息
+type Catalog struct {
+	defaultLanguage string
+	languages       []string // 第一个为默认语言
+	matcher         language.Matcher
+	messages        map[string]map[string]string
+}
+
+var defaultCatalog, _ = New(nil)
+
+// Default 只有内置消息的目录, 用于未配置时
+func Default() *Catalog {
+	return defaultCatalog
+}
+
+// New 合并内置消息和配置, conf 可以为空
+func New(conf *Config) (*Catalog, error) {
+	if conf == nil {
+		conf = &Config{}
+	}
+	c := &Catalog{
+		defaultLanguage: conf.DefaultLanguage,
+		messages:        make(map[string]map[string]string),
+	}
+	if c.defaultLanguage == "" {
+		c.defaultLanguage = English
+	}
+
+	for _, src := range []map[string]map[string]string{builtinMessages, conf.Messages} {
+		for lang, messages := range src {
+			if _, err := language.Parse(lang); err != nil {
+				return nil, fmt.Errorf("i18n: invalid language %q: %w", lang, err)
+			}
+			if c.messages[lang] == nil {
+				c.messages[lang] = make(map[string]string)
+			}
+			for id, text := range messages {
+				c.messages[lang][id] = text
+			}
+		}
+	}
+	if _, ok := c.messages[c.defaultLanguage]; !ok {
+		return nil, ErrUnknownLanguage
+	}
+
+	// 默认语言放在第一个, 无法匹配时 matcher 返回它
+	c.languages = append(c.languages, c.defaultLanguage)
+	for lang := range c.messages {
+		if lang != c.defaultLanguage {
+			c.languages = append(c.languages, lang)
+		}
+	}
+	sort.Strings(c.languages[1:])
+
+	tags := make([]language.Tag, len(c.languages))
+	for i, lang := range c.languages {
+		tags[i] = language.Make(lang)
+	}
+	c.matcher = language.NewMatcher(tags)
+	return c, nil
+}
+
+// DefaultLanguage 无法匹配时使用的语言
+func (c *Catalog) DefaultLanguage() string {
+	return c.defaultLanguage
+}
+
+// Supported lang 是否为目录中的语言
+func (c *Catalog) Supported(lang string) bool {
+	_, ok := c.messages[lang]
+	return ok
+}
+
+// Match 按顺序返回第一个可以匹配的语言, 都无法匹配时返回默认语言
+func (c *Catalog) Match(langs ...string) string {
+	var tags []language.Tag
+	for _, lang := range langs {
+		if tag, err := language.Parse(lang); err == nil {
+			tags = append(tags, tag)
+		}
+	}
+	lang, _ := c.match(tags)
+	return lang
+}
+
+// Resolve 返回与 lang 匹配的语言, 无法匹配时 ok 为 false
+func (c *Catalog) Resolve(lang string) (string, bool) {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return "", false
+	}
+	return c.match([]language.Tag{tag})
+}
+
+// MatchAcceptLanguage 按 Accept-Language 的权重匹配语言
+func (c *Catalog) MatchAcceptLanguage(header string) string {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil {
+		return c.defaultLanguage
+	}
+	lang, _ := c.match(tags)
+	return lang
+}
+
+func (c *Catalog) match(tags []language.Tag) (string, bool) {
+	if len(tags) == 0 {
+		return c.defaultLanguage, false
+	}
+	_, index, confidence := c.matcher.Match(tags...)
+	if confidence == language.No {
+		return c.defaultLanguage, false
+	}
+	return c.languages[index], true
+}
+
+// T 返回 lang 的消息, 有 args 时按 fmt.Sprintf 格式化
+func (c *Catalog) T(lang, id string, args ...interface{}) string {
+	text, ok := c.messages[lang][id]
+	if !ok {
+		text, ok = c.messages[c.defaultLanguage][id]
+	}
+	if !ok {
+		text, ok = c.messages[English][id]
+	}
+	if !ok {
+		text = id
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
@@ -0,0 +1,66 @@
+package i18n
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	c := Default()
+	assert.Equal(t, English, c.DefaultLanguage())
+
+	for header, want := range map[string]string{
+		"":                               English,
+		"zh-CN,zh;q=0.9,en;q=0.8":        Chinese,
+		"zh-TW":                          Chinese,
+		"en-US,en;q=0.9":                 English,
+		"fr-FR,fr;q=0.9":                 English,
+		"fr;q=0.9,zh;q=0.5,en;q=0.4":     Chinese,
+		"en;q=0.3,zh-Hans-CN;q=0.8":      Chinese,
+		"invalid;;q=header":              English,
+		"ja, en-GB;q=0.8, zh-HK;q=0.1,*": English,
+	} {
+		assert.Equal(t, want, c.MatchAcceptLanguage(header), header)
+	}
+
+	assert.Equal(t, Chinese, c.Match("", "zh-CN"))
+	assert.Equal(t, English, c.Match("fr"))
+	assert.Equal(t, English, c.Match())
+
+	lang, ok := c.Resolve("zh-Hans")
+	assert.True(t, ok)
+	assert.Equal(t, Chinese, lang)
+	_, ok = c.Resolve("fr")
+	assert.False(t, ok)
+	_, ok = c.Resolve("not a language")
+	assert.False(t, ok)
+}
+
+func TestCatalog(t *testing.T) {
+	c, err := New(&Config{
+		DefaultLanguage: Chinese,
+		Messages: map[string]map[string]string{
+			English: {"project_not_found": "no such project"},
+			"ja":    {"project_not_found": "プロジェクトが見つかりません"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.True(t, c.Supported("ja"))
+	assert.Equal(t, "ja", c.MatchAcceptLanguage("ja-JP"))
+	assert.Equal(t, Chinese, c.MatchAcceptLanguage("fr"))
+
+	assert.Equal(t, "no such project", c.T(English, "project_not_found"))
+	assert.Equal(t, "项目不存在", c.T(Chinese, "project_not_found"))
+	assert.Equal(t, "プロジェクトが見つかりません", c.T("ja", "project_not_found"))
+	// 缺少的消息使用默认语言, 都没有时返回 id
+	assert.Equal(t, "用户不存在", c.T("ja", "user_not_found"))
+	assert.Equal(t, "unknown_message", c.T(English, "unknown_message"))
+
+	_, err = New(&Config{DefaultLanguage: "fr"})
+	assert.ErrorIs(t, err, ErrUnknownLanguage)
+	_, err = New(&Config{Messages: map[string]map[string]string{"not a language": {}}})
+	assert.Error(t, err)
+}
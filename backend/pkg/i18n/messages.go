@@ -0,0 +1,205 @@
+package i18n
+
+// builtinMessages 内置的消息, 消息 id 为小写加下划线, 配置中的 messages 可以覆盖或增加语言
+var builtinMessages = map[string]map[string]string{
+	English: {
+		// 转账 memo
+		"memo_donate_failed":  "Donate failed",
+		"memo_donate_for_you": "Donate for you",
+		"memo_donate_refund":  "Donate refund",
+
+		// 运营告警
+		"reconcile_alert":          "Wallet reconciliation alert: %s expected %s, actual %s, unexplained difference %s (about $%s)",
+		"reconcile_alert_no_price": "Wallet reconciliation alert: %s expected %s, actual %s, unexplained difference %s (no price)",
+
+		// 接口错误
+		"code_is_required":                      "code is required",
+		"delivery_not_found":                    "delivery not found",
+		"failed_to_add_project":                 "failed to add project",
+		"failed_to_add_webhook":                 "failed to add webhook",
+		"failed_to_archive_project":             "failed to archive project",
+		"failed_to_check_ledger":                "failed to check ledger",
+		"failed_to_authorize":                   "failed to authorize",
+		"failed_to_create_payout":               "failed to create payout",
+		"failed_to_create_user":                 "failed to create user",
+		"failed_to_create_webhook_delivery":     "failed to create webhook delivery",
+		"failed_to_delete_project":              "failed to delete project",
+		"failed_to_delete_webhook":              "failed to delete webhook",
+		"failed_to_encode_memo":                 "failed to encode memo",
+		"failed_to_encode_qrcode":               "failed to encode qrcode",
+		"failed_to_generate_token":              "failed to generate token",
+		"failed_to_get_assets":                  "failed to get assets",
+		"failed_to_get_donate_actions":          "failed to get donate actions",
+		"failed_to_get_ledger_balances":         "failed to get ledger balances",
+		"failed_to_get_payout":                  "failed to get payout",
+		"failed_to_get_project":                 "failed to get project",
+		"failed_to_get_projects":                "failed to get projects",
+		"failed_to_get_snapshot":                "failed to get snapshot",
+		"failed_to_get_user":                    "failed to get user",
+		"failed_to_get_webhook":                 "failed to get webhook",
+		"failed_to_get_webhook_delivery":        "failed to get webhook delivery",
+		"failed_to_handle_snapshot":             "failed to handle snapshot",
+		"failed_to_list_audits":                 "failed to list audits",
+		"failed_to_list_consolidations":         "failed to list consolidations",
+		"failed_to_list_donations":              "failed to list donations",
+		"failed_to_list_reconciliations":        "failed to list reconciliations",
+		"failed_to_list_snapshots":              "failed to list snapshots",
+		"failed_to_list_users":                  "failed to list users",
+		"failed_to_list_webhook_deliveries":     "failed to list webhook deliveries",
+		"failed_to_list_webhooks":               "failed to list webhooks",
+		"failed_to_query_donate_actions":        "failed to query donate actions",
+		"failed_to_read_snapshot":               "failed to read snapshot",
+		"failed_to_read_user":                   "failed to read user",
+		"failed_to_reconcile":                   "failed to reconcile",
+		"failed_to_rotate_webhook_secret":       "failed to rotate webhook secret",
+		"failed_to_save_user":                   "failed to save user",
+		"failed_to_search_users":                "failed to search users",
+		"failed_to_update_project":              "failed to update project",
+		"failed_to_update_user":                 "failed to update user",
+		"failed_to_update_webhook":              "failed to update webhook",
+		"identity_number_is_required":           "identity_number is required",
+		"identity_number_or_prefix_is_required": "identity_number or prefix is required",
+		"internal_error":                        "internal error",
+		"invalid_admin_token":                   "invalid admin token",
+		"invalid_amount":                        "invalid amount",
+		"invalid_asset":                         "invalid asset",
+		"invalid_base64_string":                 "invalid base64 string",
+		"invalid_cursor":                        "invalid cursor",
+		"invalid_format":                        "invalid format",
+		"invalid_json":                          "invalid json",
+		"invalid_language":                      "invalid language",
+		"invalid_message":                       "message is too long",
+		"invalid_pid":                           "invalid pid",
+		"invalid_project":                       "invalid project",
+		"invalid_referral":                      "referral is too long",
+		"invalid_request":                       "invalid request",
+		"invalid_return_to":                     "invalid return_to",
+		"invalid_sort":                          "invalid sort",
+		"invalid_time_range":                    "invalid time range",
+		"invalid_token":                         "invalid token",
+		"invalid_webhook_url":                   "invalid webhook url",
+		"memo_too_long":                         "memo is too long, shorten the message or referral",
+		"no_users_found":                        "no users found",
+		"not_the_project_owner":                 "not the project owner",
+		"payment_not_available":                 "payment not available",
+		"pid_is_required":                       "pid is required",
+		"project_already_exists":                "project already exists",
+		"project_archived":                      "project archived",
+		"project_banned":                        "project banned",
+		"project_has_donations":                 "project has donations and cannot be deleted, archive it instead",
+		"project_not_found":                     "project not found",
+		"snapshot_already_processed":            "snapshot already processed",
+		"snapshot_has_payout":                   "snapshot already has a payout",
+		"snapshot_not_found":                    "snapshot not found",
+		"snapshot_skipped":                      "snapshot skipped, nothing was processed",
+		"stream_unavailable":                    "stream unavailable",
+		"title_or_mixin_uid_is_empty":           "title or mixin_uid is empty",
+		"too_many_requests":                     "too many requests",
+		"too_many_webhooks":                     "too many webhooks",
+		"unsupported_asset":                     "unsupported asset",
+		"user_banned":                           "user banned",
+		"user_not_found":                        "user not found",
+		"webhook_disabled":                      "webhook disabled",
+		"webhook_not_found":                     "webhook not found",
+	},
+	Chinese: {
+		// 转账 memo
+		"memo_donate_failed":  "捐赠失败",
+		"memo_donate_for_you": "收到捐赠",
+		"memo_donate_refund":  "捐赠退款",
+
+		// 运营告警
+		"reconcile_alert":          "钱包对账告警: %s 账面应有 %s, 实际 %s, 无法解释的差额 %s (约 $%s)",
+		"reconcile_alert_no_price": "钱包对账告警: %s 账面应有 %s, 实际 %s, 无法解释的差额 %s (没有价格)",
+
+		// 接口错误
+		"code_is_required":                      "缺少 code",
+		"delivery_not_found":                    "投递记录不存在",
+		"failed_to_add_project":                 "创建项目失败",
+		"failed_to_add_webhook":                 "创建 webhook 失败",
+		"failed_to_archive_project":             "归档项目失败",
+		"failed_to_check_ledger":                "检查账本失败",
+		"failed_to_authorize":                   "授权失败",
+		"failed_to_create_payout":               "创建转账失败",
+		"failed_to_create_user":                 "创建用户失败",
+		"failed_to_create_webhook_delivery":     "创建 webhook 投递失败",
+		"failed_to_delete_project":              "删除项目失败",
+		"failed_to_delete_webhook":              "删除 webhook 失败",
+		"failed_to_encode_memo":                 "生成 memo 失败",
+		"failed_to_encode_qrcode":               "生成二维码失败",
+		"failed_to_generate_token":              "生成 token 失败",
+		"failed_to_get_assets":                  "获取资产失败",
+		"failed_to_get_donate_actions":          "获取捐赠记录失败",
+		"failed_to_get_ledger_balances":         "获取账户余额失败",
+		"failed_to_get_payout":                  "获取转账失败",
+		"failed_to_get_project":                 "获取项目失败",
+		"failed_to_get_projects":                "获取项目列表失败",
+		"failed_to_get_snapshot":                "获取 snapshot 失败",
+		"failed_to_get_user":                    "获取用户失败",
+		"failed_to_get_webhook":                 "获取 webhook 失败",
+		"failed_to_get_webhook_delivery":        "获取 webhook 投递失败",
+		"failed_to_handle_snapshot":             "处理 snapshot 失败",
+		"failed_to_list_audits":                 "获取审计记录失败",
+		"failed_to_list_consolidations":         "获取 utxo 聚合记录失败",
+		"failed_to_list_donations":              "获取捐赠列表失败",
+		"failed_to_list_reconciliations":        "获取对账记录失败",
+		"failed_to_list_snapshots":              "获取 snapshot 列表失败",
+		"failed_to_list_users":                  "获取用户列表失败",
+		"failed_to_list_webhook_deliveries":     "获取 webhook 投递记录失败",
+		"failed_to_list_webhooks":               "获取 webhook 列表失败",
+		"failed_to_query_donate_actions":        "查询捐赠记录失败",
+		"failed_to_read_snapshot":               "读取 snapshot 失败",
+		"failed_to_read_user":                   "读取用户信息失败",
+		"failed_to_reconcile":                   "对账失败",
+		"failed_to_rotate_webhook_secret":       "轮换 webhook 密钥失败",
+		"failed_to_save_user":                   "保存用户失败",
+		"failed_to_search_users":                "搜索用户失败",
+		"failed_to_update_project":              "更新项目失败",
+		"failed_to_update_user":                 "更新用户失败",
+		"failed_to_update_webhook":              "更新 webhook 失败",
+		"identity_number_is_required":           "缺少 identity_number",
+		"identity_number_or_prefix_is_required": "缺少 identity_number 或 prefix",
+		"internal_error":                        "服务内部错误",
+		"invalid_admin_token":                   "管理员凭证无效",
+		"invalid_amount":                        "金额无效",
+		"invalid_asset":                         "资产无效",
+		"invalid_base64_string":                 "base64 字符串无效",
+		"invalid_cursor":                        "分页 cursor 无效",
+		"invalid_format":                        "格式无效",
+		"invalid_json":                          "JSON 格式错误",
+		"invalid_language":                      "不支持的语言",
+		"invalid_message":                       "留言过长",
+		"invalid_pid":                           "pid 无效",
+		"invalid_project":                       "项目无效",
+		"invalid_referral":                      "推荐码过长",
+		"invalid_request":                       "请求无效",
+		"invalid_return_to":                     "return_to 无效",
+		"invalid_sort":                          "排序方式无效",
+		"invalid_time_range":                    "时间范围无效",
+		"invalid_token":                         "登录已失效",
+		"invalid_webhook_url":                   "webhook 地址无效",
+		"memo_too_long":                         "memo 过长, 请缩短留言或推荐码",
+		"no_users_found":                        "没有找到用户",
+		"not_the_project_owner":                 "不是项目的所有者",
+		"payment_not_available":                 "暂时无法支付",
+		"pid_is_required":                       "缺少 pid",
+		"project_already_exists":                "项目已存在",
+		"project_archived":                      "项目已归档",
+		"project_banned":                        "项目已被封禁",
+		"project_has_donations":                 "项目已有捐赠, 不能删除, 请改为归档",
+		"project_not_found":                     "项目不存在",
+		"snapshot_already_processed":            "snapshot 已处理",
+		"snapshot_has_payout":                   "snapshot 已有出账",
+		"snapshot_not_found":                    "snapshot 不存在",
+		"snapshot_skipped":                      "snapshot 已跳过, 未做任何处理",
+		"stream_unavailable":                    "实时推送不可用",
+		"title_or_mixin_uid_is_empty":           "title 或 mixin_uid 为空",
+		"too_many_requests":                     "请求过于频繁",
+		"too_many_webhooks":                     "webhook 数量已达上限",
+		"unsupported_asset":                     "不支持的资产",
+		"user_banned":                           "用户已被封禁",
+		"user_not_found":                        "用户不存在",
+		"webhook_disabled":                      "webhook 已停用",
+		"webhook_not_found":                     "webhook 不存在",
+	},
+}
@@ -1,6 +1,7 @@
 package jwt
 
 import (
+	"errors"
 	"sync"
 	"time"
 
@@ -19,15 +20,31 @@ type JwtConfig struct {
 	TokenExpireSeconds int64  `mapstructure:"token_expire_seconds"`
 }
 
+// DefaultTokenExpireSeconds 未配置 token_expire_seconds 时 token 的有效期, 7 天
+const DefaultTokenExpireSeconds = 7 * 24 * 3600
+
 var (
 	once sync.Once
 	_jwt = &jwtImpl{}
+
+	ErrNotInitialized = errors.New("jwt not initialized")
+	ErrEmptySecretKey = errors.New("jwt secret key is empty")
 )
 
-func Init(config *JwtConfig) {
+// Init 未配置密钥时返回错误, 不允许以空密钥签发 token
+// 未配置有效期时使用 DefaultTokenExpireSeconds, 避免签发的 token 立即过期
+func Init(config *JwtConfig) error {
+	if config == nil || config.SecretKey == "" {
+		return ErrEmptySecretKey
+	}
+	conf := *config
+	if conf.TokenExpireSeconds <= 0 {
+		conf.TokenExpireSeconds = DefaultTokenExpireSeconds
+	}
 	once.Do(func() {
-		_jwt = &jwtImpl{config: config}
+		_jwt = &jwtImpl{config: &conf}
 	})
+	return nil
 }
 
 type MyClaims struct {
@@ -40,6 +57,12 @@ type jwtImpl struct {
 }
 
 func GenToken(uid string) (string, error) {
+	if _jwt.config == nil {
+		return "", ErrNotInitialized
+	}
+	if _jwt.config.SecretKey == "" {
+		return "", ErrEmptySecretKey
+	}
 	claims := MyClaims{
 		Uid: uid,
 		RegisteredClaims: jwt.RegisteredClaims{
@@ -56,9 +79,20 @@ func GenToken(uid string) (string, error) {
 }
 
 func ParseJwt(tokenstring string) (*MyClaims, error) {
+	if _jwt.config == nil {
+		return nil, ErrNotInitialized
+	}
+	if _jwt.config.SecretKey == "" {
+		return nil, ErrEmptySecretKey
+	}
+	// 只接受签发时使用的 HS256
 	t, err := jwt.ParseWithClaims(tokenstring, &MyClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(_jwt.config.SecretKey), nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	// token 格式错误时 t 为 nil
+	if err != nil {
+		return nil, err
+	}
 
 	if claims, ok := t.Claims.(*MyClaims); ok && t.Valid {
 		return claims, nil
@@ -3,10 +3,18 @@ package jwt
 import (
 	"fmt"
 	"os"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_JWTToken(t *testing.T) {
+	require.NoError(t, Init(&JwtConfig{SecretKey: "123456", TokenExpireSeconds: 60}))
+
 	s, err := GenToken("zhangsan")
 	if err != nil {
 		t.Fail()
@@ -21,3 +29,47 @@ func Test_JWTToken(t *testing.T) {
 	}
 	fmt.Printf("%+v\n", claims)
 }
+
+func TestEmptySecretKey(t *testing.T) {
+	assert.ErrorIs(t, Init(nil), ErrEmptySecretKey)
+	assert.ErrorIs(t, Init(&JwtConfig{TokenExpireSeconds: 60}), ErrEmptySecretKey)
+
+	saved := _jwt
+	defer func() { _jwt = saved }()
+	_jwt = &jwtImpl{config: &JwtConfig{TokenExpireSeconds: 60}}
+	_, err := GenToken("zhangsan")
+	assert.ErrorIs(t, err, ErrEmptySecretKey)
+	_, err = ParseJwt("token")
+	assert.ErrorIs(t, err, ErrEmptySecretKey)
+}
+
+func TestParseJwtRejectsOtherMethods(t *testing.T) {
+	require.NoError(t, Init(&JwtConfig{SecretKey: "123456", TokenExpireSeconds: 60}))
+
+	claims := MyClaims{Uid: "zhangsan", RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}}
+	// 同一密钥的 HS512 签名也不接受
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte(_jwt.config.SecretKey))
+	require.NoError(t, err)
+	_, err = ParseJwt(s)
+	assert.Error(t, err)
+
+	s, err = jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = ParseJwt(s)
+	assert.Error(t, err)
+}
+
+func TestDefaultTokenExpire(t *testing.T) {
+	saved := _jwt
+	defer func() { _jwt = saved }()
+	once = sync.Once{}
+
+	// 未配置有效期时签发的 token 仍然可以解析
+	require.NoError(t, Init(&JwtConfig{SecretKey: "123456"}))
+	s, err := GenToken("zhangsan")
+	require.NoError(t, err)
+	claims, err := ParseJwt(s)
+	require.NoError(t, err)
+	assert.Equal(t, "zhangsan", claims.Uid)
+	assert.WithinDuration(t, time.Now().Add(DefaultTokenExpireSeconds*time.Second), claims.ExpiresAt.Time, time.Minute)
+}
@@ -0,0 +1,149 @@
+// Package memo 捐赠转账的 memo 格式
+//
+// 旧版 memo 只包含项目 pid; 新版为带版本号的结构体, 以 JSON 或 msgpack 编码,
+// 可以再用 base64 包装, 最终由 mixin 以 hex 形式出现在 snapshot 中.
+package memo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fox-one/msgpack"
+	"github.com/gofrs/uuid"
+)
+
+const (
+	VersionLegacy = 0 // 只有 pid
+	Version1      = 1
+
+	MaxEncodedLength = 256 // mixin 交易 extra 的长度上限
+
+	// 留言和推荐码按 JSON 编码后的字节数限制, 超出部分截断
+	// 所有字段都取最大长度时, 编码后的 memo 正好不超过 MaxEncodedLength
+	MaxReferralLength = 64
+	MaxMessageLength  = MaxEncodedLength - len(maxMemoOverhead) - MaxReferralLength
+
+	// 除留言和推荐码外 Encode 输出的最大长度
+	maxMemoOverhead = `{"v":1,"p":"00000000-0000-0000-0000-000000000000","m":"","a":true,"r":""}`
+)
+
+var (
+	ErrInvalidMemo = errors.New("invalid memo")
+	ErrMemoTooLong = errors.New("memo too long")
+)
+
+type Memo struct {
+	Version   int    `json:"v" msgpack:"v"`
+	PID       string `json:"p" msgpack:"p"`
+	Message   string `json:"m,omitempty" msgpack:"m,omitempty"` // 捐赠留言
+	Anonymous bool   `json:"a,omitempty" msgpack:"a,omitempty"` // 不公开捐赠者
+	Referral  string `json:"r,omitempty" msgpack:"r,omitempty"` // 推荐码
+}
+
+// Encode 以不转义 HTML 字符的 JSON 编码, 可直接作为转账 memo
+// 与 Decode 一样截断过长的留言和推荐码, 编码后超过 MaxEncodedLength 时返回 ErrMemoTooLong
+func Encode(m *Memo) (string, error) {
+	item, err := normalize(&Memo{PID: m.PID, Message: m.Message, Anonymous: m.Anonymous, Referral: m.Referral})
+	if err != nil {
+		return "", err
+	}
+	// 只写入 Version1 的字段
+	item.Version = Version1
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(item); err != nil {
+		return "", err
+	}
+	encoded := strings.TrimSuffix(buf.String(), "\n")
+	if len(encoded) > MaxEncodedLength {
+		return "", ErrMemoTooLong
+	}
+	return encoded, nil
+}
+
+// EncodedLen 字符串在 Encode 输出中占用的字节数, 不含引号
+func EncodedLen(s string) int {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	// 去掉引号和换行
+	return buf.Len() - 3
+}
+
+// Decode 解析 snapshot 中的 memo, 同时兼容旧版只有 pid 的 memo
+func Decode(memo string) (*Memo, error) {
+	data, err := hex.DecodeString(memo)
+	if err != nil {
+		data = []byte(memo)
+	}
+	data = []byte(strings.TrimSpace(string(data)))
+	if len(data) == 0 {
+		return nil, ErrInvalidMemo
+	}
+
+	// 旧版: pid
+	if pid, err := uuid.FromString(string(data)); err == nil {
+		return normalize(&Memo{Version: VersionLegacy, PID: pid.String()})
+	}
+
+	if b, ok := decodeBase64(string(data)); ok {
+		data = b
+	}
+
+	var m Memo
+	if data[0] == '{' {
+		err = json.Unmarshal(data, &m)
+	} else {
+		err = msgpack.Unmarshal(data, &m)
+	}
+	if err != nil || m.Version < Version1 {
+		return nil, ErrInvalidMemo
+	}
+	// 更高的版本只读取已知字段, 保证资金不会因为无法解析而滞留
+	return normalize(&m)
+}
+
+func decodeBase64(s string) ([]byte, bool) {
+	s = strings.TrimRight(s, "=")
+	s = strings.NewReplacer("+", "-", "/", "_").Replace(s)
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, false
+	}
+	return b, true
+}
+
+// normalize 校验 pid, 截断过长的留言和推荐码
+func normalize(m *Memo) (*Memo, error) {
+	pid, err := uuid.FromString(m.PID)
+	if err != nil || pid == uuid.Nil {
+		return nil, ErrInvalidMemo
+	}
+	m.PID = pid.String()
+	m.Message = truncate(strings.TrimSpace(m.Message), MaxMessageLength)
+	m.Referral = truncate(strings.TrimSpace(m.Referral), MaxReferralLength)
+	return m, nil
+}
+
+// truncate 按字符截断, 使 JSON 编码后不超过 n 字节
+func truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, string(utf8.RuneError))
+	if EncodedLen(s) <= n {
+		return s
+	}
+	size := 0
+	for i, r := range s {
+		if size += EncodedLen(string(r)); size > n {
+			return s[:i]
+		}
+	}
+	return s
+}
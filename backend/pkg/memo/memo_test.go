@@ -0,0 +1,113 @@
+package memo
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/fox-one/msgpack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPID = "5d7e9f1a-3b4c-4d6e-9f8a-0b2c4d5e6f7a"
+
+func hexOf(s string) string {
+	return hex.EncodeToString([]byte(s))
+}
+
+func TestDecode(t *testing.T) {
+	encoded, err := Encode(&Memo{PID: testPID, Message: "加油", Anonymous: true, Referral: "friend"})
+	require.NoError(t, err)
+
+	packed, err := msgpack.Marshal(&Memo{Version: Version1, PID: testPID, Message: "hi"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		memo string
+		want *Memo
+	}{
+		{name: "legacy hex pid", memo: hexOf(testPID), want: &Memo{PID: testPID}},
+		{name: "encoded", memo: hexOf(encoded), want: &Memo{Version: Version1, PID: testPID, Message: "加油", Anonymous: true, Referral: "friend"}},
+		{name: "raw json", memo: hexOf(`{"v":1,"p":"` + testPID + `","m":"hi"}`), want: &Memo{Version: Version1, PID: testPID, Message: "hi"}},
+		{name: "base64 msgpack", memo: hexOf(base64.StdEncoding.EncodeToString(packed)), want: &Memo{Version: Version1, PID: testPID, Message: "hi"}},
+		{name: "newer version", memo: hexOf(`{"v":2,"p":"` + testPID + `","x":1}`), want: &Memo{Version: 2, PID: testPID}},
+		{name: "empty", memo: ""},
+		{name: "not a pid", memo: hexOf("hello")},
+		{name: "missing version", memo: hexOf(`{"p":"` + testPID + `"}`)},
+		{name: "invalid pid", memo: hexOf(`{"v":1,"p":"abc"}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.memo)
+			if tt.want == nil {
+				assert.ErrorIs(t, err, ErrInvalidMemo)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDecodeTruncatesMessage(t *testing.T) {
+	raw := `{"v":1,"p":"` + testPID + `","m":"` + strings.Repeat("好", 140) + `"}`
+	got, err := Decode(hexOf(raw))
+	require.NoError(t, err)
+	// 按 JSON 编码后的字节数截断, 每个汉字 3 字节
+	assert.Equal(t, strings.Repeat("好", MaxMessageLength/3), got.Message)
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	assert.Equal(t, 73, len(maxMemoOverhead))
+
+	tests := []struct {
+		name string
+		memo *Memo
+		want *Memo
+	}{
+		{
+			name: "trim",
+			memo: &Memo{PID: testPID, Message: " hi <3 ", Referral: " friend "},
+			want: &Memo{Version: Version1, PID: testPID, Message: "hi <3", Referral: "friend"},
+		},
+		{
+			// 最长的留言和推荐码
+			name: "worst case",
+			memo: &Memo{PID: testPID, Message: strings.Repeat("好", 140), Anonymous: true, Referral: strings.Repeat("r", 64)},
+			want: &Memo{Version: Version1, PID: testPID, Message: strings.Repeat("好", MaxMessageLength/3), Anonymous: true, Referral: strings.Repeat("r", 64)},
+		},
+		{
+			// 需要转义的字符按转义后的长度计算
+			name: "escaped",
+			memo: &Memo{PID: testPID, Message: strings.Repeat(`"`, 200), Referral: strings.Repeat("\\", 40)},
+			want: &Memo{Version: Version1, PID: testPID, Message: strings.Repeat(`"`, MaxMessageLength/2), Referral: strings.Repeat("\\", MaxReferralLength/2)},
+		},
+		{
+			name: "emoji",
+			memo: &Memo{PID: testPID, Message: strings.Repeat("😀", 140), Referral: strings.Repeat("推", 64)},
+			want: &Memo{Version: Version1, PID: testPID, Message: strings.Repeat("😀", MaxMessageLength/4), Referral: strings.Repeat("推", MaxReferralLength/3)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := Encode(tt.memo)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(encoded), MaxEncodedLength)
+
+			got, err := Decode(hexOf(encoded))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			// 再次编码结果不变
+			again, err := Encode(got)
+			require.NoError(t, err)
+			assert.Equal(t, encoded, again)
+		})
+	}
+
+	_, err := Encode(&Memo{PID: "abc"})
+	assert.ErrorIs(t, err, ErrInvalidMemo)
+}
@@ -0,0 +1,227 @@
+// Package notify 捐赠通知的模板
+//
+// 每种语言一组模板: 卡片标题, 卡片描述和纯文本消息, 使用 text/template 语法,
+// 数据为 Donation. 配置中只需要覆盖需要修改的模板, 其余使用内置的模板.
+package notify
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/fox-one/mixin-sdk-go/v2"
+)
+
+const (
+	LanguageEnglish = "en"
+	LanguageChinese = "zh"
+
+	// mixin 对 app card 的长度限制
+	maxCardTitle       = 36
+	maxCardDescription = 128
+)
+
+var (
+	ErrUnknownLanguage = errors.New("notify: unknown language")
+)
+
+// Config 配置中覆盖的模板和项目链接
+type Config struct {
+	// 项目页面的地址前缀, 链接为 {site_url}/project/{pid}, 为空时卡片不带链接
+	SiteURL         string               `mapstructure:"site_url"`
+	DefaultLanguage string               `mapstructure:"default_language" default:"en"`
+	Templates       map[string]*Template `mapstructure:"templates"`
+}
+
+// Template 为空的字段使用内置模板
+type Template struct {
+	Title       string `mapstructure:"title"`
+	Description string `mapstructure:"description"`
+	Text        string `mapstructure:"text"`
+}
+
+var builtinTemplates = map[string]*Template{
+	LanguageEnglish: {
+		Title:       `{{.ProjectTitle}}`,
+		Description: `{{.DonorName}} donated {{.Amount}} {{.Symbol}}{{if .AmountUSD}} (≈ ${{.AmountUSD}}){{end}}{{if .Message}}: {{.Message}}{{end}}`,
+		Text: `{{.DonorName}} donated {{.Amount}} {{.Symbol}}{{if .AmountUSD}} (≈ ${{.AmountUSD}}){{end}} to your project "{{.ProjectTitle}}".` +
+			`{{if .Message}}
+Message: {{.Message}}{{end}}{{if .ProjectURL}}
+{{.ProjectURL}}{{end}}`,
+	},
+	LanguageChinese: {
+		Title:       `{{.ProjectTitle}}`,
+		Description: `{{.DonorName}} 捐赠了 {{.Amount}} {{.Symbol}}{{if .AmountUSD}} (≈ ${{.AmountUSD}}){{end}}{{if .Message}}: {{.Message}}{{end}}`,
+		Text: `{{.DonorName}} 向你的项目「{{.ProjectTitle}}」捐赠了 {{.Amount}} {{.Symbol}}{{if .AmountUSD}} (≈ ${{.AmountUSD}}){{end}}。` +
+			`{{if .Message}}
+留言: {{.Message}}{{end}}{{if .ProjectURL}}
+{{.ProjectURL}}{{end}}`,
+	},
+}
+
+// Donation 模板中可以使用的数据, 匿名捐赠时 DonorName 为 Anonymous 且没有头像
+type Donation struct {
+	PID          string
+	ProjectTitle string
+	ProjectURL   string
+	DonorName    string
+	DonorAvatar  string
+	Anonymous    bool
+	Amount       string
+	Symbol       string
+	AssetIcon    string
+	AmountUSD    string // 价格未知时为空
+	Message      string
+}
+
+type templateSet struct {
+	title, description, text *template.Template
+}
+
+// Notifier 按语言渲染捐赠通知
+type Notifier struct {
+	siteURL         string
+	defaultLanguage string
+	templates       map[string]*templateSet
+}
+
+// New 解析配置中的模板, conf 可以为空
+func New(conf *Config) (*Notifier, error) {
+	if conf == nil {
+		conf = &Config{}
+	}
+	n := &Notifier{
+		siteURL:         strings.TrimSuffix(conf.SiteURL, "/"),
+		defaultLanguage: conf.DefaultLanguage,
+		templates:       make(map[string]*templateSet),
+	}
+	if n.defaultLanguage == "" {
+		n.defaultLanguage = LanguageEnglish
+	}
+
+	languages := make(map[string]bool)
+	for lang := range builtinTemplates {
+		languages[lang] = true
+	}
+	for lang := range conf.Templates {
+		languages[lang] = true
+	}
+	for lang := range languages {
+		// 配置的模板逐个字段覆盖内置模板, 新语言缺少的字段使用英文的内置模板
+		base := builtinTemplates[lang]
+		if base == nil {
+			base = builtinTemplates[LanguageEnglish]
+		}
+		tpl := *base
+		if override := conf.Templates[lang]; override != nil {
+			tpl.Title = firstNonEmpty(override.Title, tpl.Title)
+			tpl.Description = firstNonEmpty(override.Description, tpl.Description)
+			tpl.Text = firstNonEmpty(override.Text, tpl.Text)
+		}
+
+		set, err := parseTemplate(lang, &tpl)
+		if err != nil {
+			return nil, err
+		}
+		n.templates[lang] = set
+	}
+	if _, ok := n.templates[n.defaultLanguage]; !ok {
+		return nil, ErrUnknownLanguage
+	}
+	return n, nil
+}
+
+func parseTemplate(lang string, tpl *Template) (*templateSet, error) {
+	var (
+		set templateSet
+		err error
+	)
+	if set.title, err = template.New(lang + ".title").Parse(tpl.Title); err != nil {
+		return nil, err
+	}
+	if set.description, err = template.New(lang + ".description").Parse(tpl.Description); err != nil {
+		return nil, err
+	}
+	if set.text, err = template.New(lang + ".text").Parse(tpl.Text); err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+// ProjectURL 项目页面的链接, 未配置 site_url 时为空
+func (n *Notifier) ProjectURL(pid string) string {
+	if n.siteURL == "" {
+		return ""
+	}
+	return n.siteURL + "/project/" + pid
+}
+
+// language 返回 lang 的模板, 不支持时使用默认语言
+func (n *Notifier) language(lang string) *templateSet {
+	if set, ok := n.templates[lang]; ok {
+		return set
+	}
+	// zh-CN 等带地区的语言使用主语言的模板
+	if base, _, ok := strings.Cut(lang, "-"); ok {
+		if set, ok := n.templates[base]; ok {
+			return set
+		}
+	}
+	return n.templates[n.defaultLanguage]
+}
+
+// Card 渲染 app card, 标题和描述按 mixin 的限制截断
+func (n *Notifier) Card(lang string, d *Donation) (*mixin.AppCardMessage, error) {
+	set := n.language(lang)
+	title, err := execute(set.title, d)
+	if err != nil {
+		return nil, err
+	}
+	description, err := execute(set.description, d)
+	if err != nil {
+		return nil, err
+	}
+
+	icon := d.DonorAvatar
+	if icon == "" {
+		icon = d.AssetIcon
+	}
+	return &mixin.AppCardMessage{
+		IconURL:     icon,
+		Title:       truncate(title, maxCardTitle),
+		Description: truncate(description, maxCardDescription),
+		Action:      d.ProjectURL,
+	}, nil
+}
+
+// Text 渲染纯文本消息, 发送卡片失败时使用
+func (n *Notifier) Text(lang string, d *Donation) (string, error) {
+	return execute(n.language(lang).text, d)
+}
+
+func execute(t *template.Template, d *Donation) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, d); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
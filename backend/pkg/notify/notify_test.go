@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifier(t *testing.T) {
+	n, err := New(&Config{
+		SiteURL:         "https://donate.example.com/",
+		DefaultLanguage: LanguageChinese,
+		Templates: map[string]*Template{
+			LanguageEnglish: {Title: "New donation for {{.ProjectTitle}}"},
+			"ja":            {Text: "{{.DonorName}} さんから {{.Amount}} {{.Symbol}}"},
+		},
+	})
+	require.NoError(t, err)
+
+	d := &Donation{
+		PID:          "5d7e9f1a-3b4c-4d6e-9f8a-0b2c4d5e6f7a",
+		ProjectTitle: "project",
+		ProjectURL:   n.ProjectURL("5d7e9f1a-3b4c-4d6e-9f8a-0b2c4d5e6f7a"),
+		DonorName:    "donor",
+		DonorAvatar:  "https://example.com/avatar.png",
+		Amount:       "1.5",
+		Symbol:       "USDT",
+		AmountUSD:    "1.50",
+		Message:      "good luck",
+	}
+	assert.Equal(t, "https://donate.example.com/project/5d7e9f1a-3b4c-4d6e-9f8a-0b2c4d5e6f7a", d.ProjectURL)
+
+	// 覆盖的字段使用配置, 其余使用内置模板
+	card, err := n.Card("en", d)
+	require.NoError(t, err)
+	assert.Equal(t, "New donation for project", card.Title)
+	assert.Equal(t, "donor donated 1.5 USDT (≈ $1.50): good luck", card.Description)
+	assert.Equal(t, d.ProjectURL, card.Action)
+	assert.Equal(t, d.DonorAvatar, card.IconURL)
+
+	// 不支持的语言使用默认语言, 带地区的语言使用主语言
+	text, err := n.Text("fr", d)
+	require.NoError(t, err)
+	assert.Equal(t, "donor 向你的项目「project」捐赠了 1.5 USDT (≈ $1.50)。\n留言: good luck\n"+d.ProjectURL, text)
+	text, err = n.Text("en-US", d)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(text, `donor donated 1.5 USDT (≈ $1.50) to your project "project".`))
+
+	// 新增的语言缺少的模板使用英文
+	text, err = n.Text("ja", d)
+	require.NoError(t, err)
+	assert.Equal(t, "donor さんから 1.5 USDT", text)
+	card, err = n.Card("ja", d)
+	require.NoError(t, err)
+	assert.Equal(t, "project", card.Title)
+
+	// 卡片按 mixin 的限制截断
+	d.ProjectTitle = strings.Repeat("长", 50)
+	card, err = n.Card("zh", d)
+	require.NoError(t, err)
+	assert.Equal(t, 36, len([]rune(card.Title)))
+	assert.True(t, strings.HasSuffix(card.Title, "…"))
+}
+
+func TestNewInvalidTemplate(t *testing.T) {
+	_, err := New(&Config{Templates: map[string]*Template{"en": {Text: "{{.DonorName"}}})
+	assert.Error(t, err)
+
+	_, err = New(&Config{DefaultLanguage: "fr"})
+	assert.ErrorIs(t, err, ErrUnknownLanguage)
+
+	n, err := New(nil)
+	require.NoError(t, err)
+	assert.Empty(t, n.ProjectURL("pid"))
+}
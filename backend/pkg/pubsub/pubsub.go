@@ -0,0 +1,133 @@
+// Package pubsub 进程内按 topic 的发布订阅
+//
+// 发布不会阻塞: 每个订阅者有固定大小的缓冲区, 缓冲区满时断开该订阅者,
+// 由订阅者重新订阅并通过接口补齐错过的数据.
+package pubsub
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrClosed       = errors.New("pubsub: hub closed")
+	ErrSlowConsumer = errors.New("pubsub: slow consumer")
+)
+
+type Hub[T any] struct {
+	bufferSize int
+
+	mu     sync.Mutex
+	closed bool
+	topics map[string]map[*Subscription[T]]struct{}
+}
+
+// New 创建 Hub, bufferSize 为每个订阅者可以积压的消息数
+func New[T any](bufferSize int) *Hub[T] {
+	if bufferSize <= 0 {
+		bufferSize = 1
+	}
+	return &Hub[T]{
+		bufferSize: bufferSize,
+		topics:     make(map[string]map[*Subscription[T]]struct{}),
+	}
+}
+
+type Subscription[T any] struct {
+	hub   *Hub[T]
+	topic string
+	ch    chan T
+	err   error // 在 ch 关闭前写入
+}
+
+// C 接收消息, 订阅结束后关闭, 原因见 Err
+func (s *Subscription[T]) C() <-chan T {
+	return s.ch
+}
+
+// Err 订阅结束的原因, 只在 C 关闭后有效; 主动 Close 时为空
+func (s *Subscription[T]) Err() error {
+	return s.err
+}
+
+// Close 取消订阅, 可以重复调用
+func (s *Subscription[T]) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s, nil)
+}
+
+func (h *Hub[T]) Subscribe(topic string) (*Subscription[T], error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrClosed
+	}
+	sub := &Subscription[T]{
+		hub:   h,
+		topic: topic,
+		ch:    make(chan T, h.bufferSize),
+	}
+	subs, ok := h.topics[topic]
+	if !ok {
+		subs = make(map[*Subscription[T]]struct{})
+		h.topics[topic] = subs
+	}
+	subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Publish 把 v 发给 topics 的所有订阅者
+func (h *Hub[T]) Publish(v T, topics ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, topic := range topics {
+		for sub := range h.topics[topic] {
+			select {
+			case sub.ch <- v:
+			default:
+				h.remove(sub, ErrSlowConsumer)
+			}
+		}
+	}
+}
+
+// Subscribers topic 当前的订阅者数量
+func (h *Hub[T]) Subscribers(topic string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.topics[topic])
+}
+
+// Close 结束所有订阅, 之后不能再订阅
+func (h *Hub[T]) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for _, subs := range h.topics {
+		for sub := range subs {
+			h.remove(sub, ErrClosed)
+		}
+	}
+}
+
+// remove 调用方需持有锁
+func (h *Hub[T]) remove(sub *Subscription[T], err error) {
+	subs, ok := h.topics[sub.topic]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.topics, sub.topic)
+	}
+	sub.err = err
+	close(sub.ch)
+}
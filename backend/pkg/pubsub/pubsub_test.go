@@ -0,0 +1,69 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublish(t *testing.T) {
+	hub := New[int](4)
+	a, err := hub.Subscribe("a")
+	require.NoError(t, err)
+	all, err := hub.Subscribe("*")
+	require.NoError(t, err)
+
+	hub.Publish(1, "a", "*")
+	hub.Publish(2, "b", "*")
+
+	assert.Equal(t, 1, <-a.C())
+	assert.Equal(t, 1, <-all.C())
+	assert.Equal(t, 2, <-all.C())
+	assert.Empty(t, a.C())
+
+	a.Close()
+	a.Close()
+	_, ok := <-a.C()
+	assert.False(t, ok)
+	assert.NoError(t, a.Err())
+	assert.Equal(t, 0, hub.Subscribers("a"))
+	assert.Equal(t, 1, hub.Subscribers("*"))
+}
+
+func TestSlowConsumer(t *testing.T) {
+	hub := New[int](2)
+	slow, err := hub.Subscribe("a")
+	require.NoError(t, err)
+	fast, err := hub.Subscribe("a")
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		hub.Publish(i, "a")
+		<-fast.C()
+	}
+
+	// 积压超过缓冲区的订阅者被断开, 不影响其他订阅者
+	var got []int
+	for v := range slow.C() {
+		got = append(got, v)
+	}
+	assert.Equal(t, []int{0, 1}, got)
+	assert.ErrorIs(t, slow.Err(), ErrSlowConsumer)
+	assert.Equal(t, 1, hub.Subscribers("a"))
+}
+
+func TestClose(t *testing.T) {
+	hub := New[int](1)
+	sub, err := hub.Subscribe("a")
+	require.NoError(t, err)
+
+	hub.Close()
+	_, ok := <-sub.C()
+	assert.False(t, ok)
+	assert.ErrorIs(t, sub.Err(), ErrClosed)
+
+	_, err = hub.Subscribe("a")
+	assert.ErrorIs(t, err, ErrClosed)
+	hub.Publish(1, "a")
+}
@@ -0,0 +1,144 @@
+// Package webhook 推送给项目方的 webhook 签名和投递
+//
+// 请求体为 JSON, 签名放在 X-Donate-Signature 头中, 格式为 t={unix 秒},v1={hex},
+// 其中 v1 = HMAC-SHA256(secret, "{t}.{body}"). 密钥轮换后的过渡期内
+// 会同时带上新旧两个密钥的 v1, 接收方任一匹配即可.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	HeaderEvent     = "X-Donate-Event"
+	HeaderDelivery  = "X-Donate-Delivery"
+	HeaderSignature = "X-Donate-Signature"
+
+	secretPrefix = "whsec_"
+)
+
+var (
+	ErrInvalidURL       = errors.New("webhook: invalid url")
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+	ErrPrivateAddress   = errors.New("webhook: private address not allowed")
+)
+
+// NewSecret 生成随机的签名密钥
+func NewSecret() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return secretPrefix + hex.EncodeToString(b)
+}
+
+// ValidateURL 只接受 http 和 https 的绝对地址
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(raw) > 512 {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+func sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Signature 生成签名头, secrets 中的空字符串被忽略
+func Signature(timestamp int64, body []byte, secrets ...string) string {
+	parts := []string{"t=" + strconv.FormatInt(timestamp, 10)}
+	for _, secret := range secrets {
+		if secret != "" {
+			parts = append(parts, "v1="+sign(secret, timestamp, body))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Verify 校验签名头, tolerance 为允许的时间误差, 0 表示不校验时间
+func Verify(header string, body []byte, secret string, now time.Time, tolerance time.Duration) error {
+	var (
+		timestamp int64
+		sigs      []string
+	)
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			timestamp, _ = strconv.ParseInt(v, 10, 64)
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+	if timestamp == 0 {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 {
+		if d := now.Sub(time.Unix(timestamp, 0)); d > tolerance || d < -tolerance {
+			return ErrInvalidSignature
+		}
+	}
+
+	expected := sign(secret, timestamp, body)
+	for _, sig := range sigs {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// NewClient 投递使用的 http client, 不跟随重定向
+// allowPrivate 为 false 时拒绝连接内网和本机地址, 防止通过 webhook 访问内部服务
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		// 在建立连接时检查解析后的地址, DNS 解析到内网同样会被拒绝
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || isPrivateIP(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"type":"donation.created"}`)
+	now := time.Unix(1735689600, 0)
+
+	header := Signature(now.Unix(), body, "new", "old")
+	assert.NoError(t, Verify(header, body, "new", now, time.Minute))
+	assert.NoError(t, Verify(header, body, "old", now, time.Minute))
+	assert.ErrorIs(t, Verify(header, body, "other", now, time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify(header, []byte(`{}`), "new", now, time.Minute), ErrInvalidSignature)
+
+	// 超出时间误差的请求视为重放
+	assert.ErrorIs(t, Verify(header, body, "new", now.Add(time.Hour), time.Minute), ErrInvalidSignature)
+	assert.NoError(t, Verify(header, body, "new", now.Add(time.Hour), 0))
+
+	// 空密钥不参与签名
+	assert.Equal(t, Signature(now.Unix(), body, "new"), Signature(now.Unix(), body, "new", ""))
+	assert.ErrorIs(t, Verify("v1=abc", body, "new", now, 0), ErrInvalidSignature)
+}
+
+func TestValidateURL(t *testing.T) {
+	assert.NoError(t, ValidateURL("https://example.com/hook"))
+	assert.NoError(t, ValidateURL("http://example.com:8080/hook?a=1"))
+	assert.ErrorIs(t, ValidateURL("ftp://example.com"), ErrInvalidURL)
+	assert.ErrorIs(t, ValidateURL("/hook"), ErrInvalidURL)
+	assert.ErrorIs(t, ValidateURL("https://"), ErrInvalidURL)
+}
+
+func TestClientRejectsPrivateAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	_, err := NewClient(time.Second, false).Get(server.URL)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrPrivateAddress))
+
+	resp, err := NewClient(time.Second, true).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
@@ -0,0 +1,453 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"donate/logger"
+	"donate/model"
+	"donate/pkg/apierr"
+	"donate/pkg/timeof"
+	"donate/router/api"
+	"donate/router/middleware"
+	"donate/utils"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	adminMaxBodySize = 64 << 10
+)
+
+// adminAudit 记录每一次管理员操作, 包括请求参数和响应状态
+func (s *Service) adminAudit() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var body []byte
+		if ctx.Request.Body != nil {
+			body, _ = io.ReadAll(io.LimitReader(ctx.Request.Body, adminMaxBodySize))
+			ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		ctx.Next()
+
+		params := ctx.Request.URL.RawQuery
+		if len(body) > 0 {
+			if params != "" {
+				params += " "
+			}
+			params += string(body)
+		}
+		audit := &model.AdminAudit{
+			Operator:  middleware.GetAdminOperator(ctx),
+			Action:    ctx.Request.Method + " " + ctx.FullPath(),
+			Target:    ctx.Request.URL.Path,
+			Params:    params,
+			Status:    ctx.Writer.Status(),
+			CreatedAt: s.clock.Now().Unix(),
+		}
+		// 请求可能已被取消, 审计记录仍需写入
+		if err := s.store.AddAdminAudit(context.WithoutCancel(ctx), audit); err != nil {
+			logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+			logger.Error().Err(err).Any("audit", audit).Msg("failed to add admin audit")
+		}
+	}
+}
+
+const (
+	adminPageLimit    = 20
+	adminMaxPageLimit = 500
+)
+
+// AdminListSnapshots 列出已入账的 snapshot, 以 cursor 翻页
+func (s *Service) AdminListSnapshots(ctx *gin.Context) {
+	limit, cursor, err := api.ParsePage(ctx, adminPageLimit, adminMaxPageLimit)
+	if err != nil {
+		middleware.Error(ctx, err)
+		return
+	}
+	snapshots, next, err := s.store.ListSnapshots(ctx, limit, cursor)
+	if err != nil {
+		middleware.Error(ctx, api.PageError(err, apierr.ErrFailedToListSnapshots))
+		return
+	}
+	api.SetNextCursor(ctx, next)
+	middleware.OK(ctx, snapshots)
+}
+
+// AdminListDonations 列出捐赠记录, 可按 pid 过滤, 其他参数与公开的捐赠记录相同
+func (s *Service) AdminListDonations(ctx *gin.Context) {
+	query, err := api.ParseDonateActionQuery(ctx)
+	if err != nil {
+		middleware.Error(ctx, err)
+		return
+	}
+	query.PID = ctx.Query("pid")
+	actions, next, err := s.store.QueryDonateActions(ctx, query)
+	if err != nil {
+		middleware.Error(ctx, api.PageError(err, apierr.ErrFailedToListDonations))
+		return
+	}
+	api.SetNextCursor(ctx, next)
+	middleware.OK(ctx, actions)
+}
+
+// AdminListAudits 列出管理员操作记录, 以 cursor 翻页
+func (s *Service) AdminListAudits(ctx *gin.Context) {
+	limit, cursor, err := api.ParsePage(ctx, adminPageLimit, adminMaxPageLimit)
+	if err != nil {
+		middleware.Error(ctx, err)
+		return
+	}
+	audits, next, err := s.store.ListAdminAudits(ctx, limit, cursor)
+	if err != nil {
+		middleware.Error(ctx, api.PageError(err, apierr.ErrFailedToListAudits))
+		return
+	}
+	api.SetNextCursor(ctx, next)
+	middleware.OK(ctx, audits)
+}
+
+// AdminListReconciliations 按时间倒序列出对账记录, 可按 asset 过滤, 以 cursor 翻页
+func (s *Service) AdminListReconciliations(ctx *gin.Context) {
+	limit, cursor, err := api.ParsePage(ctx, adminPageLimit, adminMaxPageLimit)
+	if err != nil {
+		middleware.Error(ctx, err)
+		return
+	}
+	items, next, err := s.store.ListReconciliations(ctx, ctx.Query("asset"), limit, cursor)
+	if err != nil {
+		middleware.Error(ctx, api.PageError(err, apierr.ErrFailedToListReconciliations))
+		return
+	}
+	if items == nil {
+		items = []*model.Reconciliation{}
+	}
+	api.SetNextCursor(ctx, next)
+	middleware.OK(ctx, items)
+}
+
+// AdminLatestReconciliations 最近一次对账每个资产的结果
+func (s *Service) AdminLatestReconciliations(ctx *gin.Context) {
+	items, err := s.store.GetLatestReconciliations(ctx)
+	if err != nil {
+		middleware.Error(ctx, apierr.ErrFailedToListReconciliations.Wrap(err))
+		return
+	}
+	if items == nil {
+		items = []*model.Reconciliation{}
+	}
+	middleware.OK(ctx, items)
+}
+
+// AdminReconcile 立即对账并返回结果, 超过阈值的差额同样会告警
+func (s *Service) AdminReconcile(ctx *gin.Context) {
+	items, err := s.reconcile(ctx)
+	if err != nil {
+		middleware.Error(ctx, apierr.ErrFailedToReconcile.Wrap(err))
+		return
+	}
+	middleware.OK(ctx, items)
+}
+
+// parseLedgerTime 解析 at 参数, 支持 pkg/timeof 的格式, 为空表示当前
+func parseLedgerTime(ctx *gin.Context) (int64, bool) {
+	v := ctx.Query("at")
+	if v == "" {
+		return 0, true
+	}
+	t, ok := timeof.TimeOf(v)
+	if !ok {
+		return 0, false
+	}
+	return t.Unix(), true
+}
+
+// AdminLedgerBalances 截至 at 各账户的余额, 可按 account 过滤
+func (s *Service) AdminLedgerBalances(ctx *gin.Context) {
+	at, ok := parseLedgerTime(ctx)
+	if !ok {
+		middleware.Error(ctx, apierr.ErrInvalidTimeRange)
+		return
+	}
+	balances, err := s.store.ListLedgerBalances(ctx, ctx.Query("account"), at)
+	if err != nil {
+		middleware.Error(ctx, apierr.ErrFailedToGetLedgerBalances.Wrap(err))
+		return
+	}
+	middleware.OK(ctx, balances)
+}
+
+// LedgerCheckResponse 每个资产的分录之和都为 0 时 balanced 为 true
+type LedgerCheckResponse struct {
+	Balanced   bool                   `json:"balanced"`
+	Imbalances []*model.LedgerBalance `json:"imbalances"`
+}
+
+// AdminCheckLedger 检查截至 at 每个资产的分录之和是否为 0
+func (s *Service) AdminCheckLedger(ctx *gin.Context) {
+	at, ok := parseLedgerTime(ctx)
+	if !ok {
+		middleware.Error(ctx, apierr.ErrInvalidTimeRange)
+		return
+	}
+	imbalances, err := s.store.ListLedgerImbalances(ctx, at)
+	if err != nil {
+		middleware.Error(ctx, apierr.ErrFailedToCheckLedger.Wrap(err))
+		return
+	}
+	middleware.OK(ctx, LedgerCheckResponse{Balanced: len(imbalances) == 0, Imbalances: imbalances})
+}
+
+// ProjectModerationRequest 隐藏的项目不出现在列表中, 封禁的项目同时不再接收捐赠
+type ProjectModerationRequest struct {
+	Hidden bool `json:"hidden"`
+	Banned bool `json:"banned"`
+}
+
+// AdminModerateProject 隐藏或封禁项目
+func (s *Service) AdminModerateProject(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	var req ProjectModerationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		middleware.Error(ctx, apierr.ErrInvalidRequest)
+		return
+	}
+
+	project, err := s.store.GetProject(ctx, ctx.Param("pid"))
+	switch err {
+	case nil:
+	case gorm.ErrRecordNotFound:
+		middleware.Error(ctx, apierr.ErrProjectNotFound)
+		return
+	default:
+		logger.Error().Err(err).Msg("failed to get project")
+		middleware.Error(ctx, apierr.ErrFailedToGetProject)
+		return
+	}
+
+	now := s.clock.Now()
+	project.HiddenAt = moderationTime(req.Hidden, project.HiddenAt, now)
+	project.BannedAt = moderationTime(req.Banned, project.BannedAt, now)
+	if err := s.store.UpdateProjectModeration(ctx, project.PID, project.HiddenAt, project.BannedAt); err != nil {
+		logger.Error().Err(err).Msg("failed to update project")
+		middleware.Error(ctx, apierr.ErrFailedToUpdateProject)
+		return
+	}
+	middleware.OK(ctx, project)
+}
+
+// UserModerationRequest 封禁的用户不能登录, 名下项目不再展示和接收捐赠
+type UserModerationRequest struct {
+	Banned bool `json:"banned"`
+}
+
+// AdminModerateUser 封禁或解封用户, 路径参数为 mixin user id
+func (s *Service) AdminModerateUser(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	var req UserModerationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		middleware.Error(ctx, apierr.ErrInvalidRequest)
+		return
+	}
+
+	user, err := s.store.GetUserByUID(ctx, ctx.Param("uid"))
+	switch err {
+	case nil:
+	case gorm.ErrRecordNotFound:
+		middleware.Error(ctx, apierr.ErrUserNotFound)
+		return
+	default:
+		logger.Error().Err(err).Msg("failed to get user")
+		middleware.Error(ctx, apierr.ErrFailedToGetUser)
+		return
+	}
+
+	user.BannedAt = moderationTime(req.Banned, user.BannedAt, s.clock.Now())
+	if err := s.store.UpdateUserBanned(ctx, user.MixinUID, user.BannedAt); err != nil {
+		logger.Error().Err(err).Msg("failed to update user")
+		middleware.Error(ctx, apierr.ErrFailedToUpdateUser)
+		return
+	}
+	middleware.OK(ctx, user)
+}
+
+// moderationTime 保留已有的时间, 取消时返回空
+func moderationTime(enable bool, current *time.Time, now time.Time) *time.Time {
+	if !enable {
+		return nil
+	}
+	if current != nil {
+		return current
+	}
+	return &now
+}
+
+// ForwardRequest 手动转给的项目
+type ForwardRequest struct {
+	PID string `json:"pid"` // required
+}
+
+// AdminRefundSnapshot 手动将 snapshot 的资产退还给捐赠者
+// 重复调用返回同一笔出账, 已有其他未失败的出账时返回 409
+func (s *Service) AdminRefundSnapshot(ctx *gin.Context) {
+	snapshot, ok := s.getAdminSnapshot(ctx)
+	if !ok {
+		return
+	}
+
+	s.createAdminPayout(ctx, &model.Payout{
+		RequestId:  utils.GenUuidFromStrings(snapshot.RequestId, "admin-refund"),
+		SnapshotId: snapshot.SnapshotId,
+		Kind:       model.PayoutKindRefund,
+		AssetId:    snapshot.AssetId,
+		Amount:     snapshot.Amount,
+		Member:     snapshot.UserId,
+		Memo:       s.userMemo(ctx, snapshot.UserId, "memo_donate_refund"),
+	})
+}
+
+// AdminForwardSnapshot 手动将 snapshot 的资产转给指定项目的项目方
+// 重复调用返回同一笔出账, 已有其他未失败的出账时返回 409
+func (s *Service) AdminForwardSnapshot(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	var req ForwardRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.PID == "" {
+		middleware.Error(ctx, apierr.ErrPIDIsRequired)
+		return
+	}
+
+	snapshot, ok := s.getAdminSnapshot(ctx)
+	if !ok {
+		return
+	}
+
+	project, err := s.store.GetProject(ctx, req.PID)
+	switch err {
+	case nil:
+	case gorm.ErrRecordNotFound:
+		middleware.Error(ctx, apierr.ErrProjectNotFound)
+		return
+	default:
+		logger.Error().Err(err).Msg("failed to get project")
+		middleware.Error(ctx, apierr.ErrFailedToGetProject)
+		return
+	}
+
+	s.createAdminPayout(ctx, &model.Payout{
+		RequestId:  utils.GenUuidFromStrings(snapshot.RequestId, "admin-forward"),
+		SnapshotId: snapshot.SnapshotId,
+		Kind:       model.PayoutKindForward,
+		AssetId:    snapshot.AssetId,
+		Amount:     snapshot.Amount,
+		Member:     project.MixinUID,
+		PID:        project.PID,
+		Memo:       s.userMemo(ctx, project.MixinUID, "memo_donate_for_you"),
+	})
+}
+
+// AdminReprocessSnapshot 从 mixin 重新读取 snapshot 并入账, 已入账的 snapshot 不会重复处理
+func (s *Service) AdminReprocessSnapshot(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+	snapshotId := ctx.Param("id")
+
+	_, err := s.store.GetSnapshotById(ctx, snapshotId)
+	switch err {
+	case gorm.ErrRecordNotFound:
+	case nil:
+		middleware.Error(ctx, apierr.ErrSnapshotAlreadyProcessed)
+		return
+	default:
+		logger.Error().Err(err).Msg("failed to get snapshot")
+		middleware.Error(ctx, apierr.ErrFailedToGetSnapshot)
+		return
+	}
+
+	snapshot, err := s.mixinClient.ReadSafeSnapshot(ctx, snapshotId)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to read snapshot")
+		middleware.Error(ctx, apierr.ErrFailedToReadSnapshot)
+		return
+	}
+
+	if err := s.handleMixinSnapshot(ctx, snapshot); err != nil {
+		logger.Error().Err(err).Msg("failed to handle snapshot")
+		middleware.Error(ctx, apierr.ErrFailedToHandleSnapshot)
+		return
+	}
+
+	// 转出, 金额为 0 或聚合 utxo 的 snapshot 会被跳过, 不会入账
+	switch _, err := s.store.GetSnapshotById(ctx, snapshotId); err {
+	case nil:
+	case gorm.ErrRecordNotFound:
+		middleware.Error(ctx, apierr.ErrSnapshotSkipped)
+		return
+	default:
+		logger.Error().Err(err).Msg("failed to get snapshot")
+		middleware.Error(ctx, apierr.ErrFailedToGetSnapshot)
+		return
+	}
+
+	middleware.OK(ctx, gin.H{"snapshotId": snapshot.SnapshotID})
+}
+
+// getAdminSnapshot 读取路径中已入账的 snapshot, 失败时已写入响应
+func (s *Service) getAdminSnapshot(ctx *gin.Context) (*model.Snapshot, bool) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	snapshot, err := s.store.GetSnapshotById(ctx, ctx.Param("id"))
+	switch err {
+	case nil:
+		return snapshot, true
+	case gorm.ErrRecordNotFound:
+		middleware.Error(ctx, apierr.ErrSnapshotNotFound)
+	default:
+		logger.Error().Err(err).Msg("failed to get snapshot")
+		middleware.Error(ctx, apierr.ErrFailedToGetSnapshot)
+	}
+	return nil, false
+}
+
+// createAdminPayout 写入出账记录, 由 payout 任务完成转账
+// snapshot 已有其他未失败的出账 (自动转账, 退款或另一种手动出账) 时拒绝, 避免重复转出
+func (s *Service) createAdminPayout(ctx *gin.Context, payout *model.Payout) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	// request_id 已存在时返回已有的出账记录
+	payout, err := s.store.CreateSnapshotPayout(ctx, s.newPayout(payout))
+	switch {
+	case err == nil:
+	case errors.Is(err, model.ErrSnapshotHasPayout):
+		middleware.Error(ctx, apierr.ErrSnapshotHasPayout)
+		return
+	default:
+		logger.Error().Err(err).Msg("failed to create payout")
+		middleware.Error(ctx, apierr.ErrFailedToCreatePayout)
+		return
+	}
+	middleware.OK(ctx, payout)
+}
+
+// AdminListConsolidations 按时间倒序列出 utxo 聚合记录, 可按 asset 过滤, 以 cursor 翻页
+func (s *Service) AdminListConsolidations(ctx *gin.Context) {
+	limit, cursor, err := api.ParsePage(ctx, adminPageLimit, adminMaxPageLimit)
+	if err != nil {
+		middleware.Error(ctx, err)
+		return
+	}
+	items, next, err := s.store.ListConsolidations(ctx, ctx.Query("asset"), limit, cursor)
+	if err != nil {
+		middleware.Error(ctx, api.PageError(err, apierr.ErrFailedToListConsolidations))
+		return
+	}
+	if items == nil {
+		items = []*model.Consolidation{}
+	}
+	api.SetNextCursor(ctx, next)
+	middleware.OK(ctx, items)
+}
@@ -0,0 +1,113 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"donate/config"
+	"donate/model"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// adminRequest 以运营后台的 key 请求 env 的接口
+func adminRequest(t *testing.T, env *testEnv, method, path string, body interface{}) *httptest.ResponseRecorder {
+	if env.svc.conf.Admin == nil {
+		env.svc.conf.Admin = &config.AdminConfig{AccessKey: "ak", SecretKey: "sk"}
+		env.svc.initRouter()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Authorization", "Bearer ak:sk")
+	w := httptest.NewRecorder()
+	env.svc.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminRefundAfterForward(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	// 入账时已自动转给项目方, 不能再退款或再次转出
+	snapshot := env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(10), pidMemo(testPID))
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+
+	w := adminRequest(t, env, http.MethodPost, "/admin/snapshots/"+snapshot.SnapshotID+"/refund", nil)
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	w = adminRequest(t, env, http.MethodPost, "/admin/snapshots/"+snapshot.SnapshotID+"/forward", &ForwardRequest{PID: testPID})
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+
+	payouts, err := env.store.ListUnfinishedPayouts(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, payouts, 1)
+	assert.Equal(t, model.PayoutKindForward, payouts[0].Kind)
+}
+
+func TestAdminForwardAfterRefund(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	// memo 无效的 snapshot 只入账, 没有出账
+	snapshot := env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(3), "not a pid")
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+
+	refund := "/admin/snapshots/" + snapshot.SnapshotID + "/refund"
+	w := adminRequest(t, env, http.MethodPost, refund, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var payout model.Payout
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &payout))
+	assert.Equal(t, model.PayoutKindRefund, payout.Kind)
+
+	// 重复退款返回同一笔出账
+	w = adminRequest(t, env, http.MethodPost, refund, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var again model.Payout
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &again))
+	assert.Equal(t, payout.RequestId, again.RequestId)
+
+	forward := "/admin/snapshots/" + snapshot.SnapshotID + "/forward"
+	w = adminRequest(t, env, http.MethodPost, forward, &ForwardRequest{PID: testPID})
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+
+	// 退款失败后可以改为转给项目方
+	payout.Status = model.PayoutStatusFailed
+	require.NoError(t, env.store.UpdatePayout(ctx, &payout))
+	w = adminRequest(t, env, http.MethodPost, forward, &ForwardRequest{PID: testPID})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var forwarded model.Payout
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &forwarded))
+	assert.Equal(t, model.PayoutKindForward, forwarded.Kind)
+	assert.Equal(t, testOwnerID, forwarded.Member)
+}
+
+func TestAdminReprocessSkippedSnapshot(t *testing.T) {
+	env := newTestEnv(t)
+
+	// 机器人转给自己的聚合 snapshot 不入账
+	snapshot := env.network.Deposit(testBotID, testAssetID, decimal.NewFromInt(1), "")
+	w := adminRequest(t, env, http.MethodPost, "/admin/snapshots/"+snapshot.SnapshotID+"/reprocess", nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+
+	// memo 为空的 snapshot 只记录, 不是捐赠
+	snapshot = env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), "")
+	w = adminRequest(t, env, http.MethodPost, "/admin/snapshots/"+snapshot.SnapshotID+"/reprocess", nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	snapshot = env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), pidMemo(testPID))
+	w = adminRequest(t, env, http.MethodPost, "/admin/snapshots/"+snapshot.SnapshotID+"/reprocess", nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = adminRequest(t, env, http.MethodPost, "/admin/snapshots/"+snapshot.SnapshotID+"/reprocess", nil)
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+}
@@ -2,15 +2,18 @@ package api
 
 import (
 	"context"
+	"donate/config"
 	"donate/logger"
 	"donate/model"
 	"donate/model/mixin_client_wrapper"
+	"donate/pkg/apierr"
 	"donate/pkg/cacheflight"
+	mr "donate/pkg/mapreduce"
+	"donate/pkg/timeof"
 	"donate/router/middleware"
 	"donate/utils"
 	"encoding/base64"
 	"encoding/json"
-	"net/http"
 	"strconv"
 	"strings"
 	"time"
@@ -18,30 +21,60 @@ import (
 	"github.com/fox-one/mixin-sdk-go/v2"
 	"github.com/gin-gonic/gin"
 	"github.com/gofrs/uuid"
+	"github.com/samber/lo"
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
 type ApiServer struct {
-	mixinClient *mixin_client_wrapper.MixinClientWrapper
+	mixinConf   *config.MixinConfig
+	mixinClient mixin_client_wrapper.MixinClient
 	store       model.Store
 	assetCf     *cacheflight.Group
+	feed        *DonationFeed
 }
 
-func New(mixinClient *mixin_client_wrapper.MixinClientWrapper, store model.Store) *ApiServer {
+func New(mixinConf *config.MixinConfig, mixinClient mixin_client_wrapper.MixinClient, store model.Store, feed *DonationFeed) *ApiServer {
 	return &ApiServer{
+		mixinConf:   mixinConf,
 		mixinClient: mixinClient,
 		store:       store,
 		assetCf:     cacheflight.New(time.Minute, time.Minute<<1),
+		feed:        feed,
 	}
 }
 
 type GetProjectResponse struct {
 	model.Project
-	User *model.User `json:"user"`
+	User     *model.User                `json:"user"`
+	Totals   []*model.ProjectAssetTotal `json:"totals"`   // 按资产统计的累计捐赠
+	Campaign *model.Campaign            `json:"campaign"` // 募捐进度
 }
 
-// 1. 根据 base64 编码获取项目信息 + 捐赠过的用户
+func (a *ApiServer) newProjectResponse(ctx context.Context, project *model.Project) GetProjectResponse {
+	user, _ := a.store.GetUserByIdentityNumber(ctx, project.IdentityNumber)
+	totals, _ := a.store.ListProjectAssetTotals(ctx, project.PID)
+	return GetProjectResponse{
+		Project:  *project,
+		User:     user,
+		Totals:   totals,
+		Campaign: project.Campaign(time.Now(), totals),
+	}
+}
+
+// parseCampaignTime 解析可选的募捐起止时间, 格式同 timeof.TimeOf
+func parseCampaignTime(input string) (*time.Time, bool) {
+	if input == "" {
+		return nil, true
+	}
+	t, ok := timeof.TimeOf(input)
+	if !ok {
+		return nil, false
+	}
+	return &t, true
+}
+
+// 1. 根据 pid 或 base64 编码获取项目信息
 func (a *ApiServer) GetProject(ctx *gin.Context) {
 	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
 	encodedItem := ctx.Param("item")
@@ -50,31 +83,44 @@ func (a *ApiServer) GetProject(ctx *gin.Context) {
 	pidUuid, err := uuid.FromString(encodedItem)
 	if err == nil && pidUuid != uuid.Nil {
 		project, err := a.store.GetProject(ctx, pidUuid.String())
-		if err != nil {
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			middleware.Error(ctx, apierr.ErrProjectNotFound)
+			return
+		case err != nil:
 			logger.Error().Err(err).Msg("failed to get project")
-			ctx.JSON(http.StatusBadRequest, gin.H{
-				"error": "failed to get project",
-			})
+			middleware.Error(ctx, apierr.ErrFailedToGetProject)
 			return
 		}
-		user, _ := a.store.GetUserByIdentityNumber(ctx, project.IdentityNumber)
-		response := GetProjectResponse{
-			Project: *project,
-			User:    user,
+		// 被封禁的项目不再公开
+		if project.BannedAt != nil {
+			middleware.Error(ctx, apierr.ErrProjectNotFound)
+			return
 		}
+		middleware.OK(ctx, a.newProjectResponse(ctx, project))
+		return
+	}
 
-		ctx.JSON(http.StatusOK, response)
+	project, ok := a.projectFromBase64(ctx, logger, encodedItem)
+	if !ok {
 		return
 	}
+	if project.BannedAt != nil {
+		middleware.Error(ctx, apierr.ErrProjectNotFound)
+		return
+	}
+	middleware.OK(ctx, a.newProjectResponse(ctx, project))
+	return
+}
 
-	// base64 解码
+// projectFromBase64 按 base64 链接中的项目信息查找已有项目, 链接的 alias 在创建和编辑项目时写入
+// 失败时已写入响应
+func (a *ApiServer) projectFromBase64(ctx *gin.Context, logger *logger.CtxLogger, encodedItem string) (*model.Project, bool) {
 	decodedBytes, err := base64.StdEncoding.DecodeString(encodedItem)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to decode base64 string")
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid base64 string",
-		})
-		return
+		middleware.Error(ctx, apierr.ErrInvalidBase64String)
+		return nil, false
 	}
 
 	var donateItem struct {
@@ -86,125 +132,41 @@ func (a *ApiServer) GetProject(ctx *gin.Context) {
 	}
 	if err := json.Unmarshal(decodedBytes, &donateItem); err != nil {
 		logger.Error().Err(err).Msg("failed to unmarshal json")
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid json",
-		})
-		return
+		middleware.Error(ctx, apierr.ErrInvalidJSON)
+		return nil, false
 	}
 
 	if len(donateItem.Title) == 0 || len(donateItem.IdentityNumber) == 0 {
 		logger.Error().Msg("title or mixin_uid is empty")
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"error": "title or mixin_uid is empty",
-		})
-		return
-	}
-	mixinUser, err := a.mixinClient.Client.ReadUser(ctx, donateItem.IdentityNumber)
-	if err != nil {
-		logger.Error().Err(err).Msg("failed to read user")
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"error": "failed to read user",
-		})
-		return
+		middleware.Error(ctx, apierr.ErrTitleOrMixinUidIsEmpty)
+		return nil, false
 	}
 
-	// 检查用户在本地库是否存在,存在更新,不存在创建
-	duser, err := a.store.GetUserByIdentityNumber(ctx, mixinUser.IdentityNumber)
+	// base64 链接只用于查找已有项目, 创建项目需要登录后调用 POST /projects
+	owner, err := a.store.GetUserByIdentityNumber(ctx, donateItem.IdentityNumber)
 	switch err {
 	case nil:
-		// 更新
-		duser = &model.User{
-			IdentityNumber: mixinUser.IdentityNumber,
-			FullName:       mixinUser.FullName,
-			MixinUID:       mixinUser.UserID,
-			AvatarUrl:      mixinUser.AvatarURL,
-			Biography:      mixinUser.Biography,
-			MixinCreatedAt: mixinUser.CreatedAt,
-			UpdatedAt:      time.Now(),
-		}
-		if err := a.store.UpdateUserBymuid(ctx, mixinUser.UserID, duser); err != nil {
-			logger.Error().Err(err).Msg("failed to update user")
-			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"error": "failed to update user",
-			})
-			return
-		}
 	case gorm.ErrRecordNotFound:
-		// 创建
-		duser = &model.User{
-			IdentityNumber: mixinUser.IdentityNumber,
-			FullName:       mixinUser.FullName,
-			MixinUID:       mixinUser.UserID,
-			AvatarUrl:      mixinUser.AvatarURL,
-			Biography:      mixinUser.Biography,
-			MixinCreatedAt: mixinUser.CreatedAt,
-			CreatedAt:      time.Now(),
-		}
-		if err := a.store.AddUser(ctx, duser); err != nil {
-			logger.Error().Err(err).Msg("failed to create user")
-			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"error": "failed to create user",
-			})
-			return
-		}
+		middleware.Error(ctx, apierr.ErrProjectNotFound)
+		return nil, false
 	default:
 		logger.Error().Err(err).Msg("failed to get user")
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to get user",
-		})
-		return
+		middleware.Error(ctx, apierr.ErrFailedToGetUser)
+		return nil, false
 	}
 
-	// 生成项目 ID
-	pid := utils.GenUuidFromStrings("donate", donateItem.Title, donateItem.Description, donateItem.ImgUrl, mixinUser.UserID)
-	project, err := a.store.GetProject(ctx, pid)
+	alias := utils.GenUuidFromStrings("donate", donateItem.Title, donateItem.Description, donateItem.ImgUrl, owner.MixinUID)
+	project, err := a.store.GetProjectByAlias(ctx, alias)
 	switch err {
-	case gorm.ErrRecordNotFound:
-		item := &model.Project{
-			PID:            pid,
-			Title:          donateItem.Title,
-			Description:    donateItem.Description,
-			IdentityNumber: donateItem.IdentityNumber,
-			ImgUrl:         donateItem.ImgUrl,
-			Link:           donateItem.Link,
-			MixinUID:       mixinUser.UserID,
-			CreatedAt:      time.Now(),
-		}
-		user, _ := a.store.GetUserByIdentityNumber(ctx, mixinUser.IdentityNumber)
-
-		err = a.store.AddProject(ctx, item)
-		if err != nil {
-			logger.Error().Err(err).Msg("failed to add project")
-			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"error": "failed to add project",
-			})
-			return
-		}
-		project, _ = a.store.GetProject(ctx, pid)
-		response := GetProjectResponse{
-			Project: *project,
-			User:    user,
-		}
-
-		// 直接将项目信息返回出去
-		ctx.JSON(http.StatusOK, response)
-		return
 	case nil:
+		return project, true
+	case gorm.ErrRecordNotFound:
+		middleware.Error(ctx, apierr.ErrProjectNotFound)
 	default:
 		logger.Error().Err(err).Msg("failed to get project")
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to get project",
-		})
-		return
-	}
-	user, _ := a.store.GetUserByIdentityNumber(ctx, project.IdentityNumber)
-	response := GetProjectResponse{
-		Project: *project,
-		User:    user,
+		middleware.Error(ctx, apierr.ErrFailedToGetProject)
 	}
-
-	ctx.JSON(http.StatusOK, response)
-	return
+	return nil, false
 }
 
 // 查询捐赠记录
@@ -215,11 +177,16 @@ type UserAction struct {
 	Biography      string          `json:"biography"`
 	AssetID        string          `json:"assetId"`
 	Amount         decimal.Decimal `json:"amount"`
+	Message        string          `json:"message,omitempty"` // 捐赠留言
+	Anonymous      bool            `json:"anonymous"`         // 匿名捐赠不返回捐赠者信息
 	Asset          model.Asset     `json:"asset"`
 	Project        model.Project   `json:"project"`
 	User           model.User      `json:"user"` // 被捐赠者
 }
 
+// anonymousDonorName 匿名捐赠者的展示名
+const anonymousDonorName = "Anonymous"
+
 // 1. 根据 pid 查询捐赠过的用户
 func (a *ApiServer) GetDonateUsersByPid(ctx *gin.Context) {
 	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
@@ -232,233 +199,178 @@ func (a *ApiServer) GetDonateUsersByPid(ctx *gin.Context) {
 		switch err {
 		case gorm.ErrRecordNotFound:
 			logger.Error().Err(err).Msg("project not found")
-			ctx.JSON(http.StatusNotFound, gin.H{
-				"error": "project not found",
-			})
+			middleware.Error(ctx, apierr.ErrProjectNotFound)
 			return
 		case nil:
 		default:
 			logger.Error().Err(err).Msg("failed to get project")
-			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"error": "failed to get project",
-			})
-			return
-		}
-		var recipientUser *model.User
-		recipientUser, _ = a.store.GetUserByIdentityNumber(ctx, project.IdentityNumber)
-
-		var response []UserAction
-
-		donateActions, err := a.store.QueryDonateActionsByPID(ctx, pid)
-		switch err {
-		case gorm.ErrRecordNotFound:
-			ctx.JSON(http.StatusNotFound, gin.H{
-				"error": "project not found",
-			})
-			return
-		case nil:
-		default:
-			logger.Error().Err(err).Msg("failed to get donate actions")
-			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"error": "failed to get donate actions",
-			})
+			middleware.Error(ctx, apierr.ErrFailedToGetProject)
 			return
 		}
-
-		assetMap := a.getAssetMap()
-		for _, action := range donateActions {
-			user, err := a.store.GetUserByIdentityNumber(ctx, action.IdentityNumber)
-			if err != nil {
-				logger.Error().Err(err).Msg("get user failed")
-				continue
-			}
-			asset, ok := assetMap[action.AssetID]
-			if !ok {
-				continue
-			}
-
-			userAction := &UserAction{
-				IdentityNumber: action.IdentityNumber,
-				FullName:       user.FullName,
-				AvatarUrl:      user.AvatarUrl,
-				Biography:      user.Biography,
-				AssetID:        action.AssetID,
-				Amount:         action.Amount,
-				Asset:          *asset,
-				Project:        *project,
-				User:           *recipientUser,
-			}
-			response = append(response, *userAction)
-		}
-
-		ctx.JSON(http.StatusOK, response)
+		a.listDonateUsers(ctx, logger, project)
 	} else {
-		encodedItem := pid
-		// base64 解码
-		decodedBytes, err := base64.StdEncoding.DecodeString(encodedItem)
-		if err != nil {
-			logger.Error().Err(err).Msg("failed to decode base64 string")
-			ctx.JSON(http.StatusBadRequest, gin.H{
-				"error": "invalid base64 string",
-			})
-			return
-		}
-		var donateItem struct {
-			Title          string `json:"title"`          // required
-			Description    string `json:"description"`    // optional
-			ImgUrl         string `json:"imgUrl"`         // optional
-			Link           string `json:"link"`           // optional
-			IdentityNumber string `json:"identityNumber"` // required
-		}
-		if err := json.Unmarshal([]byte(decodedBytes), &donateItem); err != nil {
-			logger.Error().Err(err).Msg("failed to unmarshal json")
-			ctx.JSON(http.StatusBadRequest, gin.H{
-				"error": "invalid json",
-			})
+		project, ok := a.projectFromBase64(ctx, logger, pid)
+		if !ok {
 			return
 		}
+		a.listDonateUsers(ctx, logger, project)
+	}
 
-		if len(donateItem.Title) == 0 || len(donateItem.IdentityNumber) == 0 {
-			logger.Error().Msg("title or mixin_uid is empty")
-			ctx.JSON(http.StatusBadRequest, gin.H{
-				"error": "title or mixin_uid is empty",
-			})
-			return
-		}
-		mixinUser, err := a.mixinClient.Client.ReadUser(ctx, donateItem.IdentityNumber)
-		if err != nil {
-			logger.Error().Err(err).Msg("failed to read user")
-			ctx.JSON(http.StatusBadRequest, gin.H{
-				"error": "failed to read user",
-			})
-			return
-		}
+	return
+}
 
-		pid := utils.GenUuidFromStrings("donate", donateItem.Title, donateItem.Description, donateItem.ImgUrl, mixinUser.UserID)
-		project, err := a.store.GetProject(ctx, pid)
-		switch err {
-		case gorm.ErrRecordNotFound:
-			logger.Error().Err(err).Msg("project not found")
-			ctx.JSON(http.StatusNotFound, gin.H{
-				"error": "project not found",
-			})
-			return
-		case nil:
-		default:
-			logger.Error().Err(err).Msg("failed to get project")
-			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"error": "failed to get project",
-			})
-			return
-		}
-		var recipientUser *model.User
+// listDonateUsers 返回项目的捐赠记录, 捐赠者和项目方批量查询
+func (a *ApiServer) listDonateUsers(ctx *gin.Context, logger *logger.CtxLogger, project *model.Project) {
+	query, err := ParseDonateActionQuery(ctx)
+	if err != nil {
+		middleware.Error(ctx, err)
+		return
+	}
+	query.PID = project.PID
+
+	var (
+		assetMap      map[string]*model.Asset
+		recipientUser *model.User
+		donateActions []*model.DonateAction
+		next          *model.Cursor
+	)
+	// 资产列表来自 mixin, 与数据库查询并行
+	err = mr.Finish(func() error {
+		assetMap = a.getAssetMap()
+		return nil
+	}, func() error {
 		recipientUser, _ = a.store.GetUserByIdentityNumber(ctx, project.IdentityNumber)
+		return nil
+	}, func() (err error) {
+		donateActions, next, err = a.store.QueryDonateActions(ctx, query)
+		return err
+	})
+	if err != nil {
+		middleware.Error(ctx, PageError(err, apierr.ErrFailedToGetDonateActions))
+		return
+	}
+	if recipientUser == nil {
+		recipientUser = &model.User{}
+	}
 
-		var response []UserAction
+	donors, err := a.store.ListUsersByIdentityNumbers(ctx, lo.Map(donateActions, func(action *model.DonateAction, _ int) string {
+		return action.IdentityNumber
+	}))
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to get users")
+		middleware.Error(ctx, apierr.ErrFailedToGetUser)
+		return
+	}
+	donorMap := lo.KeyBy(donors, func(user *model.User) string { return user.IdentityNumber })
 
-		donateActions, err := a.store.QueryDonateActionsByPID(ctx, pid)
-		switch err {
-		case gorm.ErrRecordNotFound:
-			ctx.JSON(http.StatusNotFound, gin.H{
-				"error": "project not found",
-			})
-			return
-		case nil:
-		default:
-			logger.Error().Err(err).Msg("failed to get donate actions")
-			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"error": "failed to get donate actions",
-			})
-			return
+	var response []UserAction
+	for _, action := range donateActions {
+		user, ok := donorMap[action.IdentityNumber]
+		if !ok {
+			continue
 		}
-
-		assetMap := a.getAssetMap()
-		for _, action := range donateActions {
-			user, err := a.store.GetUserByIdentityNumber(ctx, action.IdentityNumber)
-			if err != nil {
-				logger.Error().Err(err).Msg("get user failed")
-				continue
-			}
-			asset, ok := assetMap[action.AssetID]
-			if !ok {
-				continue
-			}
-
-			userAction := &UserAction{
-				IdentityNumber: action.IdentityNumber,
-				FullName:       user.FullName,
-				AvatarUrl:      user.AvatarUrl,
-				Biography:      user.Biography,
-				AssetID:        action.AssetID,
-				Amount:         action.Amount,
-				Asset:          *asset,
-				Project:        *project,
-				User:           *recipientUser,
-			}
-			response = append(response, *userAction)
+		asset, ok := assetMap[action.AssetID]
+		if !ok {
+			continue
 		}
 
-		ctx.JSON(http.StatusOK, response)
+		userAction := &UserAction{
+			IdentityNumber: action.IdentityNumber,
+			FullName:       user.FullName,
+			AvatarUrl:      user.AvatarUrl,
+			Biography:      user.Biography,
+			AssetID:        action.AssetID,
+			Amount:         action.Amount,
+			Message:        action.Message,
+			Anonymous:      action.Anonymous,
+			Asset:          *asset,
+			Project:        *project,
+			User:           *recipientUser,
+		}
+		if action.Anonymous {
+			userAction.IdentityNumber = ""
+			userAction.FullName = anonymousDonorName
+			userAction.AvatarUrl = ""
+			userAction.Biography = ""
+		}
+		response = append(response, *userAction)
 	}
 
-	return
+	SetNextCursor(ctx, next)
+	middleware.OK(ctx, response)
 }
 
 // 2. 项目列表
 func (a *ApiServer) GetProjects(ctx *gin.Context) {
 	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
 
-	query := ctx.Request.URL.Query()
-	limit, err := strconv.ParseInt(query.Get("limit"), 10, 64)
-	if err != nil || limit <= 0 {
-		limit = 10
+	// 兼容 offset 分页, 有 cursor 时忽略 offset
+	limit, cursor, err := ParsePage(ctx, 10, 100)
+	if err != nil {
+		middleware.Error(ctx, err)
+		return
 	}
-	offset, err := strconv.ParseInt(query.Get("offset"), 10, 64)
+	offset, err := strconv.ParseInt(ctx.Query("offset"), 10, 64)
 	if err != nil || offset < 0 {
 		offset = 0
 	}
 
 	var response struct {
 		Items []struct {
-			Project *model.Project `json:"project"`
-			User    *model.User    `json:"user"`
+			Project  *model.Project  `json:"project"`
+			User     *model.User     `json:"user"`
+			Campaign *model.Campaign `json:"campaign"`
 		} `json:"items"`
 	}
 
-	var projects []*model.Project
-	if ident := query.Get("identity_number"); ident != "" {
-		projects, err = a.store.GetProjectsByIdentityNumber(ctx, ident, limit, offset)
-	} else {
-		projects, err = a.store.ListProjects(ctx, limit, offset)
+	// sort: donate_cnt (默认) 或 raised_usd
+	projects, next, err := a.store.ListProjects(ctx, &model.ProjectQuery{
+		IdentityNumber: ctx.Query("identity_number"),
+		OrderBy:        ctx.Query("sort"),
+		Limit:          limit,
+		Offset:         offset,
+		Cursor:         cursor,
+	})
+	if err != nil {
+		middleware.Error(ctx, PageError(err, apierr.ErrFailedToGetProjects))
+		return
 	}
 
-	switch err {
-	case gorm.ErrRecordNotFound:
-		ctx.JSON(http.StatusNotFound, gin.H{
-			"error": "projects not found",
-		})
-		return
-	case nil:
-	default:
-		logger.Error().Err(err).Msg("failed to get projects")
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to get projects",
-		})
-		return
+	// 项目方和募捐统计批量查询, 查询失败时对应字段为空
+	owners, err := a.store.ListUsersByIdentityNumbers(ctx, lo.Map(projects, func(project *model.Project, _ int) string {
+		return project.IdentityNumber
+	}))
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to get project owners")
 	}
+	ownerMap := lo.KeyBy(owners, func(user *model.User) string { return user.IdentityNumber })
 
+	// 仅以资产为目标的项目需要统计
+	totals, err := a.store.ListProjectAssetTotalsByPIDs(ctx, lo.FilterMap(projects, func(project *model.Project, _ int) (string, bool) {
+		return project.PID, project.GoalAssetID != ""
+	}))
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to get project asset totals")
+	}
+	totalMap := lo.GroupBy(totals, func(total *model.ProjectAssetTotal) string { return total.PID })
+
+	now := time.Now()
 	for _, project := range projects {
-		user, _ := a.store.GetUserByIdentityNumber(ctx, project.IdentityNumber)
+		// 项目方未登录过时 user 为 null
+		owner := ownerMap[project.IdentityNumber]
 		response.Items = append(response.Items, struct {
-			Project *model.Project `json:"project"`
-			User    *model.User    `json:"user"`
+			Project  *model.Project  `json:"project"`
+			User     *model.User     `json:"user"`
+			Campaign *model.Campaign `json:"campaign"`
 		}{
-			Project: project,
-			User:    user,
+			Project:  project,
+			User:     owner,
+			Campaign: project.Campaign(now, totalMap[project.PID]),
 		})
 	}
 
-	ctx.JSON(http.StatusOK, response)
+	SetNextCursor(ctx, next)
+	middleware.OK(ctx, response)
 	return
 
 }
@@ -472,14 +384,14 @@ func (a *ApiServer) SearchUser(ctx *gin.Context) {
 	searchTerm := ident + prefix
 
 	if searchTerm == "" {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "identity_number or prefix is required"})
+		middleware.Error(ctx, apierr.ErrIdentityNumberOrPrefixIsRequired)
 		return
 	}
 
 	users, err := a.store.UserStore.ListUsers(ctx)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to list users")
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search users"})
+		middleware.Error(ctx, apierr.ErrFailedToSearchUsers)
 		return
 	}
 
@@ -491,11 +403,11 @@ func (a *ApiServer) SearchUser(ctx *gin.Context) {
 	}
 
 	if len(matchedUsers) == 0 {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "no users found"})
+		middleware.Error(ctx, apierr.ErrNoUsersFound)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, matchedUsers)
+	middleware.OK(ctx, matchedUsers)
 }
 
 // 3. 用户列表
@@ -504,10 +416,10 @@ func (a *ApiServer) GetUsers(ctx *gin.Context) {
 	users, err := a.store.UserStore.ListUsers(ctx)
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to list users")
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list users"})
+		middleware.Error(ctx, apierr.ErrFailedToListUsers)
 		return
 	}
-	ctx.JSON(http.StatusOK, users)
+	middleware.OK(ctx, users)
 }
 
 func (a *ApiServer) GetUserByIdentityNumber(ctx *gin.Context) {
@@ -517,10 +429,9 @@ func (a *ApiServer) GetUserByIdentityNumber(ctx *gin.Context) {
 	switch err {
 	case nil:
 	case gorm.ErrRecordNotFound:
-		mixinUser, err := a.mixinClient.Client.ReadUser(ctx, ident)
+		mixinUser, err := a.mixinClient.ReadUser(ctx, ident)
 		if err != nil {
-			logger.Error().Err(err).Msg("failed to read user")
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read user"})
+			a.readUserError(ctx, logger, err)
 			return
 		}
 		user = &model.User{
@@ -536,21 +447,31 @@ func (a *ApiServer) GetUserByIdentityNumber(ctx *gin.Context) {
 		err = a.store.UserStore.AddUser(ctx, user)
 		if err != nil {
 			logger.Error().Err(err).Msg("failed to create user")
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user"})
+			middleware.Error(ctx, apierr.ErrFailedToCreateUser)
 			return
 		}
 		user, err = a.store.UserStore.GetUserByIdentityNumber(ctx, ident)
 		if err != nil {
 			logger.Error().Err(err).Msg("failed to get user")
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user"})
+			middleware.Error(ctx, apierr.ErrFailedToGetUser)
 			return
 		}
-		ctx.JSON(http.StatusOK, user)
-		return
 	default:
+		logger.Error().Err(err).Msg("failed to get user")
+		middleware.Error(ctx, apierr.ErrFailedToGetUser)
+		return
 	}
-	ctx.JSON(http.StatusOK, user)
-	return
+	middleware.OK(ctx, user)
+}
+
+// readUserError mixin 上不存在的用户返回 404, 其他错误为 mixin 接口失败
+func (a *ApiServer) readUserError(ctx *gin.Context, logger *logger.CtxLogger, err error) {
+	if mixin.IsErrorCodes(err, mixin.EndpointNotFound) {
+		middleware.Error(ctx, apierr.ErrUserNotFound)
+		return
+	}
+	logger.Error().Err(err).Msg("failed to read user")
+	middleware.Error(ctx, apierr.ErrFailedToReadUser)
 }
 
 // 4. 查询用户捐赠的项目列表
@@ -559,33 +480,76 @@ func (a *ApiServer) GetProjectsByIdentityNumber(ctx *gin.Context) {
 
 	ident := ctx.Param("ident")
 	if ident == "" {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "identity_number is required"})
+		middleware.Error(ctx, apierr.ErrIdentityNumberIsRequired)
 		return
 	}
 	user, err := a.store.UserStore.GetUserByIdentityNumber(ctx, ident)
-	if err != nil {
+	switch err {
+	case nil:
+	case gorm.ErrRecordNotFound:
+		middleware.Error(ctx, apierr.ErrUserNotFound)
+		return
+	default:
 		logger.Error().Err(err).Msg("failed to get user")
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user"})
+		middleware.Error(ctx, apierr.ErrFailedToGetUser)
 		return
 	}
 
-	actions, err := a.store.DonateActionStore.QueryDonateActionsByIdentityNumber(ctx, ident)
+	query, err := ParseDonateActionQuery(ctx)
+	if err != nil {
+		middleware.Error(ctx, err)
+		return
+	}
+	// 匿名捐赠不出现在捐赠者的公开记录中
+	query.IdentityNumber = ident
+	query.ExcludeAnonymous = true
+	actions, next, err := a.store.QueryDonateActions(ctx, query)
 	if err != nil {
-		logger.Error().Err(err).Msg("failed to query donate actions")
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query donate actions"})
+		middleware.Error(ctx, PageError(err, apierr.ErrFailedToQueryDonateActions))
 		return
 	}
 
-	assetMap := a.getAssetMap()
-	var response []*UserAction
+	// 资产列表来自 mixin, 与数据库查询并行
+	var (
+		assetMap map[string]*model.Asset
+		projects []*model.Project
+	)
+	err = mr.Finish(func() error {
+		assetMap = a.getAssetMap()
+		return nil
+	}, func() (err error) {
+		projects, err = a.store.ListProjectsByPIDs(ctx, lo.Map(actions, func(action *model.DonateAction, _ int) string {
+			return action.PID
+		}))
+		return err
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to get projects")
+		middleware.Error(ctx, apierr.ErrFailedToGetProjects)
+		return
+	}
+	projectMap := lo.KeyBy(projects, func(project *model.Project) string { return project.PID })
+
+	recipients, err := a.store.ListUsersByIdentityNumbers(ctx, lo.Map(projects, func(project *model.Project, _ int) string {
+		return project.IdentityNumber
+	}))
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to get users")
+		middleware.Error(ctx, apierr.ErrFailedToGetUser)
+		return
+	}
+	recipientMap := lo.KeyBy(recipients, func(user *model.User) string { return user.IdentityNumber })
 
+	var response []*UserAction
 	for _, action := range actions {
-		project, err := a.store.GetProject(ctx, action.PID)
-		if err != nil {
+		project, ok := projectMap[action.PID]
+		if !ok {
 			continue
 		}
-		var recipUser *model.User
-		recipUser, _ = a.store.GetUserByIdentityNumber(ctx, project.IdentityNumber)
+		recipUser, ok := recipientMap[project.IdentityNumber]
+		if !ok {
+			recipUser = &model.User{}
+		}
 
 		asset, ok := assetMap[action.AssetID]
 		if !ok {
@@ -598,6 +562,7 @@ func (a *ApiServer) GetProjectsByIdentityNumber(ctx *gin.Context) {
 			Biography:      user.Biography,
 			AssetID:        action.AssetID,
 			Amount:         action.Amount,
+			Message:        action.Message,
 			Asset:          *asset,
 			Project:        *project,
 			User:           *recipUser,
@@ -605,15 +570,18 @@ func (a *ApiServer) GetProjectsByIdentityNumber(ctx *gin.Context) {
 		response = append(response, res)
 	}
 
-	ctx.JSON(http.StatusOK, response)
+	SetNextCursor(ctx, next)
+	middleware.OK(ctx, response)
 }
 
 func (a *ApiServer) GetAssets(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
 	assetA, err := a.assetCf.Do("all_asset", func() (val interface{}, err error) {
-		return a.mixinClient.Client.SafeReadAssets(ctx)
+		return a.mixinClient.ListAssets(ctx)
 	})
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get assets"})
+		logger.Error().Err(err).Msg("failed to list assets")
+		middleware.Error(ctx, apierr.ErrFailedToGetAssets)
 		return
 	}
 
@@ -648,12 +616,12 @@ func (a *ApiServer) GetAssets(ctx *gin.Context) {
 		}
 	}
 
-	ctx.JSON(http.StatusOK, response)
+	middleware.OK(ctx, response)
 }
 
 func (a *ApiServer) getAssetMap() (assetMap map[string]*model.Asset) {
 	assetA, err := a.assetCf.Do("all_asset", func() (val interface{}, err error) {
-		return a.mixinClient.Client.SafeReadAssets(context.TODO())
+		return a.mixinClient.ListAssets(context.TODO())
 	})
 	if err != nil {
 		return
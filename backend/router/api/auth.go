@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"donate/logger"
+	"donate/model"
+	"donate/pkg/apierr"
+	"donate/pkg/jwt"
+	"donate/router/middleware"
+	"time"
+
+	"github.com/fox-one/mixin-sdk-go/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type OAuthRequest struct {
+	Code         string `json:"code"`         // required
+	CodeVerifier string `json:"codeVerifier"` // optional, PKCE
+}
+
+type OAuthResponse struct {
+	Token string      `json:"token"`
+	User  *model.User `json:"user"`
+}
+
+// OAuth 使用 mixin oauth code 换取 access token, 读取用户信息后签发 jwt
+func (a *ApiServer) OAuth(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	var req OAuthRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		middleware.Error(ctx, apierr.ErrCodeIsRequired)
+		return
+	}
+
+	accessToken, _, err := mixin.AuthorizeToken(ctx, a.mixinConf.ClientID, a.mixinConf.ClientSecret, req.Code, req.CodeVerifier)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to authorize token")
+		middleware.Error(ctx, apierr.ErrFailedToAuthorize)
+		return
+	}
+
+	mixinUser, err := mixin.UserMe(ctx, accessToken)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to read user")
+		middleware.Error(ctx, apierr.ErrFailedToReadUser)
+		return
+	}
+
+	// mixin 的用户信息不包含语言, 首次登录时使用请求的语言
+	var lang string
+	if ctx.GetHeader("Accept-Language") != "" {
+		lang = middleware.GetLanguage(ctx)
+	}
+	user, err := a.saveMixinUser(ctx, mixinUser, lang)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to save user")
+		middleware.Error(ctx, apierr.ErrFailedToSaveUser)
+		return
+	}
+
+	if user.BannedAt != nil {
+		middleware.Error(ctx, apierr.ErrUserBanned)
+		return
+	}
+
+	token, err := jwt.GenToken(mixinUser.UserID)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to generate token")
+		middleware.Error(ctx, apierr.ErrFailedToGenerateToken)
+		return
+	}
+
+	middleware.OK(ctx, OAuthResponse{
+		Token: token,
+		User:  user,
+	})
+}
+
+// GetMe 当前登录的用户
+func (a *ApiServer) GetMe(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	user, err := a.store.GetUserByUID(ctx, middleware.GetUserID(ctx))
+	switch err {
+	case nil:
+	case gorm.ErrRecordNotFound:
+		middleware.Error(ctx, apierr.ErrUserNotFound)
+		return
+	default:
+		logger.Error().Err(err).Msg("failed to get user")
+		middleware.Error(ctx, apierr.ErrFailedToGetUser)
+		return
+	}
+
+	middleware.OK(ctx, user)
+}
+
+type UpdateLanguageRequest struct {
+	Language string `json:"language"` // en, zh 或配置中增加的语言, zh-CN 等保存为 zh
+}
+
+// UpdateMyLanguage 保存当前用户的语言, 用于捐赠通知和转账 memo
+func (a *ApiServer) UpdateMyLanguage(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	var req UpdateLanguageRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		middleware.Error(ctx, apierr.ErrInvalidJSON)
+		return
+	}
+	lang, ok := middleware.GetCatalog(ctx).Resolve(req.Language)
+	if !ok {
+		middleware.Error(ctx, apierr.ErrInvalidLanguage)
+		return
+	}
+
+	uid := middleware.GetUserID(ctx)
+	if err := a.store.UpdateUserBymuid(ctx, uid, &model.User{Language: lang, UpdatedAt: time.Now()}); err != nil {
+		logger.Error().Err(err).Msg("failed to update user")
+		middleware.Error(ctx, apierr.ErrFailedToUpdateUser)
+		return
+	}
+
+	user, err := a.store.GetUserByUID(ctx, uid)
+	switch err {
+	case nil:
+	case gorm.ErrRecordNotFound:
+		middleware.Error(ctx, apierr.ErrUserNotFound)
+		return
+	default:
+		logger.Error().Err(err).Msg("failed to get user")
+		middleware.Error(ctx, apierr.ErrFailedToGetUser)
+		return
+	}
+
+	middleware.OK(ctx, user)
+}
+
+// saveMixinUser 检查用户在本地库是否存在,存在更新,不存在创建
+// lang 只在用户没有保存语言时写入
+func (a *ApiServer) saveMixinUser(ctx context.Context, mixinUser *mixin.User, lang string) (*model.User, error) {
+	user := &model.User{
+		IdentityNumber: mixinUser.IdentityNumber,
+		FullName:       mixinUser.FullName,
+		MixinUID:       mixinUser.UserID,
+		AvatarUrl:      mixinUser.AvatarURL,
+		Biography:      mixinUser.Biography,
+		MixinCreatedAt: mixinUser.CreatedAt,
+	}
+
+	existing, err := a.store.GetUserByUID(ctx, mixinUser.UserID)
+	switch err {
+	case nil:
+		if existing.Language == "" {
+			user.Language = lang
+		}
+		user.UpdatedAt = time.Now()
+		if err := a.store.UpdateUserBymuid(ctx, mixinUser.UserID, user); err != nil {
+			return nil, err
+		}
+	case gorm.ErrRecordNotFound:
+		user.Language = lang
+		user.CreatedAt = time.Now()
+		if err := a.store.AddUser(ctx, user); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	return a.store.GetUserByUID(ctx, mixinUser.UserID)
+}
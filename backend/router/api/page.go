@@ -0,0 +1,118 @@
+package api
+
+import (
+	"donate/model"
+	"donate/pkg/apierr"
+	"donate/pkg/timeof"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// NextCursorHeader 下一页的 cursor, 最后一页不返回
+// 下一页请求时以 cursor 参数原样传回, 过滤和排序参数需与本页相同
+const NextCursorHeader = "X-Next-Cursor"
+
+// ParsePage 解析 limit 和 cursor, limit 默认为 defaultLimit, 最大为 maxLimit
+func ParsePage(ctx *gin.Context, defaultLimit, maxLimit int64) (int64, *model.Cursor, error) {
+	limit, err := strconv.ParseInt(ctx.Query("limit"), 10, 64)
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	cursor, err := model.ParseCursor(ctx.Query("cursor"))
+	if err != nil {
+		return 0, nil, apierr.ErrInvalidCursor
+	}
+	return limit, cursor, nil
+}
+
+// SetNextCursor 在响应头返回下一页的 cursor
+func SetNextCursor(ctx *gin.Context, next *model.Cursor) {
+	if next != nil {
+		ctx.Header(NextCursorHeader, next.String())
+	}
+}
+
+// PageError 与查询排序不一致的 cursor 返回 400, 其他错误返回 fallback
+func PageError(err error, fallback *apierr.Error) *apierr.Error {
+	if errors.Is(err, model.ErrInvalidCursor) {
+		return apierr.ErrInvalidCursor
+	}
+	return fallback.Wrap(err)
+}
+
+const (
+	donationPageLimit    = 100
+	donationMaxPageLimit = 500
+)
+
+// ParseDonateActionQuery 解析捐赠记录的分页, 过滤和排序参数
+// 未传 limit 和 cursor 时不分页, 返回全部记录, 与分页之前的接口兼容
+//
+//	asset: 资产 id
+//	since, until: 时间范围 [since, until), 支持 pkg/timeof 的格式
+//	min_amount: 最小金额, 按资产数量
+//	sort: time (默认), amount 或 usd; order: desc (默认) 或 asc
+func ParseDonateActionQuery(ctx *gin.Context) (*model.DonateActionQuery, error) {
+	limit, cursor, err := ParsePage(ctx, donationPageLimit, donationMaxPageLimit)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Query("limit") == "" && cursor == nil {
+		limit = 0
+	}
+	query := &model.DonateActionQuery{
+		AssetID: ctx.Query("asset"),
+		Limit:   limit,
+		Cursor:  cursor,
+	}
+
+	for _, item := range []struct {
+		param string
+		t     *time.Time
+	}{
+		{"since", &query.Since},
+		{"until", &query.Until},
+	} {
+		if v := ctx.Query(item.param); v != "" {
+			t, ok := timeof.TimeOf(v)
+			if !ok {
+				return nil, apierr.ErrInvalidTimeRange
+			}
+			*item.t = t
+		}
+	}
+	if !query.Since.IsZero() && !query.Until.IsZero() && !query.Since.Before(query.Until) {
+		return nil, apierr.ErrInvalidTimeRange
+	}
+
+	if v := ctx.Query("min_amount"); v != "" {
+		amount, err := decimal.NewFromString(v)
+		if err != nil || amount.IsNegative() {
+			return nil, apierr.ErrInvalidAmount
+		}
+		query.MinAmount = amount
+	}
+
+	switch sort := ctx.Query("sort"); sort {
+	case "", model.DonateActionOrderByTime, model.DonateActionOrderByAmount, model.DonateActionOrderByAmountUSD:
+		query.OrderBy = sort
+	default:
+		return nil, apierr.ErrInvalidSort
+	}
+	switch ctx.Query("order") {
+	case "", "desc":
+	case "asc":
+		query.Asc = true
+	default:
+		return nil, apierr.ErrInvalidSort
+	}
+
+	return query, nil
+}
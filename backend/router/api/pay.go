@@ -0,0 +1,190 @@
+package api
+
+import (
+	"bytes"
+	"donate/logger"
+	"donate/pkg/apierr"
+	"donate/pkg/memo"
+	"donate/router/middleware"
+	"donate/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/skip2/go-qrcode"
+	"gorm.io/gorm"
+)
+
+const (
+	payFormatJSON = "json"
+	payFormatPNG  = "png"
+	payFormatSVG  = "svg"
+
+	defaultQRCodeSize = 256
+	maxQRCodeSize     = 1024
+)
+
+type PaymentResponse struct {
+	URI    string          `json:"uri"`   // mixin.one 支付链接
+	Trace  string          `json:"trace"` // 由参数确定, 相同参数的链接只能支付一次
+	Memo   string          `json:"memo"`
+	PID    string          `json:"pid"`
+	Asset  string          `json:"asset"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+// GetPaymentLink 生成向项目捐赠的 mixin.one 支付链接或对应的二维码
+// query: asset, amount 必填; message, anonymous, referral, return_to, nonce 可选
+// format 为 json (默认), png 或 svg, png 可以用 size 指定边长
+func (a *ApiServer) GetPaymentLink(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	pid, err := uuid.FromString(ctx.Param("item"))
+	if err != nil || pid == uuid.Nil {
+		middleware.Error(ctx, apierr.ErrInvalidPID)
+		return
+	}
+	assetID, err := uuid.FromString(ctx.Query("asset"))
+	if err != nil || assetID == uuid.Nil {
+		middleware.Error(ctx, apierr.ErrInvalidAsset)
+		return
+	}
+	amount, err := decimal.NewFromString(ctx.Query("amount"))
+	if err != nil || !amount.IsPositive() {
+		middleware.Error(ctx, apierr.ErrInvalidAmount)
+		return
+	}
+	returnTo := ctx.Query("return_to")
+	if returnTo != "" {
+		if u, err := url.Parse(returnTo); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			middleware.Error(ctx, apierr.ErrInvalidReturnTo)
+			return
+		}
+	}
+	// 留言和推荐码不做截断, 过长时直接拒绝, 避免支付的内容与用户填写的不一致
+	message, referral := strings.TrimSpace(ctx.Query("message")), strings.TrimSpace(ctx.Query("referral"))
+	// 长度按编码后的字节数计算, 与 memo 的截断规则一致
+	if memo.EncodedLen(message) > memo.MaxMessageLength {
+		middleware.Error(ctx, apierr.ErrInvalidMessage)
+		return
+	}
+	if memo.EncodedLen(referral) > memo.MaxReferralLength {
+		middleware.Error(ctx, apierr.ErrInvalidReferral)
+		return
+	}
+	format := ctx.DefaultQuery("format", payFormatJSON)
+	if format != payFormatJSON && format != payFormatPNG && format != payFormatSVG {
+		middleware.Error(ctx, apierr.ErrInvalidFormat)
+		return
+	}
+
+	project, err := a.store.GetProject(ctx, pid.String())
+	switch {
+	case err == gorm.ErrRecordNotFound || (err == nil && project.BannedAt != nil):
+		middleware.Error(ctx, apierr.ErrProjectNotFound)
+		return
+	case err != nil:
+		logger.Error().Err(err).Msg("failed to get project")
+		middleware.Error(ctx, apierr.ErrFailedToGetProject)
+		return
+	case project.ArchivedAt != nil:
+		middleware.Error(ctx, apierr.ErrProjectArchived)
+		return
+	}
+
+	if _, ok := a.getAssetMap()[assetID.String()]; !ok {
+		middleware.Error(ctx, apierr.ErrUnsupportedAsset)
+		return
+	}
+	if a.mixinConf == nil || a.mixinConf.ClientID == "" {
+		logger.Error().Msg("mixin client id not configured")
+		middleware.Error(ctx, apierr.ErrPaymentNotAvailable)
+		return
+	}
+
+	anonymous, _ := strconv.ParseBool(ctx.Query("anonymous"))
+	donateMemo, err := memo.Encode(&memo.Memo{
+		PID:       project.PID,
+		Message:   message,
+		Anonymous: anonymous,
+		Referral:  referral,
+	})
+	if errors.Is(err, memo.ErrMemoTooLong) {
+		middleware.Error(ctx, apierr.ErrMemoTooLong)
+		return
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to encode memo")
+		middleware.Error(ctx, apierr.ErrFailedToEncodeMemo)
+		return
+	}
+
+	// 相同参数生成相同的 trace, 重复打开链接不会重复支付; 需要多次支付时传入不同的 nonce
+	trace := utils.GenUuidFromStrings("donate-pay", project.PID, assetID.String(), amount.String(), donateMemo, ctx.Query("nonce"))
+	uri := utils.BuildMixinOneSafePaymentURI(utils.PaymentParams{
+		UUID:     a.mixinConf.ClientID,
+		Asset:    assetID.String(),
+		Amount:   amount.String(),
+		Memo:     donateMemo,
+		Trace:    trace,
+		ReturnTo: returnTo,
+	})
+
+	switch format {
+	case payFormatPNG:
+		size, err := strconv.Atoi(ctx.Query("size"))
+		if err != nil || size <= 0 {
+			size = defaultQRCodeSize
+		}
+		if size > maxQRCodeSize {
+			size = maxQRCodeSize
+		}
+		png, err := qrcode.Encode(uri, qrcode.Medium, size)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to encode qrcode")
+			middleware.Error(ctx, apierr.ErrFailedToEncodeQRCode)
+			return
+		}
+		ctx.Data(http.StatusOK, "image/png", png)
+	case payFormatSVG:
+		qr, err := qrcode.New(uri, qrcode.Medium)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to encode qrcode")
+			middleware.Error(ctx, apierr.ErrFailedToEncodeQRCode)
+			return
+		}
+		ctx.Data(http.StatusOK, "image/svg+xml", qrcodeSVG(qr.Bitmap()))
+	default:
+		middleware.OK(ctx, PaymentResponse{
+			URI:    uri,
+			Trace:  trace,
+			Memo:   donateMemo,
+			PID:    project.PID,
+			Asset:  assetID.String(),
+			Amount: amount,
+		})
+	}
+}
+
+// qrcodeSVG 将二维码矩阵 (含静区) 渲染为 svg, 每个模块为一个单位
+func qrcodeSVG(bitmap [][]bool) []byte {
+	var buf bytes.Buffer
+	size := len(bitmap)
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, size, size)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"donate/logger"
+	"donate/model"
+	"donate/pkg/apierr"
+	"donate/router/middleware"
+	"donate/utils"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// ProjectRequest 创建和编辑项目的请求体
+type ProjectRequest struct {
+	Title       string          `json:"title"`       // required
+	Description string          `json:"description"` // optional
+	ImgUrl      string          `json:"imgUrl"`      // optional
+	Link        string          `json:"link"`        // optional
+	GoalAssetID string          `json:"goalAssetId"` // optional, 为空表示以 USD 计
+	GoalAmount  decimal.Decimal `json:"goalAmount"`  // optional
+	StartAt     string          `json:"startAt"`     // optional
+	EndAt       string          `json:"endAt"`       // optional
+}
+
+// apply 校验请求并写入 project 的可编辑字段
+func (r *ProjectRequest) apply(project *model.Project) bool {
+	startAt, okStart := parseCampaignTime(r.StartAt)
+	endAt, okEnd := parseCampaignTime(r.EndAt)
+	if r.Title == "" || !okStart || !okEnd || r.GoalAmount.IsNegative() {
+		return false
+	}
+
+	project.Title = r.Title
+	project.Description = r.Description
+	project.ImgUrl = r.ImgUrl
+	project.Link = r.Link
+	project.GoalAssetID = r.GoalAssetID
+	project.GoalAmount = r.GoalAmount
+	project.StartAt = startAt
+	project.EndAt = endAt
+	return true
+}
+
+// CreateProject 当前登录用户创建项目
+func (a *ApiServer) CreateProject(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+	uid := middleware.GetUserID(ctx)
+
+	owner, err := a.store.GetUserByUID(ctx, uid)
+	switch err {
+	case nil:
+	case gorm.ErrRecordNotFound:
+		middleware.Error(ctx, apierr.ErrUserNotFound)
+		return
+	default:
+		logger.Error().Err(err).Msg("failed to get user")
+		middleware.Error(ctx, apierr.ErrFailedToGetUser)
+		return
+	}
+
+	if owner.BannedAt != nil {
+		middleware.Error(ctx, apierr.ErrUserBanned)
+		return
+	}
+
+	var req ProjectRequest
+	project := &model.Project{
+		IdentityNumber: owner.IdentityNumber,
+		MixinUID:       owner.MixinUID,
+		CreatedAt:      time.Now(),
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil || !req.apply(project) {
+		middleware.Error(ctx, apierr.ErrInvalidProject)
+		return
+	}
+
+	// pid 随机生成, 编辑内容后保持不变; 按内容生成的旧版 ID 作为别名, 使 base64 链接仍然可用
+	project.PID = utils.RandomTraceID()
+	alias := projectAlias(project)
+	_, err = a.store.GetProjectByAlias(ctx, alias)
+	switch err {
+	case gorm.ErrRecordNotFound:
+	case nil:
+		middleware.Error(ctx, apierr.ErrProjectAlreadyExists)
+		return
+	default:
+		logger.Error().Err(err).Msg("failed to get project")
+		middleware.Error(ctx, apierr.ErrFailedToGetProject)
+		return
+	}
+
+	if err := a.store.AddProject(ctx, project, alias); err != nil {
+		logger.Error().Err(err).Msg("failed to add project")
+		middleware.Error(ctx, apierr.ErrFailedToAddProject)
+		return
+	}
+
+	middleware.OK(ctx, a.newProjectResponse(ctx, project))
+}
+
+// UpdateProject 编辑自己的项目, pid 保持不变
+func (a *ApiServer) UpdateProject(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	project, ok := a.getOwnedProject(ctx)
+	if !ok {
+		return
+	}
+
+	var req ProjectRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil || !req.apply(project) {
+		middleware.Error(ctx, apierr.ErrInvalidProject)
+		return
+	}
+
+	if err := a.store.UpdateProject(ctx, project); err != nil {
+		logger.Error().Err(err).Msg("failed to update project")
+		middleware.Error(ctx, apierr.ErrFailedToUpdateProject)
+		return
+	}
+
+	// 新内容对应的 base64 链接也指向该项目, 旧链接保留
+	if err := a.store.AddProjectAlias(ctx, project.PID, projectAlias(project)); err != nil {
+		logger.Error().Err(err).Msg("failed to add project alias")
+	}
+
+	middleware.OK(ctx, a.newProjectResponse(ctx, project))
+}
+
+// DeleteProject 删除自己的项目, 已有捐赠的项目返回 409, 需改为归档
+func (a *ApiServer) DeleteProject(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	project, ok := a.getOwnedProject(ctx)
+	if !ok {
+		return
+	}
+
+	err := a.store.DeleteProject(ctx, project.PID)
+	if errors.Is(err, model.ErrProjectHasDonations) {
+		middleware.Error(ctx, apierr.ErrProjectHasDonations)
+		return
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to delete project")
+		middleware.Error(ctx, apierr.ErrFailedToDeleteProject)
+		return
+	}
+
+	middleware.OK(ctx, gin.H{"pid": project.PID})
+}
+
+// ArchiveProject 归档自己的项目, 归档后不再接收捐赠, 已有记录保留
+func (a *ApiServer) ArchiveProject(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	project, ok := a.getOwnedProject(ctx)
+	if !ok {
+		return
+	}
+
+	if project.ArchivedAt == nil {
+		now := time.Now()
+		if err := a.store.ArchiveProject(ctx, project.PID, now); err != nil {
+			logger.Error().Err(err).Msg("failed to archive project")
+			middleware.Error(ctx, apierr.ErrFailedToArchiveProject)
+			return
+		}
+		project.ArchivedAt = &now
+	}
+
+	middleware.OK(ctx, a.newProjectResponse(ctx, project))
+}
+
+// projectAlias 旧版 base64 链接按项目内容生成的 ID
+func projectAlias(project *model.Project) string {
+	return utils.GenUuidFromStrings("donate", project.Title, project.Description, project.ImgUrl, project.MixinUID)
+}
+
+// getOwnedProject 读取路径中的项目并校验属于当前登录用户, 失败时已写入响应
+func (a *ApiServer) getOwnedProject(ctx *gin.Context) (*model.Project, bool) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	project, err := a.store.GetProject(ctx, ctx.Param("pid"))
+	switch err {
+	case nil:
+	case gorm.ErrRecordNotFound:
+		middleware.Error(ctx, apierr.ErrProjectNotFound)
+		return nil, false
+	default:
+		logger.Error().Err(err).Msg("failed to get project")
+		middleware.Error(ctx, apierr.ErrFailedToGetProject)
+		return nil, false
+	}
+
+	if project.MixinUID != middleware.GetUserID(ctx) {
+		middleware.Error(ctx, apierr.ErrNotTheProjectOwner)
+		return nil, false
+	}
+	if project.BannedAt != nil {
+		middleware.Error(ctx, apierr.ErrProjectBanned)
+		return nil, false
+	}
+	return project, true
+}
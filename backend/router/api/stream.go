@@ -0,0 +1,250 @@
+package api
+
+import (
+	"donate/logger"
+	"donate/model"
+	"donate/pkg/apierr"
+	"donate/pkg/pubsub"
+	"donate/router/middleware"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/fox-one/mixin-sdk-go/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	globalDonationTopic = "*"
+	donationFeedBuffer  = 64 // 每个订阅者最多积压的事件数, 超出后断开
+)
+
+var (
+	streamHeartbeat    = 15 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+// DonationFeed 实时捐赠的发布订阅
+type DonationFeed = pubsub.Hub[*DonationEvent]
+
+func NewDonationFeed() *DonationFeed {
+	return pubsub.New[*DonationEvent](donationFeedBuffer)
+}
+
+// DonationTopics 捐赠事件同时发给项目和全局的订阅者
+func DonationTopics(pid string) []string {
+	return []string{pid, globalDonationTopic}
+}
+
+// DonationEvent 实时推送的捐赠, 匿名捐赠不包含捐赠者信息
+type DonationEvent struct {
+	ID             string          `json:"id"`
+	PID            string          `json:"pid"`
+	IdentityNumber string          `json:"identityNumber"`
+	FullName       string          `json:"fullName"`
+	AvatarUrl      string          `json:"avatarUrl"`
+	Anonymous      bool            `json:"anonymous"`
+	AssetID        string          `json:"assetId"`
+	Symbol         string          `json:"symbol"`
+	IconURL        string          `json:"iconUrl"`
+	Amount         decimal.Decimal `json:"amount"`
+	AmountUSD      decimal.Decimal `json:"amountUsd"` // 按捐赠时价格计算
+	Message        string          `json:"message,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+}
+
+// NewDonationEvent donor 和 asset 可以为空
+func NewDonationEvent(action *model.DonateAction, donor *mixin.User, asset *mixin.SafeAsset) *DonationEvent {
+	event := &DonationEvent{
+		ID:             action.ID,
+		PID:            action.PID,
+		IdentityNumber: action.IdentityNumber,
+		Anonymous:      action.Anonymous,
+		AssetID:        action.AssetID,
+		Amount:         action.Amount,
+		AmountUSD:      action.AmountUSD,
+		Message:        action.Message,
+		CreatedAt:      action.CreatedAt,
+	}
+	if donor != nil {
+		event.FullName = donor.FullName
+		event.AvatarUrl = donor.AvatarURL
+	}
+	if asset != nil {
+		event.Symbol = asset.Symbol
+		event.IconURL = asset.IconURL
+	}
+	if action.Anonymous {
+		event.IdentityNumber = ""
+		event.FullName = anonymousDonorName
+		event.AvatarUrl = ""
+	}
+	return event
+}
+
+// StreamProjectDonations 推送项目的实时捐赠
+// 请求带 Upgrade: websocket 时使用 WebSocket, 否则为 SSE
+func (a *ApiServer) StreamProjectDonations(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	pid, err := uuid.FromString(ctx.Param("item"))
+	if err != nil || pid == uuid.Nil {
+		middleware.Error(ctx, apierr.ErrInvalidPID)
+		return
+	}
+	project, err := a.store.GetProject(ctx, pid.String())
+	switch {
+	case err == gorm.ErrRecordNotFound || (err == nil && project.BannedAt != nil):
+		middleware.Error(ctx, apierr.ErrProjectNotFound)
+		return
+	case err != nil:
+		logger.Error().Err(err).Msg("failed to get project")
+		middleware.Error(ctx, apierr.ErrFailedToGetProject)
+		return
+	}
+
+	a.streamDonations(ctx, project.PID)
+}
+
+// StreamDonations 推送所有项目的实时捐赠, 用于首页滚动展示
+func (a *ApiServer) StreamDonations(ctx *gin.Context) {
+	a.streamDonations(ctx, globalDonationTopic)
+}
+
+func (a *ApiServer) streamDonations(ctx *gin.Context, topic string) {
+	sub, err := a.feed.Subscribe(topic)
+	if err != nil {
+		middleware.Error(ctx, apierr.ErrStreamUnavailable)
+		return
+	}
+	defer sub.Close()
+
+	if websocket.IsWebSocketUpgrade(ctx.Request) {
+		serveWebSocket(ctx, sub)
+		return
+	}
+	serveSSE(ctx, sub)
+}
+
+// serveSSE 事件名为 donation; 积压过多被断开前发送 lagged, 客户端重连后应重新拉取列表
+func serveSSE(ctx *gin.Context, sub *pubsub.Subscription[*DonationEvent]) {
+	w := ctx.Writer
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(data string) error {
+		// 客户端不读取时写入会阻塞, 超时后断开
+		_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := io.WriteString(w, data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	if err := write("retry: 3000\n\n"); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case event, ok := <-sub.C():
+			if !ok {
+				if errors.Is(sub.Err(), pubsub.ErrSlowConsumer) {
+					_ = write("event: lagged\ndata: {}\n\n")
+				}
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if err := write(fmt.Sprintf("id: %s\nevent: donation\ndata: %s\n\n", event.ID, data)); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := write(": ping\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// WebSocketMessage WebSocket 推送的消息, type 为 donation 或 lagged
+type WebSocketMessage struct {
+	Type string         `json:"type"`
+	Data *DonationEvent `json:"data,omitempty"`
+}
+
+// 捐赠数据是公开的, 与 Cors 一样允许任意来源
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+func serveWebSocket(ctx *gin.Context, sub *pubsub.Subscription[*DonationEvent]) {
+	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		// Upgrade 已经返回了错误响应
+		return
+	}
+	defer conn.Close()
+
+	// 只读取 pong 和关闭消息, 超过两个心跳周期没有响应视为断开
+	conn.SetReadLimit(512)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+	})
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case event, ok := <-sub.C():
+			_ = conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if !ok {
+				if errors.Is(sub.Err(), pubsub.ErrSlowConsumer) {
+					_ = conn.WriteJSON(&WebSocketMessage{Type: "lagged"})
+				}
+				_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+				return
+			}
+			if err := conn.WriteJSON(&WebSocketMessage{Type: "donation", Data: event}); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
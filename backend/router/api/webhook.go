@@ -0,0 +1,264 @@
+package api
+
+import (
+	"donate/logger"
+	"donate/model"
+	"donate/pkg/apierr"
+	"donate/pkg/webhook"
+	"donate/router/middleware"
+	"donate/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxProjectWebhooks = 5
+)
+
+// WebhookPayload 推送给项目方的请求体, 重放时 id 不变, 接收方可以据此去重
+type WebhookPayload struct {
+	ID        string         `json:"id"`
+	Type      string         `json:"type"`
+	CreatedAt int64          `json:"createdAt"`
+	Data      *DonationEvent `json:"data"`
+}
+
+// WebhookRequest 创建和编辑 webhook 的请求体
+type WebhookRequest struct {
+	URL      string `json:"url"`      // required
+	Disabled bool   `json:"disabled"` // optional
+}
+
+// WebhookSecretResponse 只在创建和轮换密钥时返回密钥
+type WebhookSecretResponse struct {
+	model.Webhook
+	Secret string `json:"secret"`
+}
+
+// ListWebhooks 列出自己项目的 webhook
+func (a *ApiServer) ListWebhooks(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	project, ok := a.getOwnedProject(ctx)
+	if !ok {
+		return
+	}
+
+	webhooks, err := a.store.ListWebhooksByPID(ctx, project.PID)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list webhooks")
+		middleware.Error(ctx, apierr.ErrFailedToListWebhooks)
+		return
+	}
+	if webhooks == nil {
+		webhooks = []*model.Webhook{}
+	}
+	middleware.OK(ctx, webhooks)
+}
+
+// CreateWebhook 为自己的项目登记 webhook, 返回签名密钥
+func (a *ApiServer) CreateWebhook(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	project, ok := a.getOwnedProject(ctx)
+	if !ok {
+		return
+	}
+
+	var req WebhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil || webhook.ValidateURL(req.URL) != nil {
+		middleware.Error(ctx, apierr.ErrInvalidWebhookURL)
+		return
+	}
+
+	webhooks, err := a.store.ListWebhooksByPID(ctx, project.PID)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to list webhooks")
+		middleware.Error(ctx, apierr.ErrFailedToListWebhooks)
+		return
+	}
+	if len(webhooks) >= maxProjectWebhooks {
+		middleware.Error(ctx, apierr.ErrTooManyWebhooks)
+		return
+	}
+
+	now := time.Now().Unix()
+	item := &model.Webhook{
+		ID:        utils.RandomTraceID(),
+		PID:       project.PID,
+		URL:       req.URL,
+		Secret:    webhook.NewSecret(),
+		Disabled:  req.Disabled,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := a.store.AddWebhook(ctx, item); err != nil {
+		logger.Error().Err(err).Msg("failed to add webhook")
+		middleware.Error(ctx, apierr.ErrFailedToAddWebhook)
+		return
+	}
+
+	middleware.OK(ctx, WebhookSecretResponse{Webhook: *item, Secret: item.Secret})
+}
+
+// UpdateWebhook 修改地址或停用, 密钥不变
+func (a *ApiServer) UpdateWebhook(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	item, ok := a.getOwnedWebhook(ctx)
+	if !ok {
+		return
+	}
+
+	var req WebhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil || webhook.ValidateURL(req.URL) != nil {
+		middleware.Error(ctx, apierr.ErrInvalidWebhookURL)
+		return
+	}
+
+	item.URL = req.URL
+	item.Disabled = req.Disabled
+	item.UpdatedAt = time.Now().Unix()
+	if err := a.store.UpdateWebhook(ctx, item); err != nil {
+		logger.Error().Err(err).Msg("failed to update webhook")
+		middleware.Error(ctx, apierr.ErrFailedToUpdateWebhook)
+		return
+	}
+
+	middleware.OK(ctx, item)
+}
+
+// DeleteWebhook 删除 webhook, 未完成的投递不再发送
+func (a *ApiServer) DeleteWebhook(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	item, ok := a.getOwnedWebhook(ctx)
+	if !ok {
+		return
+	}
+
+	if err := a.store.DeleteWebhook(ctx, item.ID); err != nil {
+		logger.Error().Err(err).Msg("failed to delete webhook")
+		middleware.Error(ctx, apierr.ErrFailedToDeleteWebhook)
+		return
+	}
+
+	middleware.OK(ctx, gin.H{"id": item.ID})
+}
+
+// RotateWebhookSecret 生成新的签名密钥, 过渡期内旧密钥的签名仍然会带上
+func (a *ApiServer) RotateWebhookSecret(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	item, ok := a.getOwnedWebhook(ctx)
+	if !ok {
+		return
+	}
+
+	now := time.Now().Unix()
+	item.PreviousSecret = item.Secret
+	item.Secret = webhook.NewSecret()
+	item.RotatedAt = now
+	item.UpdatedAt = now
+	if err := a.store.UpdateWebhook(ctx, item); err != nil {
+		logger.Error().Err(err).Msg("failed to rotate webhook secret")
+		middleware.Error(ctx, apierr.ErrFailedToRotateWebhookSecret)
+		return
+	}
+
+	middleware.OK(ctx, WebhookSecretResponse{Webhook: *item, Secret: item.Secret})
+}
+
+// ListWebhookDeliveries 按时间倒序列出投递记录, 以 cursor 翻页
+func (a *ApiServer) ListWebhookDeliveries(ctx *gin.Context) {
+	item, ok := a.getOwnedWebhook(ctx)
+	if !ok {
+		return
+	}
+
+	limit, cursor, err := ParsePage(ctx, 20, 100)
+	if err != nil {
+		middleware.Error(ctx, err)
+		return
+	}
+
+	deliveries, next, err := a.store.ListWebhookDeliveries(ctx, item.ID, limit, cursor)
+	if err != nil {
+		middleware.Error(ctx, PageError(err, apierr.ErrFailedToListWebhookDeliveries))
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*model.WebhookDelivery{}
+	}
+	SetNextCursor(ctx, next)
+	middleware.OK(ctx, deliveries)
+}
+
+// ReplayWebhookDelivery 以相同的内容重新投递, 生成新的投递记录并立即发送
+func (a *ApiServer) ReplayWebhookDelivery(ctx *gin.Context) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	item, ok := a.getOwnedWebhook(ctx)
+	if !ok {
+		return
+	}
+	if item.Disabled {
+		middleware.Error(ctx, apierr.ErrWebhookDisabled)
+		return
+	}
+
+	delivery, err := a.store.GetWebhookDelivery(ctx, ctx.Param("did"))
+	switch {
+	case err == gorm.ErrRecordNotFound || (err == nil && delivery.WebhookID != item.ID):
+		middleware.Error(ctx, apierr.ErrDeliveryNotFound)
+		return
+	case err != nil:
+		logger.Error().Err(err).Msg("failed to get webhook delivery")
+		middleware.Error(ctx, apierr.ErrFailedToGetWebhookDelivery)
+		return
+	}
+
+	now := time.Now().Unix()
+	replay := &model.WebhookDelivery{
+		ID:        utils.RandomTraceID(),
+		WebhookID: item.ID,
+		PID:       delivery.PID,
+		Event:     delivery.Event,
+		Payload:   delivery.Payload,
+		ReplayOf:  delivery.ID,
+		Status:    model.WebhookDeliveryPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := a.store.CreateWebhookDelivery(ctx, replay); err != nil {
+		logger.Error().Err(err).Msg("failed to create webhook delivery")
+		middleware.Error(ctx, apierr.ErrFailedToCreateWebhookDelivery)
+		return
+	}
+
+	middleware.OK(ctx, replay)
+}
+
+// getOwnedWebhook 读取路径中的 webhook 并校验属于当前用户的项目, 失败时已写入响应
+func (a *ApiServer) getOwnedWebhook(ctx *gin.Context) (*model.Webhook, bool) {
+	logger := ctx.MustGet(middleware.DefaultLoggerKey).(*logger.CtxLogger)
+
+	project, ok := a.getOwnedProject(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	item, err := a.store.GetWebhook(ctx, ctx.Param("id"))
+	switch {
+	case err == gorm.ErrRecordNotFound || (err == nil && item.PID != project.PID):
+		middleware.Error(ctx, apierr.ErrWebhookNotFound)
+		return nil, false
+	case err != nil:
+		logger.Error().Err(err).Msg("failed to get webhook")
+		middleware.Error(ctx, apierr.ErrFailedToGetWebhook)
+		return nil, false
+	}
+	return item, true
+}
@@ -0,0 +1,102 @@
+package router
+
+import (
+	"context"
+	"donate/config"
+	"donate/model"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	errCampaignClosed     = errors.New("campaign closed")
+	errProjectNotOpen     = errors.New("project archived or banned")
+	errProjectOwnerBanned = errors.New("project owner banned")
+)
+
+// acceptProject 返回实际接收捐赠的项目, 返回 errCampaignClosed, errProjectNotOpen 或 errProjectOwnerBanned 时需要退款
+// 转入的项目与原项目做相同的检查, 转入的项目同样截止时继续按策略处理
+func (s *Service) acceptProject(ctx context.Context, project *model.Project, at time.Time) (*model.Project, error) {
+	visited := map[string]bool{}
+	for {
+		// 转入形成循环
+		if visited[project.PID] {
+			return nil, errCampaignClosed
+		}
+		visited[project.PID] = true
+
+		if err := s.checkProjectOpen(ctx, project); err != nil {
+			return nil, err
+		}
+		next, err := s.applyCampaignPolicy(ctx, project, at)
+		if err != nil {
+			return nil, err
+		}
+		if next.PID == project.PID {
+			return project, nil
+		}
+		project = next
+	}
+}
+
+// checkProjectOpen 已归档或被封禁的项目, 以及项目方被封禁的项目不再接收捐赠
+func (s *Service) checkProjectOpen(ctx context.Context, project *model.Project) error {
+	if project.ArchivedAt != nil || project.BannedAt != nil {
+		return errProjectNotOpen
+	}
+	owner, err := s.store.GetUserByUID(ctx, project.MixinUID)
+	switch err {
+	case nil:
+		if owner.BannedAt != nil {
+			return errProjectOwnerBanned
+		}
+		return nil
+	case gorm.ErrRecordNotFound:
+		return nil
+	default:
+		return err
+	}
+}
+
+// applyCampaignPolicy 项目截止或达成目标后, 按配置决定捐赠的去向
+// 返回接收捐赠的项目, 转入的项目由 acceptProject 继续检查; errCampaignClosed 表示需要退款
+func (s *Service) applyCampaignPolicy(ctx context.Context, project *model.Project, at time.Time) (*model.Project, error) {
+	if s.conf == nil || s.conf.Campaign == nil {
+		return project, nil
+	}
+	conf := s.conf.Campaign
+	if conf.ClosedPolicy != config.CampaignPolicyRefund && conf.ClosedPolicy != config.CampaignPolicyRedirect {
+		return project, nil
+	}
+
+	var totals []*model.ProjectAssetTotal
+	if project.GoalAssetID != "" {
+		var err error
+		if totals, err = s.store.ListProjectAssetTotals(ctx, project.PID); err != nil {
+			return nil, err
+		}
+	}
+	if !project.Campaign(at, totals).Closed() {
+		return project, nil
+	}
+
+	if conf.ClosedPolicy == config.CampaignPolicyRefund {
+		return nil, errCampaignClosed
+	}
+
+	// redirect, 转入的项目不存在或就是本项目时退款
+	if conf.RedirectPID == "" || conf.RedirectPID == project.PID {
+		return nil, errCampaignClosed
+	}
+	redirect, err := s.store.GetProject(ctx, conf.RedirectPID)
+	switch err {
+	case nil:
+		return redirect, nil
+	case gorm.ErrRecordNotFound:
+		return nil, errCampaignClosed
+	default:
+		return nil, err
+	}
+}
@@ -0,0 +1,71 @@
+package router
+
+import (
+	"context"
+	"donate/config"
+	"donate/model"
+	"donate/utils"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCampaignRedirect(t *testing.T) {
+	const (
+		closedPID   = "7a9b1c3d-5e6f-4a8b-9c0d-2e4f6a8b0c1d"
+		redirectPID = "8b0c2d4e-6f7a-4b9c-8d1e-3f5a7b9c1d2e"
+		bannedUID   = "9c1d3e5f-7a8b-4c0d-9e2f-4a6b8c0d2e3f"
+	)
+
+	tests := []struct {
+		name     string
+		redirect *model.Project // 为空表示转入的项目不存在
+		accepted bool
+	}{
+		{name: "open", redirect: &model.Project{}, accepted: true},
+		{name: "missing"},
+		{name: "archived", redirect: &model.Project{ArchivedAt: &time.Time{}}},
+		{name: "banned", redirect: &model.Project{BannedAt: &time.Time{}}},
+		{name: "owner banned", redirect: &model.Project{MixinUID: bannedUID, IdentityNumber: "3001"}},
+		// 转入的项目同样已截止, 按策略应转入自身, 退款
+		{name: "chained", redirect: &model.Project{EndAt: &time.Time{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			env := newTestEnv(t)
+			env.svc.conf.Campaign = &config.CampaignConfig{ClosedPolicy: config.CampaignPolicyRedirect, RedirectPID: redirectPID}
+
+			ended := env.clock.Now().Add(-time.Hour)
+			require.NoError(t, env.store.AddProject(ctx, &model.Project{PID: closedPID, Title: "closed", IdentityNumber: "2001", MixinUID: testOwnerID, EndAt: &ended}))
+			require.NoError(t, env.store.AddUser(ctx, &model.User{MixinUID: bannedUID, IdentityNumber: "3001", FullName: "banned", BannedAt: &ended}))
+			if tt.redirect != nil {
+				redirect := *tt.redirect
+				redirect.PID, redirect.Title = redirectPID, "redirect"
+				if redirect.MixinUID == "" {
+					redirect.IdentityNumber, redirect.MixinUID = "2001", testOwnerID
+				}
+				require.NoError(t, env.store.AddProject(ctx, &redirect))
+			}
+
+			snapshot := env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(3), pidMemo(closedPID))
+			require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+			require.NoError(t, env.svc.handlePayouts(ctx))
+
+			actions, err := env.store.QueryDonateActionsByPID(ctx, redirectPID)
+			require.NoError(t, err)
+			_, err = env.store.GetPayout(ctx, utils.GenUuidFromStrings(snapshot.RequestID, "donate-refund"))
+			if tt.accepted {
+				assert.Len(t, actions, 1)
+				assert.Error(t, err)
+				return
+			}
+			assert.Empty(t, actions)
+			require.NoError(t, err)
+			assert.True(t, env.network.Balance(testDonorID, testAssetID).Equal(decimal.NewFromInt(3)))
+		})
+	}
+}
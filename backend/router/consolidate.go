@@ -0,0 +1,258 @@
+package router
+
+import (
+	"context"
+	"donate/model"
+	"donate/model/mixin_client_wrapper"
+	"donate/utils"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fox-one/mixin-sdk-go/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/samber/lo"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	defaultConsolidateInterval = 5 * time.Minute
+	defaultConsolidateMinUtxos = 32
+
+	consolidateBatchSize   = 50
+	consolidateMaxBatches  = 4 // 每个资产每轮最多提交的聚合数
+	consolidateMaxAttempts = 5
+)
+
+var (
+	ErrConsolidationInputsSpent = errors.New("consolidation inputs spent")
+)
+
+// consolidateInterval 聚合周期, 未配置时为 5 分钟
+func (s *Service) consolidateInterval() time.Duration {
+	if conf := s.conf.Consolidate; conf != nil && conf.IntervalSeconds > 0 {
+		return time.Duration(conf.IntervalSeconds) * time.Second
+	}
+	return defaultConsolidateInterval
+}
+
+// consolidateMinUtxos 未花费的 utxo 超过该数量时聚合, 未配置时为 32
+func (s *Service) consolidateMinUtxos() int {
+	if conf := s.conf.Consolidate; conf != nil && conf.MinUtxos > 0 {
+		return conf.MinUtxos
+	}
+	return defaultConsolidateMinUtxos
+}
+
+// RunConsolidateLoop 定期合并小额 utxo, 阻塞直到 ctx 取消
+// 与转账独立运行, 转账不等待聚合
+func (s *Service) RunConsolidateLoop(ctx context.Context) {
+	ticker := s.clock.Ticker(s.consolidateInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Err(ctx.Err()).Msg("stop consolidate loop")
+			return
+		case <-ticker.C:
+			if err := s.handleConsolidations(ctx); err != nil {
+				log.Error().Err(err).Msg("cron handle consolidations failed")
+			}
+		}
+	}
+}
+
+// handleConsolidations 先推进未完成的聚合, 再为 utxo 过多且没有未完成聚合的资产提交新的聚合
+func (s *Service) handleConsolidations(ctx context.Context) error {
+	unfinished, err := s.store.ListUnfinishedConsolidations(ctx, consolidateBatchSize)
+	if err != nil {
+		return err
+	}
+
+	// ctx 取消后不再开始新的聚合, 进行中的提交在 shutdownTimeout 内完成
+	// 超时中断的聚合保持 pending, 下次启动按 request id 查询后继续
+	workCtx, cancel := drainContext(ctx, s.shutdownTimeout())
+	defer cancel()
+
+	busy := map[string]bool{}
+	for _, consolidation := range unfinished {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := s.handleConsolidation(workCtx, consolidation, nil); err != nil {
+			log.Error().Any("consolidation", consolidation).Err(err).Msg("handle consolidation failed")
+		}
+		if consolidation.Status == model.ConsolidationStatusPending || consolidation.Status == model.ConsolidationStatusSubmitted {
+			busy[consolidation.AssetId] = true
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	utxos, err := s.mixinClient.ListUnspentUtxos(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, batch := range planConsolidations(utxos, s.consolidateMinUtxos(), busy) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		consolidation, err := s.createConsolidation(ctx, batch)
+		if err != nil {
+			return err
+		}
+		// 相同输入的聚合已经完成或失败
+		if consolidation.Status != model.ConsolidationStatusPending {
+			continue
+		}
+		if err := s.handleConsolidation(workCtx, consolidation, batch); err != nil {
+			log.Error().Any("consolidation", consolidation).Err(err).Msg("handle consolidation failed")
+		}
+	}
+	return nil
+}
+
+// planConsolidations 按资产分组, 跳过铭文 utxo 和 busy 中的资产
+// utxo 超过 minUtxos 个时从金额最小的开始, 每批最多 255 个, 每个资产最多 consolidateMaxBatches 批
+func planConsolidations(utxos []*mixin.SafeUtxo, minUtxos int, busy map[string]bool) [][]*mixin.SafeUtxo {
+	groups := lo.GroupBy(lo.Filter(utxos, func(utxo *mixin.SafeUtxo, _ int) bool {
+		return !utxo.InscriptionHash.HasValue() && !busy[utxo.AssetID]
+	}), func(utxo *mixin.SafeUtxo) string {
+		return utxo.AssetID
+	})
+	assetIDs := lo.Keys(groups)
+	sort.Strings(assetIDs)
+
+	var batches [][]*mixin.SafeUtxo
+	for _, assetID := range assetIDs {
+		rest := groups[assetID]
+		sort.SliceStable(rest, func(i, j int) bool {
+			return rest[i].Amount.LessThan(rest[j].Amount)
+		})
+		for n := 0; n < consolidateMaxBatches && len(rest) > minUtxos && len(rest) >= 2; n++ {
+			size := min(len(rest), mixin_client_wrapper.MAX_UTXO_NUM)
+			batches = append(batches, rest[:size])
+			rest = rest[size:]
+		}
+	}
+	return batches
+}
+
+// createConsolidation 记录聚合, request id 由输入的 output id 确定性生成
+// 已存在时返回已有的记录
+func (s *Service) createConsolidation(ctx context.Context, utxos []*mixin.SafeUtxo) (*model.Consolidation, error) {
+	outputs := make([]string, len(utxos))
+	amount := decimal.Zero
+	for i, utxo := range utxos {
+		outputs[i] = utxo.OutputID
+		amount = amount.Add(utxo.Amount)
+	}
+	now := s.clock.Now().Unix()
+	consolidation := &model.Consolidation{
+		RequestId: utils.GenUuidFromStrings(append(outputs, "consolidate")...),
+		AssetId:   utxos[0].AssetID,
+		Inputs:    len(utxos),
+		Amount:    amount,
+		Outputs:   strings.Join(outputs, ","),
+		Status:    model.ConsolidationStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.store.CreateConsolidation(ctx, consolidation); err != nil {
+		return nil, err
+	}
+	return s.store.GetConsolidation(ctx, consolidation.RequestId)
+}
+
+// handleConsolidation 按 request id 同步聚合的状态, 未提交时以记录的输入提交
+// utxos 为空时重新读取输入, 已被转账花费时标记为失败
+func (s *Service) handleConsolidation(ctx context.Context, consolidation *model.Consolidation, utxos []*mixin.SafeUtxo) error {
+	req, err := s.mixinClient.SafeReadTransactionRequest(ctx, consolidation.RequestId)
+	switch {
+	case err == nil:
+		switch req.State {
+		case mixin.SafeUtxoStateSpent:
+			// 先记账再更新状态, 记账以交易 id 保证幂等, 中断后下一轮补记
+			// 交易的金额为聚合的输出, 与输入的差额记为手续费
+			output := req.Amount
+			if !output.IsPositive() {
+				output = consolidation.Amount
+			}
+			if err := s.store.PostLedgerEntries(ctx, model.ConsolidationLedgerEntries(consolidation, output, s.clock.Now().Unix())); err != nil {
+				return err
+			}
+			return s.updateConsolidation(ctx, consolidation, model.ConsolidationStatusConfirmed, "")
+		case mixin.SafeUtxoStateSigned:
+			if consolidation.Status == model.ConsolidationStatusSubmitted {
+				return nil
+			}
+			return s.updateConsolidation(ctx, consolidation, model.ConsolidationStatusSubmitted, "")
+		}
+		// unspent: 交易已创建但未提交, 使用相同 request id 重新提交
+	case mixin.IsErrorCodes(err, mixin.EndpointNotFound):
+	default:
+		return err
+	}
+
+	if utxos == nil {
+		if utxos, err = s.consolidationInputs(ctx, consolidation); err != nil {
+			if errors.Is(err, ErrConsolidationInputsSpent) {
+				return s.updateConsolidation(ctx, consolidation, model.ConsolidationStatusFailed, err.Error())
+			}
+			return err
+		}
+	}
+
+	consolidation.Attempts++
+	if _, err := s.mixinClient.ConsolidateUtxos(ctx, consolidation.RequestId, utxos); err != nil {
+		status := model.ConsolidationStatusPending
+		if consolidation.Attempts >= consolidateMaxAttempts || errors.Is(err, mixin_client_wrapper.ErrInvalidConsolidation) {
+			status = model.ConsolidationStatusFailed
+		}
+		if err1 := s.updateConsolidation(ctx, consolidation, status, err.Error()); err1 != nil {
+			log.Error().Err(err1).Str("request_id", consolidation.RequestId).Msg("update consolidation failed")
+		}
+		return err
+	}
+
+	return s.updateConsolidation(ctx, consolidation, model.ConsolidationStatusSubmitted, "")
+}
+
+// consolidationInputs 按记录的 output id 读取仍未花费的输入
+func (s *Service) consolidationInputs(ctx context.Context, consolidation *model.Consolidation) ([]*mixin.SafeUtxo, error) {
+	unspent, err := s.mixinClient.ListUnspentUtxos(ctx, consolidation.AssetId)
+	if err != nil {
+		return nil, err
+	}
+	utxoMap := lo.KeyBy(unspent, func(utxo *mixin.SafeUtxo) string { return utxo.OutputID })
+	outputs := strings.Split(consolidation.Outputs, ",")
+	utxos := make([]*mixin.SafeUtxo, 0, len(outputs))
+	for _, id := range outputs {
+		utxo, ok := utxoMap[id]
+		if !ok {
+			return nil, ErrConsolidationInputsSpent
+		}
+		utxos = append(utxos, utxo)
+	}
+	return utxos, nil
+}
+
+func (s *Service) updateConsolidation(ctx context.Context, consolidation *model.Consolidation, status, lastError string) error {
+	consolidation.Status = status
+	consolidation.LastError = lastError
+	consolidation.UpdatedAt = s.clock.Now().Unix()
+	return s.store.UpdateConsolidation(ctx, consolidation)
+}
+
+// pendingConsolidations 按资产汇总未完成的聚合金额, 提交后输入已花费而输出尚未到账
+func pendingConsolidations(consolidations []*model.Consolidation) map[string]decimal.Decimal {
+	pending := map[string]decimal.Decimal{}
+	for _, consolidation := range consolidations {
+		if consolidation.Status == model.ConsolidationStatusSubmitted {
+			pending[consolidation.AssetId] = pending[consolidation.AssetId].Add(consolidation.Amount)
+		}
+	}
+	return pending
+}
@@ -0,0 +1,166 @@
+package router
+
+import (
+	"context"
+	"donate/model"
+	"donate/model/mixin_client_wrapper"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fox-one/mixin-sdk-go/v2"
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsolidate(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	for i := 0; i < 300; i++ {
+		env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), "")
+	}
+	inscription := env.network.DepositInscription(testDonorID, testAssetID, decimal.NewFromInt(1), mixinnet.NewHash([]byte("inscription")))
+
+	// 超过阈值的 utxo 按每批最多 255 个合并, 铭文 utxo 不参与
+	require.NoError(t, env.svc.handleConsolidations(ctx))
+	consolidations, _, err := env.store.ListConsolidations(ctx, testAssetID, 10, nil)
+	require.NoError(t, err)
+	require.Len(t, consolidations, 2)
+	inputs := 0
+	for _, consolidation := range consolidations {
+		assert.LessOrEqual(t, consolidation.Inputs, mixin_client_wrapper.MAX_UTXO_NUM)
+		assert.Equal(t, model.ConsolidationStatusSubmitted, consolidation.Status)
+		assert.Equal(t, 1, consolidation.Attempts)
+		inputs += consolidation.Inputs
+	}
+	assert.Equal(t, 300, inputs)
+
+	unspent := env.network.Utxos(testAssetID, mixin.SafeUtxoStateUnspent)
+	require.Len(t, unspent, 3)
+	total := decimal.Zero
+	for _, utxo := range unspent {
+		total = total.Add(utxo.Amount)
+		if utxo.InscriptionHash.HasValue() {
+			assert.Equal(t, inscription.RequestID, utxo.RequestID)
+		}
+	}
+	assert.Equal(t, "301", total.String())
+
+	// 下一轮确认并记账, utxo 数量低于阈值时不再聚合
+	require.NoError(t, env.svc.handleConsolidations(ctx))
+	consolidations, _, err = env.store.ListConsolidations(ctx, testAssetID, 10, nil)
+	require.NoError(t, err)
+	require.Len(t, consolidations, 2)
+	for _, consolidation := range consolidations {
+		assert.Equal(t, model.ConsolidationStatusConfirmed, consolidation.Status)
+	}
+	assert.Len(t, env.network.Utxos(testAssetID, mixin.SafeUtxoStateUnspent), 3)
+
+	// 每个聚合一笔输入输出相等的分录, 钱包余额不变
+	imbalances, err := env.store.ListLedgerImbalances(ctx, 0)
+	require.NoError(t, err)
+	assert.Empty(t, imbalances)
+	fees, err := env.store.ListLedgerBalances(ctx, model.LedgerAccountFee, 0)
+	require.NoError(t, err)
+	assert.Empty(t, fees)
+}
+
+func TestConsolidateFee(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.network.ConsolidationFee = decimal.RequireFromString("0.01")
+
+	for i := 0; i < 40; i++ {
+		env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), "not a pid")
+	}
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+	require.NoError(t, env.svc.handleConsolidations(ctx))
+	require.NoError(t, env.svc.handleConsolidations(ctx))
+
+	// 输入与输出的差额记为手续费, 账本保持平衡
+	imbalances, err := env.store.ListLedgerImbalances(ctx, 0)
+	require.NoError(t, err)
+	assert.Empty(t, imbalances)
+	fees, err := env.store.ListLedgerBalances(ctx, model.LedgerAccountFee, 0)
+	require.NoError(t, err)
+	require.Len(t, fees, 1)
+	assert.Equal(t, "0.01", fees[0].Amount.String())
+	wallet, err := env.store.ListLedgerBalances(ctx, model.LedgerAccountWallet, 0)
+	require.NoError(t, err)
+	require.Len(t, wallet, 1)
+	assert.Equal(t, "39.99", wallet[0].Amount.String())
+
+	// 对账时手续费计入已支出, 没有差额
+	items, err := env.svc.reconcile(ctx)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "0.01", items[0].Paid.String())
+	assert.True(t, items[0].Discrepancy.IsZero(), items[0].Discrepancy.String())
+}
+
+func TestConsolidateRetry(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	for i := 0; i < 40; i++ {
+		env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), "")
+	}
+
+	env.network.TransferErr = errors.New("network unavailable")
+	require.NoError(t, env.svc.handleConsolidations(ctx))
+	consolidations, err := env.store.ListUnfinishedConsolidations(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, consolidations, 1)
+	assert.Equal(t, model.ConsolidationStatusPending, consolidations[0].Status)
+	assert.Equal(t, 1, consolidations[0].Attempts)
+	assert.Equal(t, "network unavailable", consolidations[0].LastError)
+
+	// 以记录的输入重新提交, 不会为同一资产再创建聚合
+	env.network.TransferErr = nil
+	require.NoError(t, env.svc.handleConsolidations(ctx))
+	consolidation, err := env.store.GetConsolidation(ctx, consolidations[0].RequestId)
+	require.NoError(t, err)
+	assert.Equal(t, model.ConsolidationStatusSubmitted, consolidation.Status)
+	assert.Equal(t, 2, consolidation.Attempts)
+	assert.Len(t, env.network.Utxos(testAssetID, mixin.SafeUtxoStateUnspent), 1)
+
+	all, _, err := env.store.ListConsolidations(ctx, "", 10, nil)
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+
+	// 重试次数用完后标记为失败
+	env.clock.Add(time.Minute)
+	for i := 0; i < 40; i++ {
+		env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), "")
+	}
+	env.network.TransferErr = errors.New("network unavailable")
+	for i := 0; i < consolidateMaxAttempts; i++ {
+		require.NoError(t, env.svc.handleConsolidations(ctx))
+	}
+	consolidations, err = env.store.ListUnfinishedConsolidations(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, consolidations)
+	all, _, err = env.store.ListConsolidations(ctx, "", 10, nil)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, model.ConsolidationStatusFailed, all[0].Status)
+	assert.Equal(t, consolidateMaxAttempts, all[0].Attempts)
+}
+
+func TestConsolidateStopped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	env := newTestEnv(t)
+	for i := 0; i < 40; i++ {
+		env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), "")
+	}
+
+	// ctx 取消后不再开始新的聚合
+	cancel()
+	assert.ErrorIs(t, env.svc.handleConsolidations(ctx), context.Canceled)
+	all, _, err := env.store.ListConsolidations(context.Background(), "", 10, nil)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
@@ -0,0 +1,19 @@
+package router
+
+import (
+	"context"
+)
+
+// userLanguage 用户保存的语言, 没有保存或查询失败时使用默认语言
+func (s *Service) userLanguage(ctx context.Context, uid string) string {
+	user, err := s.store.GetUserByUID(ctx, uid)
+	if err != nil {
+		return s.catalog.DefaultLanguage()
+	}
+	return s.catalog.Match(user.Language)
+}
+
+// userMemo 按收款用户的语言生成转账 memo
+func (s *Service) userMemo(ctx context.Context, uid, id string) string {
+	return s.catalog.T(s.userLanguage(ctx, uid), id)
+}
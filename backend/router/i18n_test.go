@@ -0,0 +1,76 @@
+package router
+
+import (
+	"context"
+	"donate/model"
+	"donate/router/api"
+	"donate/router/middleware"
+	"donate/utils"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fox-one/mixin-sdk-go/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserLanguage(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	require.NoError(t, env.store.AddUser(ctx, &model.User{MixinUID: testOwnerID, IdentityNumber: "2001", FullName: "owner"}))
+
+	w := authRequest(t, env, testOwnerID, http.MethodPut, "/me/language", &api.UpdateLanguageRequest{Language: "fr"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = authRequest(t, env, testOwnerID, http.MethodPut, "/me/language", &api.UpdateLanguageRequest{Language: "zh-CN"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var user model.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(t, "zh", user.Language)
+
+	// 项目方的通知和转账 memo 使用保存的语言, 没有保存语言的捐赠者使用默认语言
+	snapshot := env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(2), pidMemo(testPID))
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+
+	messages := env.network.Messages(testOwnerID)
+	require.Len(t, messages, 1)
+	require.Equal(t, mixin.MessageCategoryAppCard, messages[0].Category)
+	assert.Equal(t, "donor 捐赠了 2 USDT (≈ $2.00)", messages[0].Card.Description)
+
+	payout, err := env.store.GetPayout(ctx, utils.GenUuidFromStrings(snapshot.RequestID, "donate-transfer"))
+	require.NoError(t, err)
+	assert.Equal(t, "收到捐赠", payout.Memo)
+
+	snapshot = env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), pidMemo("9c7f1e3a-0000-4000-8000-000000000000"))
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+	payout, err = env.store.GetPayout(ctx, utils.GenUuidFromStrings(snapshot.RequestID, "donate-refund"))
+	require.NoError(t, err)
+	assert.Equal(t, "Donate failed", payout.Memo)
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	env := newTestEnv(t)
+
+	for header, want := range map[string]string{
+		"":                        "project not found",
+		"zh-CN,zh;q=0.9,en;q=0.8": "项目不存在",
+		"fr-FR,en;q=0.5":          "project not found",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/project/9c7f1e3a-0000-4000-8000-000000000000", nil)
+		if header != "" {
+			req.Header.Set("Accept-Language", header)
+		}
+		w := httptest.NewRecorder()
+		env.svc.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		var resp middleware.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "project_not_found", resp.Code)
+		assert.Equal(t, want, resp.Error, header)
+		assert.Equal(t, w.Header().Get(middleware.DefaultXid), resp.RequestID)
+	}
+}
@@ -1,11 +1,23 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"strings"
 
+	"donate/pkg/apierr"
+
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	AdminOperatorKey = "admin_operator"
+)
+
+// GetAdminOperator 返回当前请求的 admin access key
+func GetAdminOperator(c *gin.Context) string {
+	return c.GetString(AdminOperatorKey)
+}
+
 type Admin struct {
 	ak string
 	sk string
@@ -20,8 +32,14 @@ func InitAdmin(ak, sk string) {
 	}
 }
 
+// Allow 以固定时间比较 key, 未配置 ak 或 sk 时拒绝所有请求
 func (a *Admin) Allow(ak, sk string) bool {
-	return a.ak == ak && a.sk == sk
+	if a.ak == "" || a.sk == "" {
+		return false
+	}
+	akOK := subtle.ConstantTimeCompare([]byte(a.ak), []byte(ak)) == 1
+	skOK := subtle.ConstantTimeCompare([]byte(a.sk), []byte(sk)) == 1
+	return akOK && skOK
 }
 
 func AdminAuthMiddleware(enable bool) func(c *gin.Context) {
@@ -33,42 +51,27 @@ func AdminAuthMiddleware(enable bool) func(c *gin.Context) {
 
 		authHeader := c.Request.Header.Get("Authorization")
 		if authHeader == "" {
-			c.JSON(403, gin.H{
-				"code":    403,
-				"message": "invaild admin token",
-			})
-			c.Abort()
+			Error(c, apierr.ErrInvalidAdminToken)
 			return
 		}
 
 		parts := strings.SplitN(authHeader, " ", 2)
 		if !(len(parts) == 2 && parts[0] == "Bearer") {
-			c.JSON(403, gin.H{
-				"code":    403,
-				"message": "invaild admin token",
-			})
-			c.Abort()
+			Error(c, apierr.ErrInvalidAdminToken)
 			return
 		}
 		split := strings.SplitN(parts[1], ":", 2)
 		if !(len(split) == 2) {
-			c.JSON(403, gin.H{
-				"code":    403,
-				"message": "invaild admin token",
-			})
-			c.Abort()
+			Error(c, apierr.ErrInvalidAdminToken)
 			return
 		}
 
 		if !_admin.Allow(split[0], split[1]) {
-			c.JSON(403, gin.H{
-				"code":    403,
-				"message": "invaild admin token",
-			})
-			c.Abort()
+			Error(c, apierr.ErrInvalidAdminToken)
 			return
 		}
 
+		c.Set(AdminOperatorKey, split[0])
 		c.Next()
 	}
 }
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	InitAdmin("ak", "sk")
+
+	router := gin.New()
+	router.GET("/admin", AdminAuthMiddleware(true), func(c *gin.Context) {
+		c.String(http.StatusOK, GetAdminOperator(c))
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{name: "no token", header: "", status: http.StatusUnauthorized},
+		{name: "missing secret", header: "Bearer ak", status: http.StatusUnauthorized},
+		{name: "wrong secret", header: "Bearer ak:wrong", status: http.StatusUnauthorized},
+		{name: "valid", header: "Bearer ak:sk", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				assert.Equal(t, "ak", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminAuthMiddlewareEmptyKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	InitAdmin("", "")
+	t.Cleanup(func() { InitAdmin("ak", "sk") })
+
+	router := gin.New()
+	router.GET("/admin", AdminAuthMiddleware(true), func(c *gin.Context) {
+		c.String(http.StatusOK, GetAdminOperator(c))
+	})
+
+	// 未配置 key 时空的凭证同样被拒绝
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set("Authorization", "Bearer :")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
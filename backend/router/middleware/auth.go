@@ -1,84 +1,86 @@
 package middleware
 
-// import (
-// 	"net/http"
-// 	"strings"
+import (
+	"context"
+	"strings"
 
-// 	"github.com/gin-gonic/gin"
-// 	"github.com/lixvyang/dome/pkg/jwt"
-// )
+	"donate/pkg/apierr"
+	"donate/pkg/jwt"
 
-// const (
-// 	UserIDKey = "uid"
-// )
+	"github.com/gin-gonic/gin"
+)
 
-// func JWTNOAuthMiddleware() func(c *gin.Context) {
-// 	return func(c *gin.Context) {
-// 		authHeader := c.Request.Header.Get("Authorization")
-// 		if authHeader == "" {
-// 			c.Next()
-// 		} else {
-// 			parts := strings.SplitN(authHeader, " ", 2)
-// 			if !(len(parts) == 2 && parts[0] == "Bearer") {
-// 				c.JSON(http.StatusForbidden, gin.H{
-// 					"code":    http.StatusForbidden,
-// 					"message": "invaild token",
-// 				})
-// 				c.Abort()
-// 				return
-// 			}
+const (
+	UserIDKey = "uid"
+)
 
-// 			mc, err := jwt.ParseJwt(parts[1])
-// 			if err != nil {
-// 				c.JSON(http.StatusForbidden, gin.H{
-// 					"code":    http.StatusForbidden,
-// 					"message": "invaild token",
-// 				})
-// 				c.Abort()
-// 				return
-// 			}
-// 			c.Set(UserIDKey, mc.Uid)
-// 			c.Next()
-// 		}
-// 	}
-// }
+// GetUserID 返回 JWT 中的 mixin user id, 未登录时为空
+func GetUserID(c *gin.Context) string {
+	return c.GetString(UserIDKey)
+}
 
-// func JWTAuthMiddleware() func(c *gin.Context) {
-// 	return func(c *gin.Context) {
-// 		authHeader := c.Request.Header.Get("Authorization")
-// 		if authHeader == "" {
-// 			c.JSON(http.StatusForbidden, gin.H{
-// 				"code":    http.StatusForbidden,
-// 				"message": "invaild token",
-// 			})
-// 			c.Abort()
-// 			return
-// 		}
+func JWTNOAuthMiddleware() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHeader := c.Request.Header.Get("Authorization")
+		if authHeader == "" {
+			c.Next()
+		} else {
+			parts := strings.SplitN(authHeader, " ", 2)
+			if !(len(parts) == 2 && parts[0] == "Bearer") {
+				Error(c, apierr.ErrInvalidToken)
+				return
+			}
 
-// 		parts := strings.SplitN(authHeader, " ", 2)
-// 		if !(len(parts) == 2 && parts[0] == "Bearer") {
-// 			c.JSON(http.StatusForbidden, gin.H{
-// 				"code":    http.StatusForbidden,
-// 				"message": "invaild token",
-// 			})
-// 			c.Abort()
-// 			return
-// 		}
+			mc, err := jwt.ParseJwt(parts[1])
+			if err != nil {
+				Error(c, apierr.ErrInvalidToken)
+				return
+			}
+			c.Set(UserIDKey, mc.Uid)
+			c.Next()
+		}
+	}
+}
 
-// 		mc, err := jwt.ParseJwt(parts[1])
-// 		if err != nil {
-// 			c.JSON(http.StatusForbidden, gin.H{
-// 				"code":    http.StatusForbidden,
-// 				"message": "invaild token",
-// 			})
-// 			c.Abort()
-// 			return
-// 		}
+// UserBannedFunc 返回登录用户是否被封禁
+type UserBannedFunc func(ctx context.Context, uid string) (bool, error)
 
-// 		c.Set(UserIDKey, mc.Uid)
-// 		c.Next()
-// 	}
-// }
+// JWTAuthMiddleware 校验 token, banned 不为空时拒绝被封禁的用户
+func JWTAuthMiddleware(banned UserBannedFunc) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHeader := c.Request.Header.Get("Authorization")
+		if authHeader == "" {
+			Error(c, apierr.ErrInvalidToken)
+			return
+		}
+
+		parts := strings.SplitN(authHeader, " ", 2)
+		if !(len(parts) == 2 && parts[0] == "Bearer") {
+			Error(c, apierr.ErrInvalidToken)
+			return
+		}
+
+		mc, err := jwt.ParseJwt(parts[1])
+		if err != nil {
+			Error(c, apierr.ErrInvalidToken)
+			return
+		}
+		if banned != nil {
+			isBanned, err := banned(c, mc.Uid)
+			if err != nil {
+				Error(c, apierr.ErrInternal.Wrap(err))
+				return
+			}
+			if isBanned {
+				Error(c, apierr.ErrUserBanned)
+				return
+			}
+		}
+
+		c.Set(UserIDKey, mc.Uid)
+		c.Next()
+	}
+}
 
 // /*
 // 1. Whether the uid is passed or not, the same API should be used (no restrictions in the middleware).
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"donate/pkg/jwt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	require.NoError(t, jwt.Init(&jwt.JwtConfig{SecretKey: "secret", TokenExpireSeconds: 60}))
+
+	router := gin.New()
+	const bannedUID = "c4a2d6f3-1b5e-4d7c-8a9f-2e3d4c5b6a7f"
+	router.GET("/me", JWTAuthMiddleware(func(_ context.Context, uid string) (bool, error) {
+		return uid == bannedUID, nil
+	}), func(c *gin.Context) {
+		c.String(http.StatusOK, GetUserID(c))
+	})
+
+	token, err := jwt.GenToken("b3f1c5e2-0a4d-4c6b-9f7e-1d2c3b4a5e6f")
+	require.NoError(t, err)
+	bannedToken, err := jwt.GenToken(bannedUID)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+		body   string
+	}{
+		{name: "no token", header: "", status: http.StatusUnauthorized},
+		{name: "not bearer", header: "Basic " + token, status: http.StatusUnauthorized},
+		{name: "malformed token", header: "Bearer abc", status: http.StatusUnauthorized},
+		{name: "valid token", header: "Bearer " + token, status: http.StatusOK, body: "b3f1c5e2-0a4d-4c6b-9f7e-1d2c3b4a5e6f"},
+		{name: "banned user", header: "Bearer " + bannedToken, status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.body != "" {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
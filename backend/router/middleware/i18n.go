@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"donate/pkg/i18n"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	LanguageKey = "lang"
+	catalogKey  = "i18n"
+)
+
+// Language 按 Accept-Language 选择响应的语言
+func Language(catalog *i18n.Catalog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(catalogKey, catalog)
+		c.Set(LanguageKey, catalog.MatchAcceptLanguage(c.GetHeader("Accept-Language")))
+		c.Next()
+	}
+}
+
+// GetCatalog 返回 Language 设置的消息目录, 未设置时为内置目录
+func GetCatalog(c *gin.Context) *i18n.Catalog {
+	if catalog, ok := c.Get(catalogKey); ok {
+		return catalog.(*i18n.Catalog)
+	}
+	return i18n.Default()
+}
+
+// GetLanguage 返回请求的语言, 未设置时为默认语言
+func GetLanguage(c *gin.Context) string {
+	if lang := c.GetString(LanguageKey); lang != "" {
+		return lang
+	}
+	return GetCatalog(c).DefaultLanguage()
+}
+
+// Tr 按请求的语言返回消息
+func Tr(c *gin.Context, id string, args ...interface{}) string {
+	return GetCatalog(c).T(GetLanguage(c), id, args...)
+}
@@ -4,6 +4,8 @@ import (
 	"sync"
 	"time"
 
+	"donate/pkg/apierr"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -48,8 +50,7 @@ func (tb *TokenBucket) Allow() bool {
 func LimitHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if !_tb.Allow() {
-			c.String(503, "Too many request")
-			c.Abort()
+			Error(c, apierr.ErrTooManyRequests)
 			return
 		}
 		c.Next()
@@ -2,12 +2,13 @@ package middleware
 
 import (
 	"net"
-	"net/http"
 	"net/http/httputil"
 	"os"
 	"runtime/debug"
 	"strings"
 
+	"donate/pkg/apierr"
+
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -64,7 +65,7 @@ func GinRecovery(Lg *zerolog.Logger, stack bool) gin.HandlerFunc {
 						Str("request", string(httpRequest)).
 						Send()
 				}
-				c.AbortWithStatus(http.StatusInternalServerError)
+				Error(c, apierr.ErrInternal)
 			}
 		}()
 		c.Next()
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"donate/logger"
+	"donate/pkg/apierr"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorResponse 接口错误的响应, 客户端按 code 区分错误
+type ErrorResponse struct {
+	Code      string `json:"code"`
+	Error     string `json:"error"`     // 按 Accept-Language 翻译的消息
+	RequestID string `json:"requestId"` // 与响应头 X-ReqId 相同
+}
+
+// OK 返回成功的响应
+func OK(c *gin.Context, data interface{}) {
+	c.JSON(http.StatusOK, data)
+}
+
+// Error 按 apierr 的状态码和错误码返回错误并中止后续的 handler
+// 不是 *apierr.Error 的错误返回 internal_error, 5xx 错误的原因写入日志
+func Error(c *gin.Context, err error) {
+	e := apierr.From(err)
+	if e.Status >= http.StatusInternalServerError && e.Unwrap() != nil {
+		if l, ok := c.Get(DefaultLoggerKey); ok {
+			l.(*logger.CtxLogger).Error().Err(e.Unwrap()).Str("code", e.Code).Msg("request failed")
+		}
+	}
+	c.AbortWithStatusJSON(e.Status, &ErrorResponse{
+		Code:      e.Code,
+		Error:     Tr(c, e.Code),
+		RequestID: GetOrGenXid(c),
+	})
+}
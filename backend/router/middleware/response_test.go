@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"donate/pkg/apierr"
+	"donate/pkg/i18n"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zerolog.Nop()
+
+	router := gin.New()
+	router.Use(GinXid(&logger), Language(i18n.Default()))
+	router.GET("/project", func(c *gin.Context) {
+		Error(c, apierr.ErrProjectNotFound)
+	})
+	router.GET("/wrapped", func(c *gin.Context) {
+		Error(c, apierr.ErrFailedToGetProject.Wrap(errors.New("connection refused")))
+	})
+	router.GET("/unknown", func(c *gin.Context) {
+		Error(c, errors.New("boom"))
+	})
+
+	tests := []struct {
+		path     string
+		language string
+		status   int
+		code     string
+		message  string
+	}{
+		{path: "/project", status: http.StatusNotFound, code: "project_not_found", message: "project not found"},
+		{path: "/project", language: "zh-CN,zh;q=0.9", status: http.StatusNotFound, code: "project_not_found", message: "项目不存在"},
+		{path: "/wrapped", status: http.StatusInternalServerError, code: "failed_to_get_project", message: "failed to get project"},
+		{path: "/unknown", language: "zh", status: http.StatusInternalServerError, code: "internal_error", message: "服务内部错误"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.language, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.language != "" {
+				req.Header.Set("Accept-Language", tt.language)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			var resp ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.code, resp.Code)
+			assert.Equal(t, tt.message, resp.Error)
+			assert.NotEmpty(t, resp.RequestID)
+			assert.Equal(t, w.Header().Get(DefaultXid), resp.RequestID)
+		})
+	}
+}
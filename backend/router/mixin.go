@@ -4,18 +4,19 @@ import (
 	"context"
 	"donate/model"
 	"donate/model/mixin_client_wrapper"
-	"donate/pkg/thread"
+	"donate/pkg/memo"
+	"donate/router/api"
 	"donate/router/middleware"
 	"donate/utils"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"sort"
 	"time"
 
 	"github.com/fox-one/mixin-sdk-go/v2"
-	"github.com/gofrs/uuid"
 	"github.com/rs/zerolog/log"
+	"github.com/samber/lo"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
@@ -26,6 +27,13 @@ var (
 	ErrGetSnapshotCountFailed      = errors.New("get snapshot count failed")
 	ErrGetLastestSnapshotFailed    = errors.New("get lastest snapshot failed")
 	ErrGetSnapshotByIdFailed       = errors.New("get snapshot by id failed")
+	ErrGetSnapshotCursorFailed     = errors.New("get snapshot cursor failed")
+	ErrSaveSnapshotCursorFailed    = errors.New("save snapshot cursor failed")
+	ErrInvalidSnapshotMemo         = errors.New("invalid pid")
+)
+
+const (
+	snapshotPageSize = 500
 )
 
 type sortSnapshot []*mixin.SafeSnapshot
@@ -45,118 +53,239 @@ func (s sortSnapshot) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 
+// RunMixinLoop 轮询入账, 阻塞直到 ctx 取消
 func (s *Service) RunMixinLoop(ctx context.Context) {
-	thread.GoSafe(func() {
-		ticker := s.clock.Ticker(5 * time.Second)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ctx.Done():
-				log.Error().Err(ctx.Err()).Msg("cancel cron server")
-				return
-			case <-ticker.C:
-				err := s.handleMixinSnapshotInput(ctx)
-				if err != nil {
-					log.Error().Err(err).Msg("cron handle snapshot input failed")
-				}
+	ticker := s.clock.Ticker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Err(ctx.Err()).Msg("stop snapshot loop")
+			return
+		case <-ticker.C:
+			err := s.handleMixinSnapshotInput(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("cron handle snapshot input failed")
 			}
 		}
-	})
+	}
 }
 
 func (s *Service) handleMixinSnapshotInput(ctx context.Context) error {
-	now := s.clock.Now()
-
-	snapshots, err := s.mixinClient.ReadSafeSnapshots(ctx, "", now.Add(-time.Hour), "DESC", 500)
+	cursor, err := s.getSnapshotCursor(ctx)
 	if err != nil {
-		return ErrReadMixinSafeSnapshotFailed
+		return err
 	}
 
-	count, err := s.store.GetSnapshotCount(ctx)
-	if err != nil {
-		return ErrGetSnapshotCountFailed
+	// ctx 取消后不再处理新的 snapshot, 正在处理的 snapshot 在 shutdownTimeout 内完成
+	workCtx, cancel := drainContext(ctx, s.shutdownTimeout())
+	defer cancel()
+
+	// 从游标处向后翻页, 直到追上最新的 snapshot
+	for {
+		snapshots, err := s.mixinClient.ReadSafeSnapshots(ctx, "", cursor, "ASC", snapshotPageSize)
+		if err != nil {
+			return ErrReadMixinSafeSnapshotFailed
+		}
+		sort.Sort(sortSnapshot(snapshots))
+
+		lastCursor := cursor
+		for _, snapshot := range snapshots {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// 游标所在时间点的 snapshot 可能已经处理过
+			if !snapshot.CreatedAt.After(cursor) {
+				if _, err := s.store.GetSnapshotById(ctx, snapshot.SnapshotID); err == nil {
+					continue
+				}
+			}
+
+			if err := s.handleMixinSnapshot(workCtx, snapshot); err != nil {
+				return err
+			}
+
+			if err := s.saveSnapshotCursor(workCtx, snapshot.CreatedAt); err != nil {
+				return err
+			}
+			cursor = snapshot.CreatedAt
+		}
+
+		// 已追上最新
+		if len(snapshots) < snapshotPageSize {
+			return nil
+		}
+
+		// 整页都停留在同一时间点, 以时间为 offset 无法翻到该时间点之后
+		// 按资产分别读取该时间点的 snapshot, 处理完后游标移到该时间点之后
+		if !cursor.After(lastCursor) {
+			log.Warn().Time("cursor", cursor).Int("page_size", snapshotPageSize).Msg("snapshot page stuck at one timestamp, drain it by asset")
+			if err := s.drainSnapshotsAt(ctx, workCtx, cursor, snapshots); err != nil {
+				return err
+			}
+			cursor = cursor.Add(time.Nanosecond)
+			if err := s.saveSnapshotCursor(workCtx, cursor); err != nil {
+				return err
+			}
+		}
 	}
-	sort.Sort(sortSnapshot(snapshots))
+}
 
-	startIndex := 0
-	if count > 0 {
-		lastestSnapshot, err := s.store.GetLastestSnapshot(ctx)
+// drainSnapshotsAt 按资产读取 at 时间点的全部 snapshot 并处理, 已处理的跳过
+// 单个资产在该时间点仍超过一页时记录缺口, 由对账任务提示
+func (s *Service) drainSnapshotsAt(ctx, workCtx context.Context, at time.Time, page []*mixin.SafeSnapshot) error {
+	assets, err := s.mixinClient.ListAssets(ctx)
+	if err != nil {
+		return err
+	}
+	assetIDs := lo.Uniq(append(
+		lo.Map(page, func(snapshot *mixin.SafeSnapshot, _ int) string { return snapshot.AssetID }),
+		lo.Map(assets, func(asset *mixin.SafeAsset, _ int) string { return asset.AssetID })...,
+	))
+	sort.Strings(assetIDs)
+
+	for _, assetID := range assetIDs {
+		snapshots, err := s.mixinClient.ReadSafeSnapshots(ctx, assetID, at, "ASC", snapshotPageSize)
 		if err != nil {
-			return ErrGetLastestSnapshotFailed
+			return ErrReadMixinSafeSnapshotFailed
+		}
+		for _, snapshot := range snapshots {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if !snapshot.CreatedAt.Equal(at) {
+				continue
+			}
+			if _, err := s.store.GetSnapshotById(ctx, snapshot.SnapshotID); err == nil {
+				continue
+			}
+			if err := s.handleMixinSnapshot(workCtx, snapshot); err != nil {
+				return err
+			}
 		}
 
-		for i, snapshot := range snapshots {
-			if snapshot.RequestID == lastestSnapshot.RequestId {
-				startIndex = i + 1 // 从最新快照的下一个开始处理
-				break
+		if len(snapshots) == snapshotPageSize && snapshots[len(snapshots)-1].CreatedAt.Equal(at) {
+			log.Error().Time("at", at).Str("asset_id", assetID).Msg("snapshots of one asset exceed a page at one timestamp, record gap")
+			if err := s.store.SaveSyncState(workCtx, &model.SyncState{
+				Name:      model.SyncStateSnapshotGap + assetID,
+				Value:     at.UTC().Format(time.RFC3339Nano),
+				UpdatedAt: s.clock.Now().Unix(),
+			}); err != nil {
+				return err
 			}
 		}
 	}
+	return nil
+}
 
-	for i := startIndex; i < len(snapshots); i++ {
-		snapshot := snapshots[i]
-		if !snapshot.Amount.IsPositive() {
-			continue
+// handleMixinSnapshot 返回错误时游标不会前进, 下一轮重新处理该 snapshot
+func (s *Service) handleMixinSnapshot(ctx context.Context, snapshot *mixin.SafeSnapshot) error {
+	if !snapshot.Amount.IsPositive() {
+		return nil
+	}
+
+	// 聚合 utxo 转给机器人自己, 输入输出已由聚合分录记账
+	if s.isConsolidationSnapshot(snapshot) {
+		return nil
+	}
+
+	// memo 为空的转账不是捐赠, 只记录 snapshot, 对账时计入入账
+	if snapshot.Memo == "" {
+		if _, err := s.store.RecordDonation(ctx, &model.DonationRecord{Snapshot: newSnapshotRecord(snapshot)}); err != nil {
+			log.Error().Any("snapshot", snapshot).Err(err).Msg("record snapshot failed")
+			return err
 		}
+		return nil
+	}
 
-		// 聚合 utxo 和 memo 为空 忽略
-		if snapshot.Memo == "" {
-			continue
+	if err := s.handleMixinInput(ctx, snapshot); err != nil {
+		log.Error().Any("snapshot", snapshot).Err(err).Msg("handle mixin input failed")
+		// memo 无效, 重试也无法处理
+		if errors.Is(err, ErrInvalidSnapshotMemo) {
+			return nil
 		}
+		return err
+	}
+	return nil
+}
 
-		err = s.handleMixinInput(ctx, snapshot)
+// getSnapshotCursor 读取已处理到的 snapshot 时间
+// 没有游标时从本地最新的 snapshot 开始, 本地为空则从一小时前开始
+func (s *Service) getSnapshotCursor(ctx context.Context) (time.Time, error) {
+	state, err := s.store.GetSyncState(ctx, model.SyncStateSnapshotCursor)
+	switch err {
+	case nil:
+		cursor, err := time.Parse(time.RFC3339Nano, state.Value)
 		if err != nil {
-			log.Error().Any("snapshot", snapshot).Err(err).Msg("handle mixin input failed")
-			continue
+			return time.Time{}, ErrGetSnapshotCursorFailed
 		}
+		return cursor, nil
+	case gorm.ErrRecordNotFound:
+	default:
+		return time.Time{}, ErrGetSnapshotCursorFailed
+	}
+
+	lastestSnapshot, err := s.store.GetLastestSnapshot(ctx)
+	switch err {
+	case nil:
+		return time.Unix(lastestSnapshot.CreatedAt, 0), nil
+	case gorm.ErrRecordNotFound:
+		return s.clock.Now().Add(-time.Hour), nil
+	default:
+		return time.Time{}, ErrGetLastestSnapshotFailed
 	}
+}
 
+func (s *Service) saveSnapshotCursor(ctx context.Context, cursor time.Time) error {
+	err := s.store.SaveSyncState(ctx, &model.SyncState{
+		Name:      model.SyncStateSnapshotCursor,
+		Value:     cursor.UTC().Format(time.RFC3339Nano),
+		UpdatedAt: s.clock.Now().Unix(),
+	})
+	if err != nil {
+		return ErrSaveSnapshotCursorFailed
+	}
 	return nil
 }
 
 func (s *Service) handleMixinInput(ctx context.Context, snapshot *mixin.SafeSnapshot) (err error) {
 	logger := log.Logger.With().Str(middleware.DefaultXid, middleware.GenReqId()).Logger()
 
-	err = s.store.InsertSnapshot(ctx, &model.Snapshot{
-		SnapshotId: snapshot.SnapshotID,
-		RequestId:  snapshot.RequestID,
-		UserId:     snapshot.OpponentID,
-		AssetId:    snapshot.AssetID,
-		Memo:       snapshot.Memo,
-		CreatedAt:  snapshot.CreatedAt.Unix(),
-		Amount:     snapshot.Amount,
-	})
-	if err != nil {
-		logger.Error().Err(err).Msg("insert snapshot failed")
-		return err
+	record := &model.DonationRecord{
+		Snapshot: newSnapshotRecord(snapshot),
 	}
 
 	// 解析meme 获取 pid,然后将资产转给 pid 对应的用户
-	// 解析 meme 失败则退还给用户
-	snapshotMemoHex, err := hex.DecodeString(snapshot.Memo)
+	// memo 无法解析时只记录 snapshot
+	donateMemo, err := parseSnapshotMemo(snapshot.Memo)
 	if err != nil {
+		if _, err1 := s.store.RecordDonation(ctx, record); err1 != nil {
+			logger.Error().Err(err1).Msg("record snapshot failed")
+			return err1
+		}
 		return err
 	}
 
-	pid, err := uuid.FromString(string(snapshotMemoHex))
-	if err != nil || pid == uuid.Nil {
-		return errors.New("invalid pid")
-	}
-
-	project, err := s.store.GetProject(ctx, pid.String())
+	pid := donateMemo.PID
+	project, err := s.store.GetProject(ctx, pid)
 	if err != nil && err != gorm.ErrRecordNotFound {
 		return err
 	}
 
+	// 退款和转账都随 snapshot 在同一事务内写入 payout, 由 payout 任务异步完成
 	refundToUser := func() error {
-		err = s.mixinClient.TransferOneWithRetry(ctx, &mixin_client_wrapper.TransferOneRequest{
-			RequestId: utils.GenUuidFromStrings(snapshot.RequestID, "donate-refund"),
-			AssetId:   snapshot.AssetID,
-			Amount:    snapshot.Amount,
-			Member:    snapshot.OpponentID,
-			Memo:      fmt.Sprintf("Donate failed"),
+		record.Payout = s.newPayout(&model.Payout{
+			RequestId:  utils.GenUuidFromStrings(snapshot.RequestID, "donate-refund"),
+			SnapshotId: snapshot.SnapshotID,
+			Kind:       model.PayoutKindRefund,
+			AssetId:    snapshot.AssetID,
+			Amount:     snapshot.Amount,
+			Member:     snapshot.OpponentID,
+			Memo:       s.userMemo(ctx, snapshot.OpponentID, "memo_donate_failed"),
 		})
-		if err != nil {
+		if _, err := s.store.RecordDonation(ctx, record); err != nil {
+			logger.Error().Err(err).Msg("record refund failed")
 			return err
 		}
 		return nil
@@ -167,8 +296,24 @@ func (s *Service) handleMixinInput(ctx context.Context, snapshot *mixin.SafeSnap
 		return refundToUser()
 	}
 
+	// 已归档, 被封禁或已截止的项目不再接收捐赠, 截止后按配置的策略退款或转入其他项目
+	project, err = s.acceptProject(ctx, project, snapshot.CreatedAt)
+	switch err {
+	case nil:
+		pid = project.PID
+	case errProjectNotOpen, errProjectOwnerBanned, errCampaignClosed:
+		logger.Info().Err(err).Str("pid", pid).Msg("project not accepting donations")
+		return refundToUser()
+	default:
+		return err
+	}
+
 	recipientUser, err := s.mixinClient.ReadUser(ctx, snapshot.OpponentID)
 	if err != nil {
+		// 退出过程中被中断, 下次启动重新处理, 不能误退款
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		logger.Error().Err(err).Msg("read user failed")
 		return refundToUser()
 	}
@@ -210,37 +355,90 @@ func (s *Service) handleMixinInput(ctx context.Context, snapshot *mixin.SafeSnap
 		logger.Error().Err(err).Msg("failed to get user")
 	}
 
-	// donate cnt ++
-	_ = s.store.DonateActionStore.AddDonateAction(ctx, &model.DonateAction{
+	// 按捐赠时的价格计算 USD 价值, 获取价格失败时记为 0
+	amountUSD := decimal.Zero
+	asset, err := s.mixinClient.GetAsset(ctx, snapshot.AssetID)
+	if err != nil {
+		logger.Error().Err(err).Msg("read asset failed")
+		asset = nil
+	} else {
+		amountUSD = snapshot.Amount.Mul(asset.PriceUSD).Round(8)
+	}
+
+	// snapshot, 捐赠记录, 项目捐赠统计和转账在同一事务内完成
+	record.Action = &model.DonateAction{
 		ID:             utils.GenUuidFromStrings(snapshot.RequestID, "donate"),
-		PID:            pid.String(),
+		PID:            pid,
 		Amount:         snapshot.Amount,
+		AmountUSD:      amountUSD,
 		IdentityNumber: recipientUser.IdentityNumber,
 		AssetID:        snapshot.AssetID,
+		Message:        donateMemo.Message,
+		Anonymous:      donateMemo.Anonymous,
+		ReferralCode:   donateMemo.Referral,
 		CreatedAt:      snapshot.CreatedAt,
+	}
+	record.Payout = s.newPayout(&model.Payout{
+		RequestId:  utils.GenUuidFromStrings(snapshot.RequestID, "donate-transfer"),
+		SnapshotId: snapshot.SnapshotID,
+		Kind:       model.PayoutKindForward,
+		AssetId:    snapshot.AssetID,
+		Amount:     snapshot.Amount,
+		Member:     project.MixinUID,
+		PID:        pid,
+		Memo:       s.userMemo(ctx, project.MixinUID, "memo_donate_for_you"),
 	})
-
-	_ = s.store.ProjectStore.IncrProjectDonateCnt(ctx, pid.String())
-
-	donateMsg := fmt.Sprintf("User %s has donated to you for project %s.",
-		recipientUser.IdentityNumber,
-		project.PID)
-	err = s.mixinClient.SendMessageWithRetry(ctx, project.MixinUID, donateMsg)
+	event := api.NewDonationEvent(record.Action, recipientUser, asset)
+	record.Deliveries, err = s.newWebhookDeliveries(ctx, event)
 	if err != nil {
-		logger.Error().Err(err).Msg("send donate msg error")
+		logger.Error().Err(err).Msg("list webhooks failed")
+		return err
 	}
-
-	// 转给 pid 对应的用户
-	err = s.mixinClient.TransferOneWithRetry(ctx, &mixin_client_wrapper.TransferOneRequest{
-		RequestId: utils.GenUuidFromStrings(snapshot.RequestID, "donate-transfer"),
-		AssetId:   snapshot.AssetID,
-		Amount:    snapshot.Amount,
-		Member:    project.MixinUID,
-		Memo:      fmt.Sprintf("Donate for you"),
-	})
+	created, err := s.store.RecordDonation(ctx, record)
 	if err != nil {
+		logger.Error().Err(err).Msg("record donation failed")
 		return err
 	}
+	// 重复的 snapshot, 已经处理过
+	if !created {
+		return nil
+	}
+	s.feed.Publish(event, api.DonationTopics(pid)...)
+
+	s.notifyDonation(ctx, &logger, project, event, s.userLanguage(ctx, project.MixinUID))
 
 	return nil
 }
+
+// parseSnapshotMemo 解析 memo, 兼容旧版 hex 编码的 pid
+// isConsolidationSnapshot 机器人转给自己或带聚合 memo 的 snapshot
+func (s *Service) isConsolidationSnapshot(snapshot *mixin.SafeSnapshot) bool {
+	if snapshot.OpponentID != "" && snapshot.OpponentID == s.conf.MixinConfig.ClientID {
+		return true
+	}
+	extra := snapshot.Memo
+	if data, err := hex.DecodeString(extra); err == nil {
+		extra = string(data)
+	}
+	return extra == mixin_client_wrapper.AGGREGRATE_UTXO_MEMO
+}
+
+func newSnapshotRecord(snapshot *mixin.SafeSnapshot) *model.Snapshot {
+	return &model.Snapshot{
+		SnapshotId: snapshot.SnapshotID,
+		RequestId:  snapshot.RequestID,
+		UserId:     snapshot.OpponentID,
+		AssetId:    snapshot.AssetID,
+		Memo:       snapshot.Memo,
+		CreatedAt:  snapshot.CreatedAt.Unix(),
+		Amount:     snapshot.Amount,
+	}
+}
+
+func parseSnapshotMemo(snapshotMemo string) (*memo.Memo, error) {
+	m, err := memo.Decode(snapshotMemo)
+	if err != nil {
+		return nil, ErrInvalidSnapshotMemo
+	}
+	return m, nil
+}
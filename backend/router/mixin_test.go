@@ -0,0 +1,394 @@
+package router
+
+import (
+	"context"
+	"donate/clock"
+	"donate/config"
+	"donate/model"
+	"donate/model/mixin_client_wrapper/mixintest"
+	"donate/pkg/memo"
+	"donate/utils"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fox-one/mixin-sdk-go/v2"
+	"github.com/fox-one/pkg/db"
+	"github.com/fox-one/pkg/store2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const (
+	testBotID   = "2a4b6c8d-0e1f-4a3b-8c5d-7e9f1a2b3c4d"
+	testDonorID = "3b5c7d9e-1f2a-4b4c-9d6e-8f0a2b3c4d5e"
+	testOwnerID = "4c6d8e0f-2a3b-4c5d-8e7f-9a1b3c4d5e6f"
+	testPID     = "5d7e9f1a-3b4c-4d6e-9f8a-0b2c4d5e6f7a"
+	testAssetID = "965e5c6e-434c-3fa9-b780-c50f43cd955c"
+)
+
+type testEnv struct {
+	svc     *Service
+	store   model.Store
+	network *mixintest.Network
+	clock   *clock.Mock
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	conn, err := store2.Open(db.SqliteInMemory(), nil)
+	require.NoError(t, err)
+	// 内存数据库每个连接都是独立的库, 限制为单连接
+	sqlDB, err := conn.DB.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = conn.Close() })
+	require.NoError(t, store2.Migrate(conn))
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewMock()
+	clk.Set(start)
+
+	network := mixintest.NewNetwork(testBotID, start)
+	network.AddUser(&mixin.User{UserID: testDonorID, IdentityNumber: "1001", FullName: "donor"})
+	network.AddUser(&mixin.User{UserID: testOwnerID, IdentityNumber: "2001", FullName: "owner"})
+	network.AddAsset(&mixin.SafeAsset{AssetID: testAssetID, Symbol: "USDT", PriceUSD: decimal.NewFromInt(1)})
+
+	store := model.NewStore(conn)
+	require.NoError(t, store.AddProject(context.Background(), &model.Project{
+		PID:            testPID,
+		Title:          "project",
+		IdentityNumber: "2001",
+		MixinUID:       testOwnerID,
+	}))
+
+	conf := &config.Config{
+		MixinConfig: &config.MixinConfig{ClientID: testBotID},
+		// 测试的 webhook 接收方在本机
+		Webhook: &config.WebhookConfig{AllowPrivateNetwork: true},
+	}
+	return &testEnv{
+		svc:     newService(conf, store, network, clk),
+		store:   store,
+		network: network,
+		clock:   clk,
+	}
+}
+
+func pidMemo(pid string) string {
+	return hex.EncodeToString([]byte(pid))
+}
+
+func TestDonateForward(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	snapshot := env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(10), pidMemo(testPID))
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+
+	actions, err := env.store.QueryDonateActionsByPID(ctx, testPID)
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	assert.Equal(t, "1001", actions[0].IdentityNumber)
+	assert.True(t, actions[0].AmountUSD.Equal(decimal.NewFromInt(10)))
+	assert.Len(t, env.network.Messages(testOwnerID), 1)
+
+	// 转账提交后, 下一轮按 request id 确认
+	requestId := utils.GenUuidFromStrings(snapshot.RequestID, "donate-transfer")
+	require.NoError(t, env.svc.handlePayouts(ctx))
+	payout, err := env.store.GetPayout(ctx, requestId)
+	require.NoError(t, err)
+	assert.Equal(t, model.PayoutStatusSubmitted, payout.Status)
+
+	require.NoError(t, env.svc.handlePayouts(ctx))
+	payout, err = env.store.GetPayout(ctx, requestId)
+	require.NoError(t, err)
+	assert.Equal(t, model.PayoutStatusConfirmed, payout.Status)
+
+	assert.True(t, env.network.Balance(testOwnerID, testAssetID).Equal(decimal.NewFromInt(10)))
+	assert.True(t, env.network.Balance(testDonorID, testAssetID).IsZero())
+
+	// 机器人自己转出的 snapshot 和重复轮询都不会再次入账
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+	actions, err = env.store.QueryDonateActionsByPID(ctx, testPID)
+	require.NoError(t, err)
+	assert.Len(t, actions, 1)
+	assert.Len(t, env.network.Messages(testOwnerID), 1)
+}
+
+func TestDonateRefundUnknownProject(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	unknownPID := "6e8f0a2b-4c5d-4e7f-8a9b-1c3d5e7f9a0b"
+	snapshot := env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(3), pidMemo(unknownPID))
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+	require.NoError(t, env.svc.handlePayouts(ctx))
+
+	payout, err := env.store.GetPayout(ctx, utils.GenUuidFromStrings(snapshot.RequestID, "donate-refund"))
+	require.NoError(t, err)
+	assert.Equal(t, model.PayoutKindRefund, payout.Kind)
+	assert.True(t, env.network.Balance(testDonorID, testAssetID).Equal(decimal.NewFromInt(3)))
+	assert.Empty(t, env.network.Messages(testOwnerID))
+}
+
+func TestDonateLedger(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	unknownPID := "6e8f0a2b-4c5d-4e7f-8a9b-1c3d5e7f9a0b"
+	env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(10), pidMemo(testPID))
+	env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(3), pidMemo(unknownPID))
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+
+	balances := func() map[string]string {
+		items, err := env.store.ListLedgerBalances(ctx, "", 0)
+		require.NoError(t, err)
+		m := map[string]string{}
+		for _, item := range items {
+			m[item.Account] = item.Amount.String()
+		}
+		return m
+	}
+	// 捐赠计入项目, 退款仍由捐赠者持有
+	assert.Equal(t, map[string]string{
+		model.LedgerAccountWallet:      "13",
+		model.UserAccount(testDonorID): "-3",
+		model.ProjectAccount(testPID):  "-10",
+	}, balances())
+
+	// 出账确认后各账户清零
+	require.NoError(t, env.svc.handlePayouts(ctx))
+	require.NoError(t, env.svc.handlePayouts(ctx))
+	assert.Empty(t, balances())
+
+	imbalances, err := env.store.ListLedgerImbalances(ctx, 0)
+	require.NoError(t, err)
+	assert.Empty(t, imbalances)
+}
+
+func TestDonateInvalidMemo(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	snapshot := env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), "not a pid")
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+
+	// 只记录 snapshot, 不转账也不退款, 游标继续前进
+	_, err := env.store.GetSnapshotById(ctx, snapshot.SnapshotID)
+	require.NoError(t, err)
+	payouts, err := env.store.ListUnfinishedPayouts(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, payouts)
+
+	cursor, err := env.svc.getSnapshotCursor(ctx)
+	require.NoError(t, err)
+	assert.True(t, cursor.Equal(snapshot.CreatedAt))
+}
+
+func TestPayoutRetryAfterTransferFailure(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	snapshot := env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(5), pidMemo(testPID))
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+
+	env.network.TransferErr = errors.New("network unavailable")
+	require.NoError(t, env.svc.handlePayouts(ctx))
+
+	requestId := utils.GenUuidFromStrings(snapshot.RequestID, "donate-transfer")
+	payout, err := env.store.GetPayout(ctx, requestId)
+	require.NoError(t, err)
+	assert.Equal(t, model.PayoutStatusPending, payout.Status)
+	assert.Equal(t, 1, payout.Attempts)
+	assert.Equal(t, "network unavailable", payout.LastError)
+
+	env.network.TransferErr = nil
+	require.NoError(t, env.svc.handlePayouts(ctx))
+	require.NoError(t, env.svc.handlePayouts(ctx))
+
+	payout, err = env.store.GetPayout(ctx, requestId)
+	require.NoError(t, err)
+	assert.Equal(t, model.PayoutStatusConfirmed, payout.Status)
+	assert.True(t, env.network.Balance(testOwnerID, testAssetID).Equal(decimal.NewFromInt(5)))
+	assert.Empty(t, env.network.Utxos(testAssetID, mixin.SafeUtxoStateUnspent))
+}
+
+func TestDonateStructuredMemo(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	encoded, err := memo.Encode(&memo.Memo{PID: testPID, Message: "good luck", Anonymous: true, Referral: "friend"})
+	require.NoError(t, err)
+	env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(2), hex.EncodeToString([]byte(encoded)))
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+
+	actions, err := env.store.QueryDonateActionsByPID(ctx, testPID)
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	assert.Equal(t, "good luck", actions[0].Message)
+	assert.True(t, actions[0].Anonymous)
+	assert.Equal(t, "friend", actions[0].ReferralCode)
+
+	messages := env.network.Messages(testOwnerID)
+	require.Len(t, messages, 1)
+	require.Equal(t, mixin.MessageCategoryAppCard, messages[0].Category)
+	card := messages[0].Card
+	assert.Equal(t, "project", card.Title)
+	assert.Equal(t, "Anonymous donated 2 USDT (≈ $2.00): good luck", card.Description)
+	assert.NotContains(t, card.Description, "1001")
+	assert.Empty(t, card.IconURL)
+}
+
+func TestDonateNotificationFallback(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.network.CardErr = errors.New("card rejected")
+
+	env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(2), pidMemo(testPID))
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+
+	// 卡片发送失败时改为纯文本
+	messages := env.network.Messages(testOwnerID)
+	require.Len(t, messages, 1)
+	assert.Equal(t, mixin.MessageCategoryPlainText, messages[0].Category)
+	assert.Equal(t, `donor donated 2 USDT (≈ $2.00) to your project "project".`, messages[0].Text)
+}
+
+func TestSnapshotBackfillPages(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	var last *mixin.SafeSnapshot
+	for i := 0; i < snapshotPageSize*2+100; i++ {
+		last = env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), "not a pid")
+	}
+
+	// 一轮内翻完所有页
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+	count, err := env.store.GetSnapshotCount(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, snapshotPageSize*2+100, count)
+
+	cursor, err := env.svc.getSnapshotCursor(ctx)
+	require.NoError(t, err)
+	assert.True(t, cursor.Equal(last.CreatedAt))
+}
+
+func TestSnapshotPageBoundaryDedup(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	for i := 0; i < snapshotPageSize-1; i++ {
+		env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), "not a pid")
+	}
+	// 同一时间点的 snapshot 跨过页边界, 下一页从该时间点重新读取
+	env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), "not a pid")
+	env.network.FreezeTime = true
+	for i := 0; i < 3; i++ {
+		env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), pidMemo(testPID))
+	}
+	env.network.FreezeTime = false
+
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+	count, err := env.store.GetSnapshotCount(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, snapshotPageSize+3, count)
+
+	// 页边界上的捐赠只入账一次
+	actions, err := env.store.QueryDonateActionsByPID(ctx, testPID)
+	require.NoError(t, err)
+	assert.Len(t, actions, 3)
+	assert.Len(t, env.network.Messages(testOwnerID), 3)
+}
+
+func TestSnapshotPageStuckAtOneTimestamp(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	const otherAssetID = "c6d0c728-2624-429b-8e0d-d9d19b6592fa"
+	env.network.AddAsset(&mixin.SafeAsset{AssetID: otherAssetID, Symbol: "BTC", PriceUSD: decimal.NewFromInt(1)})
+
+	// 同一时间点超过一页的 snapshot 分布在两个资产中
+	env.network.FreezeTime = true
+	var stuck *mixin.SafeSnapshot
+	for i := 0; i < snapshotPageSize+100; i++ {
+		assetID := testAssetID
+		if i%2 == 1 {
+			assetID = otherAssetID
+		}
+		stuck = env.network.Deposit(testDonorID, assetID, decimal.NewFromInt(1), "not a pid")
+	}
+	stuckDonation := env.network.Deposit(testDonorID, otherAssetID, decimal.NewFromInt(1), pidMemo(testPID))
+	env.network.FreezeTime = false
+	after := env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), pidMemo(testPID))
+
+	// 按资产读完该时间点的 snapshot, 之后的 snapshot 继续入账
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+	count, err := env.store.GetSnapshotCount(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, snapshotPageSize+102, count)
+	for _, snapshot := range []*mixin.SafeSnapshot{stuckDonation, after} {
+		_, err := env.store.GetSnapshotById(ctx, snapshot.SnapshotID)
+		require.NoError(t, err)
+	}
+	cursor, err := env.svc.getSnapshotCursor(ctx)
+	require.NoError(t, err)
+	assert.True(t, cursor.After(stuck.CreatedAt))
+	_, err = env.store.GetSyncState(ctx, model.SyncStateSnapshotGap+testAssetID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// 下一轮不再重复读取该时间点
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+	actions, err := env.store.QueryDonateActionsByPID(ctx, testPID)
+	require.NoError(t, err)
+	assert.Len(t, actions, 2)
+}
+
+func TestSnapshotGapRecorded(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	// 单个资产在同一时间点超过一页, 无法读完时记录缺口
+	env.network.FreezeTime = true
+	var stuck *mixin.SafeSnapshot
+	for i := 0; i < snapshotPageSize+10; i++ {
+		stuck = env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), "not a pid")
+	}
+	env.network.FreezeTime = false
+	after := env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), pidMemo(testPID))
+
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+	_, err := env.store.GetSnapshotById(ctx, after.SnapshotID)
+	require.NoError(t, err)
+	gap, err := env.store.GetSyncState(ctx, model.SyncStateSnapshotGap+testAssetID)
+	require.NoError(t, err)
+	assert.Equal(t, stuck.CreatedAt.UTC().Format(time.RFC3339Nano), gap.Value)
+}
+
+func TestSnapshotCursorAcrossRestart(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), pidMemo(testPID))
+	first := env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(2), pidMemo(testPID))
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+
+	// 重启后从持久化的游标继续, 已入账的 snapshot 不会重复处理
+	restarted := newService(env.svc.conf, env.store, env.network, env.clock)
+	cursor, err := restarted.getSnapshotCursor(ctx)
+	require.NoError(t, err)
+	assert.True(t, cursor.Equal(first.CreatedAt))
+
+	second := env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(3), pidMemo(testPID))
+	require.NoError(t, restarted.handleMixinSnapshotInput(ctx))
+	actions, err := env.store.QueryDonateActionsByPID(ctx, testPID)
+	require.NoError(t, err)
+	assert.Len(t, actions, 3)
+	assert.Len(t, env.network.Messages(testOwnerID), 3)
+
+	cursor, err = restarted.getSnapshotCursor(ctx)
+	require.NoError(t, err)
+	assert.True(t, cursor.Equal(second.CreatedAt))
+}
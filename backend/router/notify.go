@@ -0,0 +1,58 @@
+package router
+
+import (
+	"context"
+	"donate/model"
+	"donate/pkg/notify"
+	"donate/router/api"
+
+	"github.com/rs/zerolog"
+)
+
+// newDonationNotice 通知模板的数据, event 中的匿名捐赠者已经隐藏
+func (s *Service) newDonationNotice(project *model.Project, event *api.DonationEvent) *notify.Donation {
+	notice := &notify.Donation{
+		PID:          project.PID,
+		ProjectTitle: project.Title,
+		ProjectURL:   s.notifier.ProjectURL(project.PID),
+		DonorName:    event.FullName,
+		DonorAvatar:  event.AvatarUrl,
+		Anonymous:    event.Anonymous,
+		Amount:       event.Amount.String(),
+		Symbol:       event.Symbol,
+		AssetIcon:    event.IconURL,
+		Message:      event.Message,
+	}
+	if notice.DonorName == "" {
+		notice.DonorName = event.IdentityNumber
+	}
+	if notice.Symbol == "" {
+		notice.Symbol = event.AssetID
+	}
+	if event.AmountUSD.IsPositive() {
+		notice.AmountUSD = event.AmountUSD.StringFixed(2)
+	}
+	return notice
+}
+
+// notifyDonation 给项目方发送捐赠卡片, 卡片发送失败时改为纯文本消息
+func (s *Service) notifyDonation(ctx context.Context, logger *zerolog.Logger, project *model.Project, event *api.DonationEvent, lang string) {
+	notice := s.newDonationNotice(project, event)
+
+	card, err := s.notifier.Card(lang, notice)
+	if err == nil {
+		if err = s.mixinClient.SendCardWithRetry(ctx, project.MixinUID, card); err == nil {
+			return
+		}
+	}
+	logger.Warn().Err(err).Msg("send donate card failed, fallback to text")
+
+	text, err := s.notifier.Text(lang, notice)
+	if err != nil {
+		logger.Error().Err(err).Msg("render donate msg failed")
+		return
+	}
+	if err := s.mixinClient.SendMessageWithRetry(ctx, project.MixinUID, text); err != nil {
+		logger.Error().Err(err).Msg("send donate msg error")
+	}
+}
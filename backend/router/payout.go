@@ -0,0 +1,142 @@
+package router
+
+import (
+	"context"
+	"donate/model"
+	"donate/model/mixin_client_wrapper"
+	"errors"
+	"time"
+
+	"github.com/fox-one/mixin-sdk-go/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	payoutBatchSize   = 50
+	payoutMaxAttempts = 10
+)
+
+var (
+	ErrListUnfinishedPayoutsFailed = errors.New("list unfinished payouts failed")
+)
+
+// newPayout 填充出账记录的初始状态
+// request id 由 snapshot 确定性生成, 重复写入会被忽略
+func (s *Service) newPayout(payout *model.Payout) *model.Payout {
+	now := s.clock.Now().Unix()
+	payout.Status = model.PayoutStatusPending
+	payout.CreatedAt = now
+	payout.UpdatedAt = now
+	return payout
+}
+
+// RunPayoutLoop 轮询推进出账, 阻塞直到 ctx 取消
+func (s *Service) RunPayoutLoop(ctx context.Context) {
+	ticker := s.clock.Ticker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Err(ctx.Err()).Msg("stop payout loop")
+			return
+		case <-ticker.C:
+			err := s.handlePayouts(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("cron handle payouts failed")
+			}
+		}
+	}
+}
+
+func (s *Service) handlePayouts(ctx context.Context) error {
+	payouts, err := s.store.ListUnfinishedPayouts(ctx, payoutBatchSize)
+	if err != nil {
+		return ErrListUnfinishedPayoutsFailed
+	}
+
+	// ctx 取消后不再开始新的出账, 进行中的转账在 shutdownTimeout 内完成
+	// 超时中断的出账保持原状态, 下次启动按 request id 查询后继续
+	workCtx, cancel := drainContext(ctx, s.shutdownTimeout())
+	defer cancel()
+
+	for _, payout := range payouts {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err := s.handlePayout(workCtx, payout); err != nil {
+			log.Error().Any("payout", payout).Err(err).Msg("handle payout failed")
+			continue
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) handlePayout(ctx context.Context, payout *model.Payout) error {
+	// 先按 request id 查询交易, 已存在则只同步状态, 保证不会重复转账
+	req, err := s.mixinClient.SafeReadTransactionRequest(ctx, payout.RequestId)
+	switch {
+	case err == nil:
+		switch req.State {
+		case mixin.SafeUtxoStateSpent:
+			// 先记账再更新状态, 记账以交易 id 保证幂等, 中断后下一轮补记
+			if err := s.postPayoutLedger(ctx, payout); err != nil {
+				return err
+			}
+			return s.updatePayout(ctx, payout, model.PayoutStatusConfirmed, "")
+		case mixin.SafeUtxoStateSigned:
+			if payout.Status == model.PayoutStatusSubmitted {
+				return nil
+			}
+			return s.updatePayout(ctx, payout, model.PayoutStatusSubmitted, "")
+		}
+		// unspent: 交易已创建但未提交, 使用相同 request id 重新提交
+	case mixin.IsErrorCodes(err, mixin.EndpointNotFound):
+	default:
+		return err
+	}
+
+	payout.Attempts++
+	err = s.mixinClient.TransferOneWithRetry(ctx, &mixin_client_wrapper.TransferOneRequest{
+		RequestId: payout.RequestId,
+		AssetId:   payout.AssetId,
+		Amount:    payout.Amount,
+		Member:    payout.Member,
+		Memo:      payout.Memo,
+	})
+	if err != nil {
+		status := model.PayoutStatusPending
+		if payout.Attempts >= payoutMaxAttempts {
+			status = model.PayoutStatusFailed
+		}
+		if err1 := s.updatePayout(ctx, payout, status, err.Error()); err1 != nil {
+			log.Error().Err(err1).Str("request_id", payout.RequestId).Msg("update payout failed")
+		}
+		return err
+	}
+
+	return s.updatePayout(ctx, payout, model.PayoutStatusSubmitted, "")
+}
+
+func (s *Service) updatePayout(ctx context.Context, payout *model.Payout, status, lastError string) error {
+	payout.Status = status
+	payout.LastError = lastError
+	payout.UpdatedAt = s.clock.Now().Unix()
+	return s.store.UpdatePayout(ctx, payout)
+}
+
+// postPayoutLedger 出账确认后记账
+// 手动转给项目方的 snapshot 入账时没有计入项目, 此时一并计入, 已计入的会被忽略
+func (s *Service) postPayoutLedger(ctx context.Context, payout *model.Payout) error {
+	now := s.clock.Now().Unix()
+	entries := model.PayoutLedgerEntries(payout, now)
+	if payout.Kind == model.PayoutKindForward && payout.PID != "" {
+		snapshot, err := s.store.GetSnapshotById(ctx, payout.SnapshotId)
+		if err != nil {
+			return err
+		}
+		entries = append(model.DonationLedgerEntries(snapshot, payout.PID, now), entries...)
+	}
+	return s.store.PostLedgerEntries(ctx, entries)
+}
@@ -0,0 +1,291 @@
+package router
+
+import (
+	"context"
+	"donate/model"
+	"donate/pkg/memo"
+	"donate/router/api"
+	"donate/router/middleware"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fox-one/mixin-sdk-go/v2"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// countingStore 统计按单条查询用户和项目的次数
+type countingStore struct {
+	model.UserStore
+	model.ProjectStore
+
+	getUser    atomic.Int32
+	getProject atomic.Int32
+}
+
+func (s *countingStore) GetUserByIdentityNumber(ctx context.Context, ident string) (*model.User, error) {
+	s.getUser.Add(1)
+	return s.UserStore.GetUserByIdentityNumber(ctx, ident)
+}
+
+func (s *countingStore) GetProject(ctx context.Context, pid string) (*model.Project, error) {
+	s.getProject.Add(1)
+	return s.ProjectStore.GetProject(ctx, pid)
+}
+
+func (s *countingStore) reset() {
+	s.getUser.Store(0)
+	s.getProject.Store(0)
+}
+
+func getJSON(t *testing.T, env *testEnv, path string, v interface{}) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	env.svc.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+	return w
+}
+
+func TestDonationListsBatchQueries(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	const donor2ID = "6e8f0a2b-4c5d-4e7f-8a9b-1c3d5e7f9a0b"
+	env.network.AddUser(&mixin.User{UserID: donor2ID, IdentityNumber: "1002", FullName: "donor2"})
+	require.NoError(t, env.store.AddUser(ctx, &model.User{MixinUID: testOwnerID, IdentityNumber: "2001", FullName: "owner"}))
+
+	anonymous, err := memo.Encode(&memo.Memo{PID: testPID, Anonymous: true})
+	require.NoError(t, err)
+	env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), pidMemo(testPID))
+	env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(2), pidMemo(testPID))
+	env.network.Deposit(donor2ID, testAssetID, decimal.NewFromInt(3), anonymous)
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+
+	counter := &countingStore{UserStore: env.store.UserStore, ProjectStore: env.store.ProjectStore}
+	store := env.store
+	store.UserStore, store.ProjectStore = counter, counter
+	env.svc.apiServer = api.New(env.svc.conf.MixinConfig, env.network, store, env.svc.feed)
+	env.svc.initRouter()
+
+	// 查询次数不随捐赠记录增加
+	var donateUsers []api.UserAction
+	getJSON(t, env, "/donate-users/"+testPID, &donateUsers)
+	require.Len(t, donateUsers, 3)
+	names := map[string]bool{}
+	for _, item := range donateUsers {
+		names[item.FullName] = true
+		assert.Equal(t, "2001", item.User.IdentityNumber)
+		assert.Equal(t, testPID, item.Project.PID)
+		assert.Equal(t, "USDT", item.Asset.Symbol)
+	}
+	assert.Equal(t, map[string]bool{"donor": true, "Anonymous": true}, names)
+	assert.EqualValues(t, 1, counter.getProject.Load())
+	assert.EqualValues(t, 1, counter.getUser.Load())
+
+	counter.reset()
+	var userDonations []api.UserAction
+	getJSON(t, env, "/users-donate/1001", &userDonations)
+	require.Len(t, userDonations, 2)
+	for _, item := range userDonations {
+		assert.Equal(t, "donor", item.FullName)
+		assert.Equal(t, "2001", item.User.IdentityNumber)
+		assert.Equal(t, testPID, item.Project.PID)
+	}
+	// 匿名捐赠不出现在捐赠者的记录中
+	getJSON(t, env, "/users-donate/1002", &userDonations)
+	assert.Empty(t, userDonations)
+	assert.EqualValues(t, 0, counter.getProject.Load())
+	assert.EqualValues(t, 2, counter.getUser.Load())
+
+	counter.reset()
+	var projects struct {
+		Items []struct {
+			Project  *model.Project  `json:"project"`
+			User     *model.User     `json:"user"`
+			Campaign *model.Campaign `json:"campaign"`
+		} `json:"items"`
+	}
+	getJSON(t, env, "/projects", &projects)
+	require.Len(t, projects.Items, 1)
+	assert.Equal(t, "owner", projects.Items[0].User.FullName)
+	assert.EqualValues(t, 3, projects.Items[0].Project.DonateCnt)
+	assert.EqualValues(t, 0, counter.getProject.Load())
+	assert.EqualValues(t, 0, counter.getUser.Load())
+}
+
+func TestDonationListsPagination(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	require.NoError(t, env.store.AddProject(ctx, &model.Project{PID: "0d1e2f3a-4b5c-4d6e-8f7a-9b0c1d2e3f4a", Title: "other", IdentityNumber: "2001"}))
+	for _, amount := range []int64{2, 3, 1} {
+		env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(amount), pidMemo(testPID))
+	}
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+
+	var (
+		amounts []string
+		path    = "/donate-users/" + testPID + "?limit=2&sort=amount"
+	)
+	for path != "" {
+		var page []api.UserAction
+		w := getJSON(t, env, path, &page)
+		for _, item := range page {
+			amounts = append(amounts, item.Amount.String())
+		}
+		path = ""
+		if next := w.Header().Get(api.NextCursorHeader); next != "" {
+			path = "/donate-users/" + testPID + "?limit=2&sort=amount&cursor=" + next
+		}
+	}
+	assert.Equal(t, []string{"3", "2", "1"}, amounts)
+
+	var page []api.UserAction
+	getJSON(t, env, "/users-donate/1001?min_amount=2&sort=amount&order=asc&since=2020-01-01", &page)
+	require.Len(t, page, 2)
+	assert.Equal(t, "2", page[0].Amount.String())
+	getJSON(t, env, "/users-donate/1001?until=2020-01-01", &page)
+	assert.Empty(t, page)
+
+	// 不传 limit 和 cursor 时返回全部记录, 不受默认分页大小限制
+	for i := 0; i < 120; i++ {
+		env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), pidMemo(testPID))
+	}
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+	w := getJSON(t, env, "/donate-users/"+testPID, &page)
+	assert.Len(t, page, 123)
+	assert.Empty(t, w.Header().Get(api.NextCursorHeader))
+	w = getJSON(t, env, "/users-donate/1001", &page)
+	assert.Len(t, page, 123)
+	assert.Empty(t, w.Header().Get(api.NextCursorHeader))
+	// 只传 cursor 时按默认大小分页
+	w = getJSON(t, env, "/donate-users/"+testPID+"?limit=1", &page)
+	w = getJSON(t, env, "/donate-users/"+testPID+"?cursor="+w.Header().Get(api.NextCursorHeader), &page)
+	assert.Len(t, page, 100)
+	assert.NotEmpty(t, w.Header().Get(api.NextCursorHeader))
+
+	// 下一页的 cursor 只在响应头中, 没有登录过的项目方为 null
+	var projects struct {
+		Items []struct {
+			User json.RawMessage `json:"user"`
+		} `json:"items"`
+	}
+	w = getJSON(t, env, "/projects?limit=1", &projects)
+	require.Len(t, projects.Items, 1)
+	next := w.Header().Get(api.NextCursorHeader)
+	require.NotEmpty(t, next)
+	assert.NotContains(t, w.Body.String(), "nextCursor")
+	assert.Equal(t, "null", string(projects.Items[0].User))
+	w = getJSON(t, env, "/projects?limit=1&cursor="+next, &projects)
+	require.Len(t, projects.Items, 1)
+	assert.Empty(t, w.Header().Get(api.NextCursorHeader))
+	assert.Equal(t, "null", string(projects.Items[0].User))
+
+	// 参数错误, cursor 与排序不一致
+	w = getJSON(t, env, "/donate-users/"+testPID+"?limit=1", &page)
+	for path, code := range map[string]string{
+		"/donate-users/" + testPID + "?sort=name":                                               "invalid_sort",
+		"/donate-users/" + testPID + "?order=up":                                                "invalid_sort",
+		"/donate-users/" + testPID + "?since=yesterday":                                         "invalid_time_range",
+		"/donate-users/" + testPID + "?since=2024-02-01&until=2024-01-01":                       "invalid_time_range",
+		"/donate-users/" + testPID + "?min_amount=-1":                                           "invalid_amount",
+		"/donate-users/" + testPID + "?cursor=bad":                                              "invalid_cursor",
+		"/donate-users/" + testPID + "?sort=usd&cursor=" + w.Header().Get(api.NextCursorHeader): "invalid_cursor",
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		env.svc.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		var resp middleware.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, code, resp.Code, path)
+	}
+}
+
+func TestDonateUsersByBase64Link(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	require.NoError(t, env.store.AddUser(ctx, &model.User{MixinUID: testOwnerID, IdentityNumber: "2001", FullName: "owner"}))
+	env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), pidMemo(testPID))
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+
+	// 编辑后的项目内容对应新的 base64 链接
+	w := authRequest(t, env, testOwnerID, http.MethodPut, "/projects/"+testPID, &api.ProjectRequest{Title: "edited", Description: "new description"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	data, err := json.Marshal(map[string]string{"title": "edited", "description": "new description", "identityNumber": "2001"})
+	require.NoError(t, err)
+	link := base64.StdEncoding.EncodeToString(data)
+	require.NotContains(t, link, "/")
+
+	var donateUsers []api.UserAction
+	getJSON(t, env, "/donate-users/"+link, &donateUsers)
+	require.Len(t, donateUsers, 1)
+	assert.Equal(t, "donor", donateUsers[0].FullName)
+	assert.Equal(t, testPID, donateUsers[0].Project.PID)
+
+	var project api.GetProjectResponse
+	getJSON(t, env, "/project/"+link, &project)
+	assert.Equal(t, testPID, project.PID)
+}
+
+func TestBannedOwnerCannotManageProject(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	bannedAt := env.clock.Now()
+	require.NoError(t, env.store.AddUser(ctx, &model.User{MixinUID: testOwnerID, IdentityNumber: "2001", FullName: "owner", BannedAt: &bannedAt}))
+
+	// 被封禁的项目方不能编辑, 归档或删除项目
+	for _, req := range []struct {
+		method, path string
+		body         interface{}
+	}{
+		{http.MethodPut, "/projects/" + testPID, &api.ProjectRequest{Title: "edited"}},
+		{http.MethodPost, "/projects/" + testPID + "/archive", nil},
+		{http.MethodDelete, "/projects/" + testPID, nil},
+	} {
+		w := authRequest(t, env, testOwnerID, req.method, req.path, req.body)
+		assert.Equal(t, http.StatusForbidden, w.Code, req.path)
+		var resp middleware.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "user_banned", resp.Code, req.path)
+	}
+
+	project, err := env.store.GetProject(ctx, testPID)
+	require.NoError(t, err)
+	assert.Equal(t, "project", project.Title)
+	assert.Nil(t, project.ArchivedAt)
+}
+
+func TestDeleteProjectWithDonations(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	require.NoError(t, env.store.AddUser(ctx, &model.User{MixinUID: testOwnerID, IdentityNumber: "2001", FullName: "owner"}))
+	env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), pidMemo(testPID))
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+
+	// 已有捐赠的项目不能删除, 提示改为归档
+	w := authRequest(t, env, testOwnerID, http.MethodDelete, "/projects/"+testPID, nil)
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	var resp middleware.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "project_has_donations", resp.Code)
+	_, err := env.store.GetProject(ctx, testPID)
+	require.NoError(t, err)
+
+	w = authRequest(t, env, testOwnerID, http.MethodPost, "/projects/"+testPID+"/archive", nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// 没有捐赠的项目可以删除
+	const otherPID = "0d1e2f3a-4b5c-4d6e-8f7a-9b0c1d2e3f4a"
+	require.NoError(t, env.store.AddProject(ctx, &model.Project{PID: otherPID, Title: "other", IdentityNumber: "2001", MixinUID: testOwnerID}))
+	w = authRequest(t, env, testOwnerID, http.MethodDelete, "/projects/"+otherPID, nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	_, err = env.store.GetProject(ctx, otherPID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
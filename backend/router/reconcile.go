@@ -0,0 +1,195 @@
+package router
+
+import (
+	"context"
+	"donate/model"
+	mr "donate/pkg/mapreduce"
+	"donate/utils"
+	"sort"
+	"time"
+
+	"github.com/fox-one/mixin-sdk-go/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/samber/lo"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	defaultReconcileInterval     = 10 * time.Minute
+	defaultReconcileThresholdUSD = 1
+)
+
+// reconcileInterval 对账周期, 未配置时为 10 分钟
+func (s *Service) reconcileInterval() time.Duration {
+	if conf := s.conf.Reconcile; conf != nil && conf.IntervalSeconds > 0 {
+		return time.Duration(conf.IntervalSeconds) * time.Second
+	}
+	return defaultReconcileInterval
+}
+
+// reconcileThreshold 告警阈值 (美元), 未配置时为 1
+func (s *Service) reconcileThreshold() decimal.Decimal {
+	if conf := s.conf.Reconcile; conf != nil && conf.ThresholdUSD > 0 {
+		return decimal.NewFromFloat(conf.ThresholdUSD)
+	}
+	return decimal.NewFromInt(defaultReconcileThresholdUSD)
+}
+
+// RunReconcileLoop 定期对账, 阻塞直到 ctx 取消
+func (s *Service) RunReconcileLoop(ctx context.Context) {
+	ticker := s.clock.Ticker(s.reconcileInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Err(ctx.Err()).Msg("stop reconcile loop")
+			return
+		case <-ticker.C:
+			if _, err := s.reconcile(ctx); err != nil {
+				log.Error().Err(err).Msg("cron reconcile failed")
+			}
+		}
+	}
+}
+
+// reconcile 按资产对比钱包中未花费的 utxo 与账面 (入账 - 已确认的出账), 保存本次结果
+// 钱包少于账面的部分先以未完成的出账和聚合解释, 剩余的差额超过阈值时告警
+func (s *Service) reconcile(ctx context.Context) ([]*model.Reconciliation, error) {
+	// 定时任务和手动对账不并行, 避免重复告警
+	s.reconcileMutex.Lock()
+	defer s.reconcileMutex.Unlock()
+
+	var (
+		utxos    []*mixin.SafeUtxo
+		ledgers  []*model.AssetLedger
+		assets   []*mixin.SafeAsset
+		previous []*model.Reconciliation
+
+		consolidations []*model.Consolidation
+		fees           []*model.LedgerBalance
+	)
+	err := mr.Finish(func() (err error) {
+		utxos, err = s.mixinClient.ListUnspentUtxos(ctx, "")
+		return err
+	}, func() (err error) {
+		ledgers, err = s.store.ListAssetLedgers(ctx)
+		return err
+	}, func() (err error) {
+		assets, err = s.mixinClient.ListAssets(ctx)
+		return err
+	}, func() (err error) {
+		previous, err = s.store.GetLatestReconciliations(ctx)
+		return err
+	}, func() (err error) {
+		consolidations, err = s.store.ListUnfinishedConsolidations(ctx, consolidateBatchSize)
+		return err
+	}, func() (err error) {
+		fees, err = s.store.ListLedgerBalances(ctx, model.LedgerAccountFee, 0)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	actual := map[string]decimal.Decimal{}
+	for _, utxo := range utxos {
+		actual[utxo.AssetID] = actual[utxo.AssetID].Add(utxo.Amount)
+	}
+	ledgerMap := lo.KeyBy(ledgers, func(l *model.AssetLedger) string { return l.AssetID })
+	// 聚合支付的手续费与已确认的出账一样离开钱包
+	feeMap := lo.KeyBy(fees, func(b *model.LedgerBalance) string { return b.AssetID })
+	// 已提交的聚合与未完成的出账一样, 输入已花费而输出尚未到账
+	inflight := pendingConsolidations(consolidations)
+	assetIDs := lo.Union(lo.Keys(actual), lo.Keys(ledgerMap))
+	sort.Strings(assetIDs)
+
+	var (
+		runID     = utils.RandomTraceID()
+		now       = s.clock.Now().Unix()
+		threshold = s.reconcileThreshold()
+		assetMap  = lo.KeyBy(assets, func(a *mixin.SafeAsset) string { return a.AssetID })
+		items     = make([]*model.Reconciliation, 0, len(assetIDs))
+	)
+	for _, assetID := range assetIDs {
+		ledger, ok := ledgerMap[assetID]
+		if !ok {
+			ledger = &model.AssetLedger{AssetID: assetID}
+		}
+		paid := ledger.Paid
+		if fee, ok := feeMap[assetID]; ok {
+			paid = paid.Add(fee.Amount)
+		}
+		item := &model.Reconciliation{
+			RunID:     runID,
+			AssetID:   assetID,
+			Received:  ledger.Received,
+			Paid:      paid,
+			Pending:   ledger.Pending.Add(inflight[assetID]),
+			Expected:  ledger.Received.Sub(paid),
+			Actual:    actual[assetID],
+			CreatedAt: now,
+		}
+		item.Difference = item.Actual.Sub(item.Expected)
+		item.Discrepancy = item.Difference
+		if item.Difference.IsNegative() {
+			item.Discrepancy = decimal.Min(item.Difference.Add(item.Pending), decimal.Zero)
+		}
+
+		var price decimal.Decimal
+		if asset, ok := assetMap[assetID]; ok {
+			price = asset.PriceUSD
+		}
+		item.DiscrepancyUSD = item.Discrepancy.Mul(price).Round(8)
+		if !item.Discrepancy.IsZero() {
+			item.Exceeded = price.IsZero() || item.DiscrepancyUSD.Abs().GreaterThan(threshold)
+		}
+		items = append(items, item)
+	}
+
+	if err := s.store.AddReconciliations(ctx, items); err != nil {
+		return nil, err
+	}
+
+	previousMap := lo.KeyBy(previous, func(r *model.Reconciliation) string { return r.AssetID })
+	for _, item := range items {
+		if !item.Exceeded {
+			continue
+		}
+		event := log.Warn().Any("reconciliation", item)
+		// 拉取 snapshot 时有无法读完的时间点, 差额可能来自其中未入账的 snapshot
+		if gap, err := s.store.GetSyncState(ctx, model.SyncStateSnapshotGap+item.AssetID); err == nil {
+			event = event.Str("snapshot_gap", gap.Value)
+		}
+		event.Msg("wallet reconciliation discrepancy exceeded")
+		// 与上一次相同的差额已经告警过
+		if prev, ok := previousMap[item.AssetID]; ok && prev.Exceeded && prev.Discrepancy.Equal(item.Discrepancy) {
+			continue
+		}
+		s.alertReconciliation(ctx, item, assetMap[item.AssetID])
+	}
+
+	return items, nil
+}
+
+// alertReconciliation 按接收人的语言发送对账告警
+func (s *Service) alertReconciliation(ctx context.Context, item *model.Reconciliation, asset *mixin.SafeAsset) {
+	if s.conf.Reconcile == nil {
+		return
+	}
+
+	symbol := item.AssetID
+	if asset != nil && asset.Symbol != "" {
+		symbol = asset.Symbol
+	}
+	for _, uid := range s.conf.Reconcile.AlertUserIDs {
+		lang := s.userLanguage(ctx, uid)
+		args := []interface{}{symbol, item.Expected.String(), item.Actual.String(), item.Discrepancy.String()}
+		text := s.catalog.T(lang, "reconcile_alert_no_price", args...)
+		if !item.DiscrepancyUSD.IsZero() {
+			text = s.catalog.T(lang, "reconcile_alert", append(args, item.DiscrepancyUSD.StringFixed(2))...)
+		}
+		if err := s.mixinClient.SendMessageWithRetry(ctx, uid, text); err != nil {
+			log.Error().Err(err).Str("user_id", uid).Msg("send reconcile alert failed")
+		}
+	}
+}
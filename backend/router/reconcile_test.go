@@ -0,0 +1,93 @@
+package router
+
+import (
+	"context"
+	"donate/config"
+	"donate/model"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	const operatorID = "7a9b1c3d-5e6f-4a8b-9c0d-2e4f6a8b0c1d"
+	env.svc.conf.Reconcile = &config.ReconcileConfig{AlertUserIDs: []string{operatorID}}
+
+	reconcile := func() *model.Reconciliation {
+		items, err := env.svc.reconcile(ctx)
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, testAssetID, items[0].AssetID)
+		return items[0]
+	}
+
+	// 入账后未转出, 转出提交后未确认, 确认后, 差额都为 0
+	env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(10), pidMemo(testPID))
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+	item := reconcile()
+	assert.Equal(t, "10", item.Actual.String())
+	assert.Equal(t, "10", item.Pending.String())
+	assert.True(t, item.Discrepancy.IsZero())
+
+	require.NoError(t, env.svc.handlePayouts(ctx))
+	item = reconcile()
+	assert.True(t, item.Discrepancy.IsZero())
+	assert.False(t, item.Exceeded)
+
+	require.NoError(t, env.svc.handlePayouts(ctx))
+	item = reconcile()
+	assert.Equal(t, "10", item.Paid.String())
+	assert.True(t, item.Expected.IsZero())
+	assert.True(t, item.Actual.IsZero())
+	assert.False(t, item.Exceeded)
+	assert.Empty(t, env.network.Messages(operatorID))
+
+	// memo 为空或无法解析的转入不是捐赠, 同样计入入账, 没有差额
+	env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(3), "")
+	env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(2), "not a pid")
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+	item = reconcile()
+	assert.Equal(t, "15", item.Received.String())
+	assert.Equal(t, "5", item.Actual.String())
+	assert.True(t, item.Discrepancy.IsZero(), item.Discrepancy.String())
+	assert.False(t, item.Exceeded)
+
+	// 机器人转给自己的聚合 snapshot 不计入入账
+	env.network.Deposit(testBotID, testAssetID, decimal.NewFromInt(5), "")
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+	item = reconcile()
+	assert.Equal(t, "15", item.Received.String())
+	assert.Equal(t, "5", item.Discrepancy.String())
+
+	// 差额超过阈值, 只告警一次
+	assert.Equal(t, "5", item.Discrepancy.String())
+	assert.Equal(t, "5", item.DiscrepancyUSD.String())
+	assert.True(t, item.Exceeded)
+	messages := env.network.Messages(operatorID)
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].Text, "USDT")
+
+	reconcile()
+	assert.Len(t, env.network.Messages(operatorID), 1)
+
+	// 运营后台查看最近一次对账
+	env.svc.conf.Admin = &config.AdminConfig{AccessKey: "ak", SecretKey: "sk"}
+	env.svc.initRouter()
+	req := httptest.NewRequest(http.MethodGet, "/admin/reconciliations/latest", nil)
+	req.Header.Set("Authorization", "Bearer ak:sk")
+	w := httptest.NewRecorder()
+	env.svc.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var latest []*model.Reconciliation
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &latest))
+	require.Len(t, latest, 1)
+	assert.True(t, latest[0].Exceeded)
+	assert.Equal(t, "5", latest[0].Discrepancy.String())
+}
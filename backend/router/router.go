@@ -6,41 +6,93 @@ import (
 	"donate/config"
 	"donate/model"
 	"donate/model/mixin_client_wrapper"
+	"donate/pkg/i18n"
+	"donate/pkg/jwt"
+	"donate/pkg/notify"
 	"donate/router/api"
 	publicMiddleware "donate/router/middleware"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
 
-	"github.com/fox-one/pkg/store2"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
 )
 
 type Service struct {
 	clock clock.Clock
+	conf  *config.Config
 
 	store       model.Store
-	mixinClient *mixin_client_wrapper.MixinClientWrapper
+	mixinClient mixin_client_wrapper.MixinClient
+	feed        *api.DonationFeed // 实时捐赠推送
 	apiServer   *api.ApiServer
 	router      *gin.Engine
+
+	webhookClient *http.Client // 投递项目方 webhook
+	notifier      *notify.Notifier
+	catalog       *i18n.Catalog // 接口错误和转账 memo 的多语言消息
+
+	reconcileMutex sync.Mutex // 同一时间只进行一次对账
 }
 
-func NewService(conf *config.Config, db *store2.DB) *Service {
+// NewService 配置缺少 jwt.secret_key 时返回错误, 不以空密钥启动
+func NewService(conf *config.Config, store model.Store) (*Service, error) {
+	if err := jwt.Init(conf.Jwt); err != nil {
+		return nil, fmt.Errorf("invalid jwt config, jwt.secret_key is required (see config.example.json): %w", err)
+	}
 	mixinClient, err := mixin_client_wrapper.NewMixinClientWrapper(conf.MixinConfig)
 	if err != nil {
 		panic(err)
 	}
-	store := model.NewStore(db)
 
+	return newService(conf, store, mixinClient, clock.New()), nil
+}
+
+func newService(conf *config.Config, store model.Store, mixinClient mixin_client_wrapper.MixinClient, clock clock.Clock) *Service {
+	notifier, err := notify.New(conf.Notification)
+	if err != nil {
+		panic(err)
+	}
+	catalog, err := i18n.New(conf.I18n)
+	if err != nil {
+		panic(err)
+	}
+
+	feed := api.NewDonationFeed()
 	srv := &Service{
-		clock:       clock.New(),
+		clock:       clock,
+		conf:        conf,
 		store:       store,
 		mixinClient: mixinClient,
-		apiServer:   api.New(mixinClient, store),
+		feed:        feed,
+		apiServer:   api.New(conf.MixinConfig, mixinClient, store, feed),
+
+		webhookClient: newWebhookClient(conf.Webhook),
+		notifier:      notifier,
+		catalog:       catalog,
 	}
 	srv.initRouter()
 
 	return srv
 }
 
+// userBanned 本地没有记录的用户视为未封禁
+func (s *Service) userBanned(ctx context.Context, uid string) (bool, error) {
+	user, err := s.store.GetUserByUID(ctx, uid)
+	switch err {
+	case nil:
+		return user.BannedAt != nil, nil
+	case gorm.ErrRecordNotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
 func (s *Service) initRouter() {
 	router := gin.New()
 	logger := log.Logger.With().Logger()
@@ -50,31 +102,99 @@ func (s *Service) initRouter() {
 		publicMiddleware.GinXid(&logger),
 		publicMiddleware.GinLogger(&logger),
 		publicMiddleware.GinRecovery(&logger, true),
+		publicMiddleware.Language(s.catalog),
 	)
 	router.GET("/project/:item", s.apiServer.GetProject)
+	router.GET("/project/:item/pay", s.apiServer.GetPaymentLink)            // 捐赠支付链接和二维码
+	router.GET("/project/:item/stream", s.apiServer.StreamProjectDonations) // 项目实时捐赠, SSE 或 WebSocket
+	router.GET("/donations/stream", s.apiServer.StreamDonations)            // 所有项目的实时捐赠
 	router.GET("/donate-users/:pid", s.apiServer.GetDonateUsersByPid)
 	router.GET("/projects", s.apiServer.GetProjects)
 	router.GET("/user/:ident", s.apiServer.GetUserByIdentityNumber)
 	router.GET("/users/search", s.apiServer.SearchUser)
 	router.GET("/users-donate/:ident", s.apiServer.GetProjectsByIdentityNumber)
 	router.GET("/assets", s.apiServer.GetAssets) // 提供支持捐赠的资产 以及资产价格
+	router.POST("/oauth", s.apiServer.OAuth)     // mixin oauth code 换取 token
+
+	// 需要登录, 只能操作自己的项目
+	authRouter := router.Group("", publicMiddleware.JWTAuthMiddleware(s.userBanned))
+	authRouter.GET("/me", s.apiServer.GetMe)
+	authRouter.PUT("/me/language", s.apiServer.UpdateMyLanguage) // 通知和转账 memo 的语言
+	authRouter.POST("/projects", s.apiServer.CreateProject)
+	authRouter.PUT("/projects/:pid", s.apiServer.UpdateProject)
+	authRouter.DELETE("/projects/:pid", s.apiServer.DeleteProject)
+	authRouter.POST("/projects/:pid/archive", s.apiServer.ArchiveProject)
+	authRouter.GET("/projects/:pid/webhooks", s.apiServer.ListWebhooks)
+	authRouter.POST("/projects/:pid/webhooks", s.apiServer.CreateWebhook)
+	authRouter.PUT("/projects/:pid/webhooks/:id", s.apiServer.UpdateWebhook)
+	authRouter.DELETE("/projects/:pid/webhooks/:id", s.apiServer.DeleteWebhook)
+	authRouter.POST("/projects/:pid/webhooks/:id/rotate", s.apiServer.RotateWebhookSecret) // 轮换签名密钥
+	authRouter.GET("/projects/:pid/webhooks/:id/deliveries", s.apiServer.ListWebhookDeliveries)
+	authRouter.POST("/projects/:pid/webhooks/:id/deliveries/:did/replay", s.apiServer.ReplayWebhookDelivery)
+
+	// 运营后台, 所有操作写入审计记录
+	if admin := s.conf.Admin; admin != nil && admin.AccessKey != "" && admin.SecretKey != "" {
+		publicMiddleware.InitAdmin(admin.AccessKey, admin.SecretKey)
+		adminRouter := router.Group("/admin", publicMiddleware.AdminAuthMiddleware(true), s.adminAudit())
+		adminRouter.GET("/snapshots", s.AdminListSnapshots)
+		adminRouter.GET("/donations", s.AdminListDonations)
+		adminRouter.GET("/audits", s.AdminListAudits)
+		adminRouter.PUT("/projects/:pid/moderation", s.AdminModerateProject)
+		adminRouter.PUT("/users/:uid/moderation", s.AdminModerateUser)
+		adminRouter.POST("/snapshots/:id/refund", s.AdminRefundSnapshot)
+		adminRouter.POST("/snapshots/:id/forward", s.AdminForwardSnapshot)
+		adminRouter.POST("/snapshots/:id/reprocess", s.AdminReprocessSnapshot)
+		adminRouter.GET("/reconciliations", s.AdminListReconciliations)
+		adminRouter.GET("/reconciliations/latest", s.AdminLatestReconciliations)
+		adminRouter.POST("/reconciliations", s.AdminReconcile) // 立即对账
+		adminRouter.GET("/ledger/balances", s.AdminLedgerBalances)
+		adminRouter.GET("/ledger/check", s.AdminCheckLedger) // 检查账本是否平衡
+		adminRouter.GET("/consolidations", s.AdminListConsolidations)
+	}
 
 	s.router = router
 }
 
-func (s *Service) Run(addr string) error {
-
-	// g, ctx := errgroup.WithContext(ctx)
-	// g.Go(func() error {
-	// 	return s.router.Run(addr)
-	// })
-	go s.RunMixinLoop(context.Background())
-	return s.router.Run(addr)
+// Run 在同一个 supervisor 下运行 http 服务和后台任务, 任一任务出错或 ctx 取消时全部退出
+// 退出时停止读取新的 snapshot, 进行中的入账和转账以及 http 请求在 shutdownTimeout 内完成
+func (s *Service) Run(ctx context.Context, addr string) error {
+	server := &http.Server{
+		Addr:    addr,
+		Handler: s.router,
+	}
 
-	// g.Go(func() error {
-	// 	// 后台轮询转账
-	// 	return nil
-	// })
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		return runWorker(ctx, "snapshot", s.RunMixinLoop)
+	})
+	g.Go(func() error {
+		return runWorker(ctx, "payout", s.RunPayoutLoop)
+	})
+	g.Go(func() error {
+		return runWorker(ctx, "webhook", s.RunWebhookLoop)
+	})
+	g.Go(func() error {
+		return runWorker(ctx, "reconcile", s.RunReconcileLoop)
+	})
+	g.Go(func() error {
+		return runWorker(ctx, "consolidate", s.RunConsolidateLoop)
+	})
+	g.Go(func() error {
+		log.Info().Str("addr", addr).Msg("http server started")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	})
+	g.Go(func() error {
+		<-ctx.Done()
+		log.Info().Msg("shutting down http server")
+		// 实时推送的长连接不会自行结束, 先断开才能完成 Shutdown
+		s.feed.Close()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout())
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	})
 
-	// return g.Wait()
+	return g.Wait()
 }
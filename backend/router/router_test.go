@@ -0,0 +1,87 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"donate/pkg/memo"
+	"donate/router/api"
+	"donate/router/middleware"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPaymentLink(t *testing.T) {
+	env := newTestEnv(t)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/project/"+testPID+"/pay?"+query, nil)
+		w := httptest.NewRecorder()
+		env.svc.router.ServeHTTP(w, req)
+		return w
+	}
+
+	query := "asset=" + testAssetID + "&amount=1.50&message=hi&anonymous=true&return_to=" + url.QueryEscape("https://example.com/done")
+	w := get(query)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp api.PaymentResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	u, err := url.Parse(resp.URI)
+	require.NoError(t, err)
+	assert.Equal(t, "/pay/"+testBotID, u.Path)
+	assert.Equal(t, "1.5", u.Query().Get("amount"))
+	assert.Equal(t, resp.Trace, u.Query().Get("trace"))
+	assert.Equal(t, "https://example.com/done", u.Query().Get("return_to"))
+
+	m, err := memo.Decode(u.Query().Get("memo"))
+	require.NoError(t, err)
+	assert.Equal(t, testPID, m.PID)
+	assert.Equal(t, "hi", m.Message)
+	assert.True(t, m.Anonymous)
+
+	// 相同参数生成相同的 trace, nonce 不同则不同
+	var again api.PaymentResponse
+	require.NoError(t, json.Unmarshal(get(query).Body.Bytes(), &again))
+	assert.Equal(t, resp.Trace, again.Trace)
+	require.NoError(t, json.Unmarshal(get(query+"&nonce=2").Body.Bytes(), &again))
+	assert.NotEqual(t, resp.Trace, again.Trace)
+
+	w = get(query + "&format=png")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+
+	w = get(query + "&format=svg")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "<svg")
+
+	assert.Equal(t, http.StatusBadRequest, get("asset="+testAssetID+"&amount=0").Code)
+	assert.Equal(t, http.StatusBadRequest, get("asset=abc&amount=1").Code)
+	assert.Equal(t, http.StatusBadRequest, get(query+"&format=gif").Code)
+
+	// 最长的留言和推荐码编码后不超过 mixin 的长度上限
+	w = get("asset=" + testAssetID + "&amount=1&anonymous=true&message=" + url.QueryEscape(strings.Repeat("好", memo.MaxMessageLength/3)) + "&referral=" + strings.Repeat("r", memo.MaxReferralLength))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.LessOrEqual(t, len(resp.Memo), memo.MaxEncodedLength)
+
+	// 留言和推荐码过长, 按编码后的字节数计算
+	base := "asset=" + testAssetID + "&amount=1"
+	for q, code := range map[string]string{
+		base + "&message=" + strings.Repeat("m", memo.MaxMessageLength+1):   "invalid_message",
+		base + "&message=" + url.QueryEscape(strings.Repeat("好", 140)):      "invalid_message",
+		base + "&referral=" + strings.Repeat("r", memo.MaxReferralLength+1): "invalid_referral",
+	} {
+		w := get(q)
+		assert.Equal(t, http.StatusBadRequest, w.Code, q)
+		var resp middleware.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, code, resp.Code, q)
+	}
+}
@@ -0,0 +1,95 @@
+package router
+
+import (
+	"bufio"
+	"context"
+	"donate/pkg/memo"
+	"donate/router/api"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitSubscribers 等待订阅建立后再捐赠, 否则事件会在订阅前发出
+func waitSubscribers(t *testing.T, env *testEnv, topic string, n int) {
+	require.Eventually(t, func() bool {
+		return env.svc.feed.Subscribers(topic) >= n
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+// readSSEEvent 读取下一个 donation 事件, 跳过 retry 和心跳
+func readSSEEvent(t *testing.T, r *bufio.Reader) *api.DonationEvent {
+	var event string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: ") && event == "donation":
+			var e api.DonationEvent
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e))
+			return &e
+		}
+	}
+}
+
+func TestStreamDonations(t *testing.T) {
+	env := newTestEnv(t)
+	server := httptest.NewServer(env.svc.router)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/project/"+testPID+"/stream", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/donations/stream"
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	waitSubscribers(t, env, testPID, 1)
+	waitSubscribers(t, env, "*", 1)
+
+	encoded, err := memo.Encode(&memo.Memo{PID: testPID, Message: "good luck", Anonymous: true})
+	require.NoError(t, err)
+	env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(2), hex.EncodeToString([]byte(encoded)))
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+
+	event := readSSEEvent(t, bufio.NewReader(resp.Body))
+	assert.Equal(t, testPID, event.PID)
+	assert.True(t, event.Amount.Equal(decimal.NewFromInt(2)))
+	assert.Equal(t, "USDT", event.Symbol)
+	assert.Equal(t, "good luck", event.Message)
+	assert.True(t, event.Anonymous)
+	assert.Empty(t, event.IdentityNumber)
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg api.WebSocketMessage
+	require.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, "donation", msg.Type)
+	require.NotNil(t, msg.Data)
+	assert.Equal(t, event.ID, msg.Data.ID)
+
+	// 不存在的项目
+	w := httptest.NewRecorder()
+	env.svc.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/project/6e8f0a2b-4c5d-4e7f-8a9b-1c3d5e7f9a0b/stream", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,44 @@
+package router
+
+import (
+	"context"
+	"donate/pkg/thread"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultShutdownTimeout = 15 * time.Second
+)
+
+// shutdownTimeout 收到退出信号后等待 http 请求和进行中任务完成的时间
+func (s *Service) shutdownTimeout() time.Duration {
+	if s.conf == nil || s.conf.ShutdownTimeoutSeconds <= 0 {
+		return defaultShutdownTimeout
+	}
+	return time.Duration(s.conf.ShutdownTimeoutSeconds) * time.Second
+}
+
+// runWorker 阻塞运行后台任务, 任务 panic 或在 ctx 取消前退出时返回错误, 由 supervisor 停止整个服务
+func runWorker(ctx context.Context, name string, fn func(ctx context.Context)) error {
+	thread.RunSafe(func() {
+		fn(ctx)
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return fmt.Errorf("worker %s stopped unexpectedly", name)
+}
+
+// drainContext 返回的 context 在 ctx 取消后再等待 timeout 才取消
+// 用于退出时完成进行中的转账和入账, 而不再开始新的任务
+func drainContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	drainCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(timeout, cancel)
+	})
+	return drainCtx, func() {
+		stop()
+		cancel()
+	}
+}
@@ -0,0 +1,35 @@
+package router
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	drainCtx, stop := drainContext(ctx, 50*time.Millisecond)
+	defer stop()
+
+	cancel()
+	// 父 context 取消后仍有 timeout 的时间完成进行中的任务
+	assert.NoError(t, drainCtx.Err())
+
+	select {
+	case <-drainCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("drain context not canceled after timeout")
+	}
+}
+
+func TestRunWorker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, runWorker(ctx, "done", func(ctx context.Context) { <-ctx.Done() }))
+
+	// panic 或提前退出都交给 supervisor 处理
+	assert.Error(t, runWorker(context.Background(), "panic", func(ctx context.Context) { panic("boom") }))
+	assert.Error(t, runWorker(context.Background(), "exit", func(ctx context.Context) {}))
+}
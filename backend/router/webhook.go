@@ -0,0 +1,211 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"donate/config"
+	"donate/model"
+	mr "donate/pkg/mapreduce"
+	"donate/pkg/webhook"
+	"donate/router/api"
+	"donate/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const (
+	webhookBatchSize     = 50
+	webhookWorkers       = 8
+	webhookMaxAttempts   = 12
+	webhookRetryBase     = 30 * time.Second
+	webhookRetryMax      = 6 * time.Hour
+	webhookSecretGrace   = 24 * time.Hour // 轮换密钥后旧密钥继续签名的时间
+	webhookResponseLimit = 1024           // 保存的响应体长度
+
+	defaultWebhookTimeout = 10 * time.Second
+)
+
+var (
+	ErrListDueWebhookDeliveriesFailed = errors.New("list due webhook deliveries failed")
+)
+
+// newWebhookClient 未配置时拒绝内网地址
+func newWebhookClient(conf *config.WebhookConfig) *http.Client {
+	timeout, allowPrivate := defaultWebhookTimeout, false
+	if conf != nil {
+		if conf.TimeoutSeconds > 0 {
+			timeout = time.Duration(conf.TimeoutSeconds) * time.Second
+		}
+		allowPrivate = conf.AllowPrivateNetwork
+	}
+	return webhook.NewClient(timeout, allowPrivate)
+}
+
+// newWebhookDeliveries 为项目启用的 webhook 生成捐赠的投递, 随捐赠记录在同一事务内写入
+// 投递 id 由捐赠和 webhook 确定性生成, 重复处理 snapshot 不会重复投递
+func (s *Service) newWebhookDeliveries(ctx context.Context, event *api.DonationEvent) ([]*model.WebhookDelivery, error) {
+	webhooks, err := s.store.ListWebhooksByPID(ctx, event.PID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now().Unix()
+	var payload []byte
+	var deliveries []*model.WebhookDelivery
+	for _, item := range webhooks {
+		if item.Disabled {
+			continue
+		}
+		if payload == nil {
+			payload, err = json.Marshal(&api.WebhookPayload{
+				ID:        event.ID,
+				Type:      model.WebhookEventDonation,
+				CreatedAt: event.CreatedAt.Unix(),
+				Data:      event,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		deliveries = append(deliveries, &model.WebhookDelivery{
+			ID:            utils.GenUuidFromStrings(event.ID, item.ID, "webhook"),
+			WebhookID:     item.ID,
+			PID:           event.PID,
+			Event:         model.WebhookEventDonation,
+			Payload:       string(payload),
+			Status:        model.WebhookDeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+	}
+	return deliveries, nil
+}
+
+// RunWebhookLoop 轮询投递 webhook, 阻塞直到 ctx 取消
+func (s *Service) RunWebhookLoop(ctx context.Context) {
+	ticker := s.clock.Ticker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Err(ctx.Err()).Msg("stop webhook loop")
+			return
+		case <-ticker.C:
+			err := s.handleWebhookDeliveries(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("cron handle webhook deliveries failed")
+			}
+		}
+	}
+}
+
+func (s *Service) handleWebhookDeliveries(ctx context.Context) error {
+	deliveries, err := s.store.ListDueWebhookDeliveries(ctx, s.clock.Now().Unix(), webhookBatchSize)
+	if err != nil {
+		return ErrListDueWebhookDeliveriesFailed
+	}
+
+	// 与出账相同, ctx 取消后不再开始新的投递, 进行中的请求在 shutdownTimeout 内完成
+	workCtx, cancel := drainContext(ctx, s.shutdownTimeout())
+	defer cancel()
+
+	mr.ForEach(func(source chan<- *model.WebhookDelivery) {
+		for _, delivery := range deliveries {
+			if ctx.Err() != nil {
+				return
+			}
+			source <- delivery
+		}
+	}, func(delivery *model.WebhookDelivery) {
+		if err := s.deliverWebhook(workCtx, delivery); err != nil {
+			log.Error().Str("delivery", delivery.ID).Err(err).Msg("deliver webhook failed")
+		}
+	}, mr.WithWorkers(webhookWorkers))
+
+	return ctx.Err()
+}
+
+// deliverWebhook 发送一次投递并记录响应, 失败时按退避时间安排下一次重试
+func (s *Service) deliverWebhook(ctx context.Context, delivery *model.WebhookDelivery) error {
+	item, err := s.store.GetWebhook(ctx, delivery.WebhookID)
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		return s.updateWebhookDelivery(ctx, delivery, model.WebhookDeliveryFailed, "webhook deleted")
+	case err != nil:
+		return err
+	case item.Disabled:
+		return s.updateWebhookDelivery(ctx, delivery, model.WebhookDeliveryFailed, "webhook disabled")
+	}
+
+	now := s.clock.Now()
+	secrets := []string{item.Secret}
+	if item.PreviousSecret != "" && now.Sub(time.Unix(item.RotatedAt, 0)) < webhookSecretGrace {
+		secrets = append(secrets, item.PreviousSecret)
+	}
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, item.URL, bytes.NewReader(body))
+	if err != nil {
+		return s.updateWebhookDelivery(ctx, delivery, model.WebhookDeliveryFailed, err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "donate-webhook/1.0")
+	req.Header.Set(webhook.HeaderEvent, delivery.Event)
+	req.Header.Set(webhook.HeaderDelivery, delivery.ID)
+	req.Header.Set(webhook.HeaderSignature, webhook.Signature(now.Unix(), body, secrets...))
+
+	delivery.Attempts++
+	delivery.ResponseStatus = 0
+	delivery.ResponseBody = ""
+	resp, err := s.webhookClient.Do(req)
+	if err != nil {
+		// 退出过程中被中断, 不计入重试次数
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return s.retryWebhookDelivery(ctx, delivery, err.Error())
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	delivery.ResponseStatus = resp.StatusCode
+	delivery.ResponseBody = string(respBody)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return s.retryWebhookDelivery(ctx, delivery, fmt.Sprintf("unexpected status %d", resp.StatusCode))
+	}
+
+	delivery.DeliveredAt = now.Unix()
+	return s.updateWebhookDelivery(ctx, delivery, model.WebhookDeliverySucceeded, "")
+}
+
+func (s *Service) retryWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery, lastError string) error {
+	if delivery.Attempts >= webhookMaxAttempts {
+		return s.updateWebhookDelivery(ctx, delivery, model.WebhookDeliveryFailed, lastError)
+	}
+	delivery.NextAttemptAt = s.clock.Now().Add(webhookBackoff(delivery.Attempts)).Unix()
+	return s.updateWebhookDelivery(ctx, delivery, model.WebhookDeliveryPending, lastError)
+}
+
+func (s *Service) updateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery, status, lastError string) error {
+	delivery.Status = status
+	delivery.LastError = lastError
+	delivery.UpdatedAt = s.clock.Now().Unix()
+	return s.store.UpdateWebhookDelivery(ctx, delivery)
+}
+
+// webhookBackoff 第 attempts 次失败后等待的时间, 从 webhookRetryBase 起翻倍, 最长 webhookRetryMax
+func webhookBackoff(attempts int) time.Duration {
+	d := webhookRetryBase
+	for i := 1; i < attempts && d < webhookRetryMax; i++ {
+		d *= 2
+	}
+	return min(d, webhookRetryMax)
+}
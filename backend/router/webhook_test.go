@@ -0,0 +1,165 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"donate/model"
+	"donate/pkg/jwt"
+	"donate/pkg/webhook"
+	"donate/router/api"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookReceiver 本地的 webhook 接收方, 按顺序返回 statuses 中的状态码, 用完后返回 200
+type webhookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []*receivedWebhook
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	r := &webhookReceiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, &receivedWebhook{header: req.Header.Clone(), body: body})
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *webhookReceiver) received() []*receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*receivedWebhook(nil), r.requests...)
+}
+
+// authRequest 以 uid 登录后请求 env 的接口
+func authRequest(t *testing.T, env *testEnv, uid, method, path string, body interface{}) *httptest.ResponseRecorder {
+	require.NoError(t, jwt.Init(&jwt.JwtConfig{SecretKey: "secret", TokenExpireSeconds: 3600}))
+	token, err := jwt.GenToken(uid)
+	require.NoError(t, err)
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	env.svc.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError)
+
+	base := "/projects/" + testPID + "/webhooks"
+	w := authRequest(t, env, testOwnerID, http.MethodPost, base, &api.WebhookRequest{URL: receiver.URL})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var created api.WebhookSecretResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.NotEmpty(t, created.Secret)
+	hookPath := base + "/" + created.ID
+
+	// 只有项目方可以管理
+	assert.Equal(t, http.StatusForbidden, authRequest(t, env, testDonorID, http.MethodGet, base, nil).Code)
+	assert.Equal(t, http.StatusBadRequest, authRequest(t, env, testOwnerID, http.MethodPost, base, &api.WebhookRequest{URL: "ftp://example.com"}).Code)
+
+	env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(2), pidMemo(testPID))
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+
+	// 第一次返回 500, 按退避时间重试
+	require.NoError(t, env.svc.handleWebhookDeliveries(ctx))
+	require.Len(t, receiver.received(), 1)
+	require.NoError(t, env.svc.handleWebhookDeliveries(ctx))
+	require.Len(t, receiver.received(), 1)
+
+	env.clock.Add(webhookRetryBase)
+	require.NoError(t, env.svc.handleWebhookDeliveries(ctx))
+	requests := receiver.received()
+	require.Len(t, requests, 2)
+
+	req := requests[1]
+	assert.Equal(t, model.WebhookEventDonation, req.header.Get(webhook.HeaderEvent))
+	assert.NoError(t, webhook.Verify(req.header.Get(webhook.HeaderSignature), req.body, created.Secret, env.clock.Now(), time.Minute))
+	var payload api.WebhookPayload
+	require.NoError(t, json.Unmarshal(req.body, &payload))
+	assert.Equal(t, model.WebhookEventDonation, payload.Type)
+	assert.Equal(t, testPID, payload.Data.PID)
+	assert.Equal(t, "1001", payload.Data.IdentityNumber)
+	assert.True(t, payload.Data.Amount.Equal(decimal.NewFromInt(2)))
+
+	w = authRequest(t, env, testOwnerID, http.MethodGet, hookPath+"/deliveries", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var deliveries []*model.WebhookDelivery
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &deliveries))
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, model.WebhookDeliverySucceeded, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusOK, deliveries[0].ResponseStatus)
+	assert.Equal(t, req.header.Get(webhook.HeaderDelivery), deliveries[0].ID)
+
+	// 轮换密钥后重放, 新旧密钥的签名都可以校验
+	w = authRequest(t, env, testOwnerID, http.MethodPost, hookPath+"/rotate", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var rotated api.WebhookSecretResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+	assert.NotEqual(t, created.Secret, rotated.Secret)
+
+	w = authRequest(t, env, testOwnerID, http.MethodPost, hookPath+"/deliveries/"+deliveries[0].ID+"/replay", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, env.svc.handleWebhookDeliveries(ctx))
+	requests = receiver.received()
+	require.Len(t, requests, 3)
+	req = requests[2]
+	assert.Equal(t, requests[1].body, req.body)
+	assert.NoError(t, webhook.Verify(req.header.Get(webhook.HeaderSignature), req.body, rotated.Secret, env.clock.Now(), time.Minute))
+	assert.NoError(t, webhook.Verify(req.header.Get(webhook.HeaderSignature), req.body, created.Secret, env.clock.Now(), time.Minute))
+
+	// 停用后不再为新的捐赠创建投递
+	w = authRequest(t, env, testOwnerID, http.MethodPut, hookPath, &api.WebhookRequest{URL: receiver.URL, Disabled: true})
+	require.Equal(t, http.StatusOK, w.Code)
+	env.network.Deposit(testDonorID, testAssetID, decimal.NewFromInt(1), pidMemo(testPID))
+	require.NoError(t, env.svc.handleMixinSnapshotInput(ctx))
+	require.NoError(t, env.svc.handleWebhookDeliveries(ctx))
+	assert.Len(t, receiver.received(), 3)
+
+	w = authRequest(t, env, testOwnerID, http.MethodDelete, hookPath, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusNotFound, authRequest(t, env, testOwnerID, http.MethodGet, hookPath+"/deliveries", nil).Code)
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	assert.Equal(t, webhookRetryBase, webhookBackoff(1))
+	assert.Equal(t, 4*webhookRetryBase, webhookBackoff(3))
+	assert.Equal(t, webhookRetryMax, webhookBackoff(webhookMaxAttempts))
+}
@@ -89,8 +89,9 @@ func BuildMixinOneSafePaymentURI(params PaymentParams) string {
 		query.Set("trace", newUUID())
 	}
 
+	// query.Encode 已经转义, 不能再次 QueryEscape
 	if params.ReturnTo != "" {
-		query.Set("return_to", url.QueryEscape(params.ReturnTo))
+		query.Set("return_to", params.ReturnTo)
 	}
 
 	return fmt.Sprintf("%s?%s", baseURL, query.Encode())
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"net/url"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -21,3 +22,21 @@ func TestGenUuidFromStrings(t *testing.T) {
 	ID5 := GenUuidFromStrings()
 	assert.Equal(t, ID4, ID5)
 }
+
+func TestBuildMixinOneSafePaymentURI(t *testing.T) {
+	uri := BuildMixinOneSafePaymentURI(PaymentParams{
+		UUID:     "46a2645c-3264-4569-b462-823b5cb968e7",
+		Asset:    "965e5c6e-434c-3fa9-b780-c50f43cd955c",
+		Amount:   "1.5",
+		Memo:     "memo",
+		Trace:    "bde0e466-d8d8-4bea-8bab-89a85203158c",
+		ReturnTo: "https://example.com/thanks?id=1",
+	})
+
+	u, err := url.Parse(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "/pay/46a2645c-3264-4569-b462-823b5cb968e7", u.Path)
+	assert.Equal(t, "1.5", u.Query().Get("amount"))
+	assert.Equal(t, "bde0e466-d8d8-4bea-8bab-89a85203158c", u.Query().Get("trace"))
+	assert.Equal(t, "https://example.com/thanks?id=1", u.Query().Get("return_to"))
+}